@@ -19,8 +19,13 @@ package abi
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 // The ABI holds information about a contract's context and available
@@ -165,3 +170,53 @@ func (abi *ABI) MethodById(sigdata []byte) (*Method, error) {
 	}
 	return nil, fmt.Errorf("no method with id: %#x", sigdata[:4])
 }
+
+// revertSelector is a special function selector for revert reason unpacking.
+var revertSelector = crypto.Keccak256([]byte("Error(string)"))[:4]
+
+// UnpackRevert resolves the abi-encoded revert reason. According to the solidity
+// spec https://solidity.readthedocs.io/en/latest/control-structures.html#revert,
+// the provided revert reason is abi-encoded as if it were a call to a function
+// `Error(string)`. So it's a special tool for it.
+func UnpackRevert(data []byte) (string, error) {
+	if len(data) < 4 {
+		return "", errors.New("invalid data for unpacking")
+	}
+	if !bytes.Equal(data[:4], revertSelector) {
+		return "", errors.New("invalid data for unpacking")
+	}
+	typ, _ := NewType("string", nil)
+	var unpacked string
+	if err := (Arguments{{Type: typ}}).Unpack(&unpacked, data[4:]); err != nil {
+		return "", err
+	}
+	return unpacked, nil
+}
+
+// RevertError is an error returned by contract calls which were reverted by the
+// EVM. It carries the raw revert data alongside the decoded Error(string) reason,
+// if the data could be decoded as such.
+type RevertError struct {
+	Reason string // Decoded revert reason, empty if the data is not an Error(string)
+	Data   []byte // Raw data returned by the reverted execution
+}
+
+// NewRevertError creates a revert error from the data returned by the EVM,
+// decoding the revert reason if possible.
+func NewRevertError(data []byte) *RevertError {
+	reason, _ := UnpackRevert(data)
+	return &RevertError{Reason: reason, Data: common.CopyBytes(data)}
+}
+
+// Error implements error, returning the decoded reason if available or the raw
+// revert data otherwise.
+func (e *RevertError) Error() string {
+	switch {
+	case e.Reason != "":
+		return "execution reverted: " + e.Reason
+	case len(e.Data) > 0:
+		return "execution reverted: " + hexutil.Encode(e.Data)
+	default:
+		return "execution reverted"
+	}
+}
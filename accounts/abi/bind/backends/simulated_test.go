@@ -17,11 +17,14 @@
 package backends_test
 
 import (
+	"bytes"
 	"context"
 	"math/big"
+	"strings"
 	"testing"
 
 	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
 	"github.com/ethereum/go-ethereum/common"
@@ -80,3 +83,35 @@ func TestSimulatedBackend(t *testing.T) {
 	}
 
 }
+
+func TestSimulatedBackendCallRevert(t *testing.T) {
+	var (
+		contract = common.Address{0xc0}
+		// Error("revert reason") abi-encoded
+		reason = common.FromHex("0x08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000d72657665727420726561736f6e00000000000000000000000000000000000000")
+		// PUSH1 100 PUSH1 12 PUSH1 0 CODECOPY PUSH1 100 PUSH1 0 REVERT
+		code = append(common.FromHex("0x6064600c60003960646000fd"), reason...)
+	)
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{contract: {Code: code, Balance: new(big.Int)}}, 8000000)
+
+	parsed, err := abi.JSON(strings.NewReader(`[{"type":"function","name":"get","constant":true,"inputs":[],"outputs":[{"name":"","type":"uint256"}]}]`))
+	if err != nil {
+		t.Fatalf("failed to parse abi: %v", err)
+	}
+	bound := bind.NewBoundContract(contract, parsed, sim, sim, sim)
+
+	var result *big.Int
+	for _, pending := range []bool{false, true} {
+		err := bound.Call(&bind.CallOpts{Pending: pending}, &result, "get")
+		revert, ok := err.(*abi.RevertError)
+		if !ok {
+			t.Fatalf("pending %v: error type mismatch: have %T (%v), want *abi.RevertError", pending, err, err)
+		}
+		if revert.Reason != "revert reason" {
+			t.Errorf("pending %v: revert reason mismatch: have %q, want %q", pending, revert.Reason, "revert reason")
+		}
+		if !bytes.Equal(revert.Data, reason) {
+			t.Errorf("pending %v: revert data mismatch: have %x, want %x", pending, revert.Data, reason)
+		}
+	}
+}
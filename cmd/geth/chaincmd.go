@@ -32,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/event"
@@ -48,6 +49,7 @@ var (
 		ArgsUsage: "<genesisPath>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -64,6 +66,7 @@ It expects the genesis file as argument.`,
 		ArgsUsage: "<filename> (<filename 2> ... <filename N>) ",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.SyncModeFlag,
 			utils.GCModeFlag,
@@ -103,6 +106,7 @@ be gzipped.`,
 		ArgsUsage: "<datafile>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.SyncModeFlag,
 		},
@@ -123,6 +127,48 @@ be gzipped.`,
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
 The export-preimages command export hash preimages to an RLP encoded stream`,
+	}
+	exportAncientsCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportAncients),
+		Name:      "export-ancients",
+		Usage:     "Export a range of ancient chain items into an archive file",
+		ArgsUsage: "<filename> [<blockNumFirst> <blockNumLast>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.CacheFlag,
+			utils.TestnetFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+Exports the headers, bodies, receipts, hashes and total difficulties of a range
+of blocks from the ancient store into a checksummed archive. If no range is
+given, the entire ancient store is exported. If the file ends with .gz, the
+output will be gzipped.`,
+	}
+	importAncientsCommand = cli.Command{
+		Action:    utils.MigrateFlags(importAncients),
+		Name:      "import-ancients",
+		Usage:     "Import an archive of ancient chain items into the ancient store",
+		ArgsUsage: "<filename> (<filename 2> ... <filename N>) ",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.DBEngineFlag,
+			utils.AncientFlag,
+			utils.CacheFlag,
+			utils.TestnetFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+Imports archives created by export-ancients into the ancient store of a fresh
+datadir, in the given order. Every archive must continue where the ancient
+store ends, and its blocks are validated against their headers and linked to
+the preceding ones. The chain is initialized from the ancient store when geth
+is started afterwards.`,
 	}
 	copydbCommand = cli.Command{
 		Action:    utils.MigrateFlags(copyDb),
@@ -131,6 +177,7 @@ The export-preimages command export hash preimages to an RLP encoded stream`,
 		ArgsUsage: "<sourceChaindataDir>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.SyncModeFlag,
 			utils.FakePoWFlag,
@@ -184,6 +231,34 @@ Use "ethereum dump 0" to dump the genesis block.`,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 	}
+	pruneStateCommand = cli.Command{
+		Action:    utils.MigrateFlags(pruneState),
+		Name:      "prune-state",
+		Usage:     "Delete the state data not reachable from recent blocks",
+		ArgsUsage: "[<root>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.CacheFlag,
+			utils.TestnetFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.PruneRecentFlag,
+			utils.PruneBloomSizeFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The prune-state command deletes all trie nodes and contract code from the
+database which are not part of the states of the most recent blocks, and
+compacts the database afterwards. The genesis state is always retained, and if
+a state root is given, its state is retained too. The node must not be running
+while the command executes.
+
+The retained state is marked in a bloom filter of the configured size, which
+is persisted before any data is deleted. If pruning is interrupted, it will be
+completed from that bloom filter by the next run of this command or when geth
+is started.`,
+	}
 )
 
 // initGenesis will initialise the given JSON format genesis file and writes it as
@@ -383,6 +458,63 @@ func exportPreimages(ctx *cli.Context) error {
 	return nil
 }
 
+func exportAncients(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 && len(ctx.Args()) != 3 {
+		utils.Fatalf("This command requires one or three arguments.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	frozen, err := db.Ancients()
+	if err != nil {
+		utils.Fatalf("Failed to access ancient store: %v", err)
+	}
+	if frozen == 0 {
+		utils.Fatalf("Ancient store is empty")
+	}
+	first, last := uint64(0), frozen-1
+	if len(ctx.Args()) == 3 {
+		var ferr, lerr error
+		first, ferr = strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+		last, lerr = strconv.ParseUint(ctx.Args().Get(2), 10, 64)
+		if ferr != nil || lerr != nil {
+			utils.Fatalf("Export error in parsing parameters: block number not an integer\n")
+		}
+	}
+	start := time.Now()
+	if err := utils.ExportAncients(db, ctx.Args().First(), first, last); err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	fmt.Printf("Export done in %v\n", time.Since(start))
+	return nil
+}
+
+func importAncients(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	if rawdb.ReadHeadHeaderHash(db) != (common.Hash{}) {
+		utils.Fatalf("Ancient chain segments can only be imported into a fresh datadir")
+	}
+	start := time.Now()
+	for _, arg := range ctx.Args() {
+		if err := utils.ImportAncients(db, arg); err != nil {
+			utils.Fatalf("Import error: %v\n", err)
+		}
+	}
+	fmt.Printf("Import done in %v\n", time.Since(start))
+	return nil
+}
+
 func copyDb(ctx *cli.Context) error {
 	// Ensure we have a source chain directory to copy
 	if len(ctx.Args()) < 1 {
@@ -405,7 +537,7 @@ func copyDb(ctx *cli.Context) error {
 	dl := downloader.New(0, chainDb, syncBloom, new(event.TypeMux), chain, nil, nil)
 
 	// Create a source peer to satisfy downloader requests from
-	db, err := rawdb.NewLevelDBDatabaseWithFreezer(ctx.Args().First(), ctx.GlobalInt(utils.CacheFlag.Name)/2, 256, ctx.Args().Get(1), "")
+	db, err := rawdb.NewDiskDatabaseWithFreezer("", ctx.Args().First(), ctx.GlobalInt(utils.CacheFlag.Name)/2, 256, ctx.Args().Get(1), "", false)
 	if err != nil {
 		return err
 	}
@@ -537,6 +669,67 @@ func inspect(ctx *cli.Context) error {
 	return rawdb.InspectDatabase(chainDb)
 }
 
+func pruneState(ctx *cli.Context) error {
+	if len(ctx.Args()) > 1 {
+		utils.Fatalf("This command requires at most one argument.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	head := rawdb.ReadHeadBlockHash(chainDb)
+	if head == (common.Hash{}) {
+		utils.Fatalf("No head block found")
+	}
+	if rawdb.ReadHeadFastBlockHash(chainDb) != head {
+		utils.Fatalf("Fast sync in progress, prune the state once it finished")
+	}
+	number := rawdb.ReadHeaderNumber(chainDb, head)
+	if number == nil {
+		utils.Fatalf("Head block %x missing", head)
+	}
+	headHeader := rawdb.ReadHeader(chainDb, head, *number)
+	if headHeader == nil {
+		utils.Fatalf("Head block %x missing", head)
+	}
+	// Gather the state roots to retain, ordered so neighbours share most state
+	var (
+		roots  []common.Hash
+		retain = make(map[common.Hash]bool)
+	)
+	if ctx.NArg() > 0 {
+		blob := common.FromHex(ctx.Args().First())
+		if len(blob) != common.HashLength {
+			utils.Fatalf("Invalid state root %q", ctx.Args().First())
+		}
+		root := common.BytesToHash(blob)
+		roots, retain[root] = append(roots, root), true
+	}
+	recent := ctx.Uint64(utils.PruneRecentFlag.Name)
+	for i := uint64(0); i < recent && i <= *number; i++ {
+		header := rawdb.ReadHeader(chainDb, rawdb.ReadCanonicalHash(chainDb, *number-i), *number-i)
+		if header == nil {
+			break
+		}
+		if ok, _ := chainDb.Has(header.Root[:]); !ok || retain[header.Root] {
+			continue
+		}
+		roots, retain[header.Root] = append(roots, header.Root), true
+	}
+	if !retain[headHeader.Root] {
+		log.Warn("Head state not retained, the chain will be rewound on the next start", "number", *number)
+	}
+	log.Info("Pruning state", "head", *number, "retained", len(roots))
+
+	p := pruner.NewPruner(chainDb, stack.ResolvePath(pruner.BloomFileName), ctx.Uint64(utils.PruneBloomSizeFlag.Name))
+	if err := p.Prune(roots); err != nil {
+		utils.Fatalf("State pruning failed: %v", err)
+	}
+	return nil
+}
+
 // hashish returns true for strings that look like hashes.
 func hashish(x string) bool {
 	_, err := strconv.Atoi(x)
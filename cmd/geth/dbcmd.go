@@ -0,0 +1,581 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	dbCommand = cli.Command{
+		Name:      "db",
+		Usage:     "Low level database operations",
+		ArgsUsage: "",
+		Category:  "DATABASE COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:   "verify-freezer",
+				Usage:  "Verify the integrity of the ancient store",
+				Action: utils.MigrateFlags(verifyFreezer),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.TestnetFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+    geth db verify-freezer
+
+Reads every item of the ancient store, checking it against its checksum, and
+reports the corrupt ones together with the options to repair them. Items frozen
+before checksums were introduced can't be verified and are reported separately.
+The node must not be running.`,
+			},
+			{
+				Name:      "get",
+				Usage:     "Show the raw value of a database key",
+				ArgsUsage: "<hex-key>",
+				Action:    utils.MigrateFlags(dbGet),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.SyncModeFlag,
+					utils.TestnetFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+    geth db get <hex-key>
+
+Prints the value stored under the given key of the key-value store in hex.`,
+			},
+			{
+				Name:      "decode",
+				Usage:     "Show the decoded value of a database key",
+				ArgsUsage: "<hex-key>",
+				Action:    utils.MigrateFlags(dbDecode),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.SyncModeFlag,
+					utils.TestnetFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+    geth db decode <hex-key>
+
+Prints the value stored under the given key of the key-value store as JSON,
+decoded according to the database schema. Headers, bodies, receipts, total
+difficulties, canonical hashes, transaction lookups, bloom bits, preimages,
+chain configs and metadata entries are recognised.`,
+			},
+			{
+				Name:      "put",
+				Usage:     "Set the raw value of a database key",
+				ArgsUsage: "<hex-key> <hex-value>",
+				Action:    utils.MigrateFlags(dbPut),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.SyncModeFlag,
+					utils.TestnetFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+    geth db put <hex-key> <hex-value>
+
+Stores the given value under the given key of the key-value store, printing the
+value it replaces. Use with extreme caution, the value is not validated.`,
+			},
+			{
+				Name:      "delete",
+				Usage:     "Delete a database key",
+				ArgsUsage: "<hex-key>",
+				Action:    utils.MigrateFlags(dbDelete),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.SyncModeFlag,
+					utils.TestnetFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+    geth db delete <hex-key>
+
+Deletes the given key from the key-value store, printing the value it held. Use
+with extreme caution.`,
+			},
+			{
+				Name:      "iterate",
+				Usage:     "List the database entries with a key prefix",
+				ArgsUsage: "[<hex-prefix>]",
+				Action:    utils.MigrateFlags(dbIterate),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.SyncModeFlag,
+					utils.TestnetFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					dbStartFlag,
+					dbLimitFlag,
+				},
+				Description: `
+    geth db iterate [--start <hex-key>] [--limit <n>] [<hex-prefix>]
+
+Prints the keys and values of the key-value store starting with the given
+prefix in hex, one entry per line. At most --limit entries are printed, if more
+are available the key to continue from is printed as well, which can be passed
+as --start to retrieve the next page.`,
+			},
+			{
+				Name:   "heads",
+				Usage:  "Show the head markers of the database",
+				Action: utils.MigrateFlags(dbHeads),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.SyncModeFlag,
+					utils.TestnetFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+    geth db heads
+
+Prints the database version, the head header, block and fast block markers, the
+number of ancient items and the progress of fast sync.`,
+			},
+			{
+				Name:      "dump-storage",
+				Usage:     "Dump the storage of a contract",
+				ArgsUsage: "<address> [<root>]",
+				Action:    utils.MigrateFlags(dbDumpStorage),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.TestnetFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					dbStartFlag,
+					dbLimitFlag,
+				},
+				Description: `
+    geth db dump-storage [--start <hex-slot-hash>] [--limit <n>] <address> [<root>]
+
+Prints the storage slots of a contract as JSON, in the state with the given root
+or the one of the head block. Slots are ordered by the hash of their key, the
+key itself is only shown if its preimage is available. At most --limit slots are
+printed, if more are available the slot hash to continue from is printed as
+well, which can be passed as --start to retrieve the next page.`,
+			},
+			{
+				Name:      "restore-freezer",
+				Usage:     "Restore corrupt ancient items from an archive",
+				ArgsUsage: "<filename>",
+				Action:    utils.MigrateFlags(restoreFreezer),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.TestnetFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+    geth db restore-freezer <filename>
+
+Replaces the items of the ancient store from the first block of the archive
+onwards with the items of the archive, which must have been created by
+export-ancients and reach the end of the ancient store. The items are validated
+against their headers and linked to the preceding ones. If the file ends with
+.gz, it will be gunzipped. The node must not be running.`,
+			},
+		},
+	}
+)
+
+var (
+	dbStartFlag = cli.StringFlag{
+		Name:  "start",
+		Usage: "Hex encoded key to start iterating from",
+	}
+	dbLimitFlag = cli.IntFlag{
+		Name:  "limit",
+		Usage: "Maximum number of entries to print",
+		Value: 100,
+	}
+)
+
+// ancientPath returns the path of the ancient store, taking the custom location
+// configured by the user into account.
+func ancientPath(ctx *cli.Context) string {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	path := ctx.GlobalString(utils.AncientFlag.Name)
+	switch {
+	case path == "":
+		path = filepath.Join(stack.ResolvePath("chaindata"), "ancient")
+	case !filepath.IsAbs(path):
+		path = stack.ResolvePath(path)
+	}
+	return path
+}
+
+func verifyFreezer(ctx *cli.Context) error {
+	path := ancientPath(ctx)
+
+	start := time.Now()
+	report, err := rawdb.VerifyFreezer(path)
+	if err != nil {
+		utils.Fatalf("Failed to verify ancient store: %v", err)
+	}
+	fmt.Printf("Verified %d ancient items in %v\n", report.Items, time.Since(start))
+
+	for table, unchecked := range report.Unchecked {
+		fmt.Printf("Table %s: %d legacy items without checksums\n", table, unchecked)
+	}
+	if len(report.Corrupt) == 0 {
+		fmt.Println("No corrupt items found")
+		return nil
+	}
+	first, last := report.Corrupt[0].Item, report.Corrupt[0].Item
+	for _, corrupt := range report.Corrupt {
+		fmt.Printf("Table %s: item #%d corrupt: %v\n", corrupt.Table, corrupt.Item, corrupt.Err)
+		if corrupt.Item < first {
+			first = corrupt.Item
+		}
+		if corrupt.Item > last {
+			last = corrupt.Item
+		}
+	}
+	fmt.Printf(`
+Found %d corrupt items between #%d and #%d. To repair the ancient store, either
+
+  - export the items from a healthy node and restore them into this one:
+      geth export-ancients <filename> %d %d   (on the healthy node)
+      geth db restore-freezer <filename>
+  - or remove the database and resynchronise the chain:
+      geth removedb
+`, len(report.Corrupt), first, last, first, report.Items-1)
+	return fmt.Errorf("%d corrupt ancient items", len(report.Corrupt))
+}
+
+func restoreFreezer(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	path := ancientPath(ctx)
+
+	start := time.Now()
+	if err := utils.RestoreFreezer(path, ctx.Args().First()); err != nil {
+		utils.Fatalf("Restore error: %v\n", err)
+	}
+	fmt.Printf("Restore done in %v\n", time.Since(start))
+	return nil
+}
+
+// parseHexArg decodes a hex encoded command line argument, with or without the
+// 0x prefix.
+func parseHexArg(name string, arg string) []byte {
+	if strings.HasPrefix(arg, "0x") || strings.HasPrefix(arg, "0X") {
+		arg = arg[2:]
+	}
+	blob, err := hex.DecodeString(arg)
+	if err != nil {
+		utils.Fatalf("Invalid hex %s %q: %v", name, arg, err)
+	}
+	return blob
+}
+
+func dbGet(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	key := parseHexArg("key", ctx.Args().First())
+	value, err := db.Get(key)
+	if err != nil {
+		utils.Fatalf("Failed to retrieve key %#x: %v", key, err)
+	}
+	fmt.Printf("%#x\n", value)
+	return nil
+}
+
+func dbDecode(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	key := parseHexArg("key", ctx.Args().First())
+	value, err := db.Get(key)
+	if err != nil {
+		utils.Fatalf("Failed to retrieve key %#x: %v", key, err)
+	}
+	kind, decoded, err := rawdb.DecodeEntry(key, value)
+	if err != nil {
+		utils.Fatalf("Failed to decode value of key %#x: %v", key, err)
+	}
+	out, err := json.MarshalIndent(decoded, "", "  ")
+	if err != nil {
+		utils.Fatalf("Failed to encode %s: %v", kind, err)
+	}
+	fmt.Printf("Kind: %s\n%s\n", kind, out)
+	return nil
+}
+
+func dbPut(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 {
+		utils.Fatalf("This command requires two arguments.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	var (
+		key   = parseHexArg("key", ctx.Args().Get(0))
+		value = parseHexArg("value", ctx.Args().Get(1))
+	)
+	if prev, err := db.Get(key); err == nil {
+		fmt.Printf("Previous value: %#x\n", prev)
+	}
+	if err := db.Put(key, value); err != nil {
+		utils.Fatalf("Failed to store key %#x: %v", key, err)
+	}
+	return nil
+}
+
+func dbDelete(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	key := parseHexArg("key", ctx.Args().First())
+	prev, err := db.Get(key)
+	if err != nil {
+		utils.Fatalf("Failed to retrieve key %#x: %v", key, err)
+	}
+	fmt.Printf("Previous value: %#x\n", prev)
+	if err := db.Delete(key); err != nil {
+		utils.Fatalf("Failed to delete key %#x: %v", key, err)
+	}
+	return nil
+}
+
+func dbIterate(ctx *cli.Context) error {
+	if len(ctx.Args()) > 1 {
+		utils.Fatalf("This command requires at most one argument.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	var prefix []byte
+	if len(ctx.Args()) == 1 {
+		prefix = parseHexArg("prefix", ctx.Args().First())
+	}
+	it := db.NewIteratorWithPrefix(prefix)
+	if start := ctx.String(dbStartFlag.Name); start != "" {
+		key := parseHexArg("start", start)
+		if !bytes.HasPrefix(key, prefix) {
+			utils.Fatalf("Start key %#x outside of prefix %#x", key, prefix)
+		}
+		it.Release()
+		it = db.NewIteratorWithStart(key)
+	}
+	defer it.Release()
+
+	limit := ctx.Int(dbLimitFlag.Name)
+	for count := 0; it.Next() && bytes.HasPrefix(it.Key(), prefix); count++ {
+		if count == limit {
+			fmt.Printf("More entries available, continue with --%s %#x\n", dbStartFlag.Name, it.Key())
+			break
+		}
+		fmt.Printf("%#x %#x\n", it.Key(), it.Value())
+	}
+	return it.Error()
+}
+
+func dbHeads(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	if version := rawdb.ReadDatabaseVersion(db); version != nil {
+		fmt.Printf("Database version:   %d\n", *version)
+	} else {
+		fmt.Println("Database version:   none")
+	}
+	for _, head := range []struct {
+		name string
+		hash common.Hash
+	}{
+		{"Head header:", rawdb.ReadHeadHeaderHash(db)},
+		{"Head block:", rawdb.ReadHeadBlockHash(db)},
+		{"Head fast block:", rawdb.ReadHeadFastBlockHash(db)},
+	} {
+		if number := rawdb.ReadHeaderNumber(db, head.hash); number != nil {
+			fmt.Printf("%-19s #%d [%x]\n", head.name, *number, head.hash)
+		} else {
+			fmt.Printf("%-19s unknown [%x]\n", head.name, head.hash)
+		}
+	}
+	frozen, err := db.Ancients()
+	if err != nil {
+		utils.Fatalf("Failed to access ancient store: %v", err)
+	}
+	fmt.Printf("Ancient items:      %d\n", frozen)
+	fmt.Printf("Fast trie progress: %d\n", rawdb.ReadFastTrieProgress(db))
+	if root := rawdb.ReadSnapshotRoot(db); root != (common.Hash{}) {
+		fmt.Printf("Snapshot root:      %x\n", root)
+	}
+	return nil
+}
+
+// storageDump is the JSON representation of a page of contract storage.
+type storageDump struct {
+	Root        common.Hash                      `json:"root"`
+	Address     common.Address                   `json:"address"`
+	StorageRoot common.Hash                      `json:"storageRoot"`
+	Storage     map[common.Hash]storageDumpEntry `json:"storage"`
+	Next        *common.Hash                     `json:"next,omitempty"`
+}
+
+// storageDumpEntry is a single storage slot of a contract storage dump.
+type storageDumpEntry struct {
+	Key   *common.Hash  `json:"key,omitempty"`
+	Value hexutil.Bytes `json:"value"`
+}
+
+func dbDumpStorage(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 || len(ctx.Args()) > 2 {
+		utils.Fatalf("This command requires one or two arguments.")
+	}
+	if !common.IsHexAddress(ctx.Args().First()) {
+		utils.Fatalf("Invalid contract address %q", ctx.Args().First())
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	dump := storageDump{
+		Address: common.HexToAddress(ctx.Args().First()),
+		Storage: make(map[common.Hash]storageDumpEntry),
+	}
+	if len(ctx.Args()) == 2 {
+		dump.Root = common.BytesToHash(parseHexArg("root", ctx.Args().Get(1)))
+	} else {
+		var (
+			hash   = rawdb.ReadHeadBlockHash(db)
+			header *types.Header
+		)
+		if number := rawdb.ReadHeaderNumber(db, hash); number != nil {
+			header = rawdb.ReadHeader(db, hash, *number)
+		}
+		if header == nil {
+			utils.Fatalf("Failed to load head block %x", hash)
+		}
+		dump.Root = header.Root
+	}
+	statedb, err := state.New(dump.Root, state.NewDatabase(db))
+	if err != nil {
+		utils.Fatalf("Failed to open state %x: %v", dump.Root, err)
+	}
+	storage := statedb.StorageTrie(dump.Address)
+	if storage == nil {
+		utils.Fatalf("Account %x not found in state %x", dump.Address, dump.Root)
+	}
+	dump.StorageRoot = storage.Hash()
+
+	var start []byte
+	if arg := ctx.String(dbStartFlag.Name); arg != "" {
+		start = parseHexArg("start", arg)
+	}
+	var (
+		limit = ctx.Int(dbLimitFlag.Name)
+		it    = trie.NewIterator(storage.NodeIterator(start))
+	)
+	for it.Next() {
+		slot := common.BytesToHash(it.Key)
+		if len(dump.Storage) == limit {
+			dump.Next = &slot
+			break
+		}
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			utils.Fatalf("Invalid storage slot %x: %v", slot, err)
+		}
+		entry := storageDumpEntry{Value: content}
+		if preimage := storage.GetKey(it.Key); preimage != nil {
+			key := common.BytesToHash(preimage)
+			entry.Key = &key
+		}
+		dump.Storage[slot] = entry
+	}
+	if it.Err != nil {
+		utils.Fatalf("Failed to iterate storage: %v", it.Err)
+	}
+	out, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
@@ -63,6 +63,8 @@ var (
 		utils.BootnodesV5Flag,
 		utils.DataDirFlag,
 		utils.AncientFlag,
+		utils.AncientCompressFlag,
+		utils.DBEngineFlag,
 		utils.KeyStoreDirFlag,
 		utils.ExternalSignerFlag,
 		utils.NoUSBFlag,
@@ -81,6 +83,8 @@ var (
 		utils.TxPoolNoLocalsFlag,
 		utils.TxPoolJournalFlag,
 		utils.TxPoolRejournalFlag,
+		utils.TxPoolRemoteJournalFlag,
+		utils.TxPoolRemoteJournalSizeFlag,
 		utils.TxPoolPriceLimitFlag,
 		utils.TxPoolPriceBumpFlag,
 		utils.TxPoolAccountSlotsFlag,
@@ -106,6 +110,8 @@ var (
 		utils.CacheTrieFlag,
 		utils.CacheGCFlag,
 		utils.CacheNoPrefetchFlag,
+		utils.CacheSnapshotFlag,
+		utils.SnapshotFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
 		utils.MaxPendingPeersFlag,
@@ -154,6 +160,7 @@ var (
 		utils.RPCPortFlag,
 		utils.RPCCORSDomainFlag,
 		utils.RPCVirtualHostsFlag,
+		utils.RPCMultiplexFlag,
 		utils.GraphQLEnabledFlag,
 		utils.GraphQLListenAddrFlag,
 		utils.GraphQLPortFlag,
@@ -165,10 +172,26 @@ var (
 		utils.WSPortFlag,
 		utils.WSApiFlag,
 		utils.WSAllowedOriginsFlag,
+		utils.WSMaxMessageSizeFlag,
+		utils.WSCompressionFlag,
+		utils.WSPingIntervalFlag,
+		utils.RPCAuthSecretFlag,
+		utils.RPCAuthStaticFlag,
+		utils.RPCAccessPolicyFlag,
+		utils.RPCBatchLimitFlag,
+		utils.RPCConnLimitFlag,
+		utils.RPCRateLimitFlag,
+		utils.RPCRateBurstFlag,
+		utils.RPCMethodCostsFlag,
+		utils.RPCAccessLogFlag,
+		utils.RPCAccessLogRedactFlag,
+		utils.RPCSlowThresholdFlag,
 		utils.IPCDisabledFlag,
 		utils.IPCPathFlag,
 		utils.InsecureUnlockAllowedFlag,
 		utils.RPCGlobalGasCap,
+		utils.RPCLogsRangeFlag,
+		utils.RPCLogsCapFlag,
 	}
 
 	whisperFlags = []cli.Flag{
@@ -202,10 +225,14 @@ func init() {
 		exportCommand,
 		importPreimagesCommand,
 		exportPreimagesCommand,
+		exportAncientsCommand,
+		importAncientsCommand,
 		copydbCommand,
 		removedbCommand,
 		dumpCommand,
 		inspectCommand,
+		pruneStateCommand,
+		dbCommand,
 		// See accountcmd.go:
 		accountCommand,
 		walletCommand,
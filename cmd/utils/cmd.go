@@ -312,3 +312,93 @@ func ExportPreimages(db ethdb.Database, fn string) error {
 	log.Info("Exported preimages", "file", fn)
 	return nil
 }
+
+// ExportAncients exports the ancient chain items in the range [first, last] into
+// an archive file, which can be imported into the freezer of another node.
+func ExportAncients(db ethdb.Database, fn string, first uint64, last uint64) error {
+	log.Info("Exporting ancient chain segment", "file", fn, "first", first, "last", last)
+
+	// Open the file handle and potentially wrap with a gzip stream
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var writer io.Writer = fh
+	if strings.HasSuffix(fn, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	if err := rawdb.ExportAncients(db, writer, first, last); err != nil {
+		return err
+	}
+	log.Info("Exported ancient chain segment", "file", fn)
+	return nil
+}
+
+// ImportAncients imports an archive of ancient chain items into the freezer.
+func ImportAncients(db ethdb.Database, fn string) error {
+	log.Info("Importing ancient chain segment", "file", fn)
+
+	// Open the file handle and potentially unwrap the gzip stream
+	fh, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var reader io.Reader = fh
+	if strings.HasSuffix(fn, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return err
+		}
+	}
+	first, count, err := rawdb.ImportAncients(db, reader)
+	if err != nil {
+		return err
+	}
+	log.Info("Imported ancient chain segment", "file", fn, "first", first, "last", first+count-1)
+	return nil
+}
+
+// RestoreFreezer replaces the items of the freezer at the given path with the
+// ones of an ancient chain segment archive.
+func RestoreFreezer(path string, fn string) error {
+	log.Info("Restoring ancient chain segment", "file", fn)
+
+	// The archive is read twice, open the file handle and potentially unwrap the
+	// gzip stream on each pass
+	open := func() (io.ReadCloser, error) {
+		fh, err := os.Open(fn)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasSuffix(fn, ".gz") {
+			return fh, nil
+		}
+		reader, err := gzip.NewReader(fh)
+		if err != nil {
+			fh.Close()
+			return nil, err
+		}
+		return &gzipFile{Reader: reader, file: fh}, nil
+	}
+	first, count, err := rawdb.RestoreFreezer(path, open)
+	if err != nil {
+		return err
+	}
+	log.Info("Restored ancient chain segment", "file", fn, "first", first, "last", first+count-1)
+	return nil
+}
+
+// gzipFile is a gzip stream read from a file, closing both when done.
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (f *gzipFile) Close() error {
+	f.Reader.Close()
+	return f.file.Close()
+}
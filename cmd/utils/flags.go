@@ -37,6 +37,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/dashboard"
@@ -122,6 +123,14 @@ var (
 		Name:  "datadir.ancient",
 		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
 	}
+	AncientCompressFlag = cli.BoolFlag{
+		Name:  "datadir.ancient.compress",
+		Usage: "Compress all newly created ancient tables, including hashes and difficulties",
+	}
+	DBEngineFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: "Backing database engine for new databases (leveldb, badger) (default = existing engine or leveldb)",
+	}
 	KeyStoreDirFlag = DirectoryFlag{
 		Name:  "keystore",
 		Usage: "Directory for the keystore (default = inside the datadir)",
@@ -298,9 +307,19 @@ var (
 	}
 	TxPoolRejournalFlag = cli.DurationFlag{
 		Name:  "txpool.rejournal",
-		Usage: "Time interval to regenerate the local transaction journal",
+		Usage: "Time interval to regenerate the local and remote transaction journals",
 		Value: core.DefaultTxPoolConfig.Rejournal,
 	}
+	TxPoolRemoteJournalFlag = cli.StringFlag{
+		Name:  "txpool.remotejournal",
+		Usage: "Disk snapshot of remote transactions to survive node restarts (disabled if empty)",
+		Value: core.DefaultTxPoolConfig.RemoteJournal,
+	}
+	TxPoolRemoteJournalSizeFlag = cli.Uint64Flag{
+		Name:  "txpool.remotejournalsize",
+		Usage: "Maximum total size of the transactions in the remote transaction snapshot in bytes",
+		Value: core.DefaultTxPoolConfig.RemoteJournalSize,
+	}
 	TxPoolPriceLimitFlag = cli.Uint64Flag{
 		Name:  "txpool.pricelimit",
 		Usage: "Minimum gas price limit to enforce for acceptance into the pool",
@@ -361,6 +380,25 @@ var (
 		Name:  "cache.noprefetch",
 		Usage: "Disable heuristic state prefetch during block import (less CPU and disk IO, more time waiting for data)",
 	}
+	CacheSnapshotFlag = cli.IntFlag{
+		Name:  "cache.snapshot",
+		Usage: "Percentage of cache memory allowance to use for the state snapshot (requires --snapshot)",
+		Value: 10,
+	}
+	SnapshotFlag = cli.BoolFlag{
+		Name:  "snapshot",
+		Usage: "Maintain a flat state snapshot for faster account and storage access",
+	}
+	PruneRecentFlag = cli.Uint64Flag{
+		Name:  "prune.recent",
+		Usage: "Number of recent block states to retain when pruning the state",
+		Value: 128,
+	}
+	PruneBloomSizeFlag = cli.Uint64Flag{
+		Name:  "prune.bloomsize",
+		Usage: "Megabytes of memory allocated to the bloom filter marking the retained state",
+		Value: 2048,
+	}
 	// Miner settings
 	MiningEnabledFlag = cli.BoolFlag{
 		Name:  "mine",
@@ -460,6 +498,14 @@ var (
 		Name:  "rpc.gascap",
 		Usage: "Sets a cap on gas that can be used in eth_call/estimateGas",
 	}
+	RPCLogsRangeFlag = cli.Uint64Flag{
+		Name:  "rpc.logsrange",
+		Usage: "Maximum number of blocks a single eth_getLogs query may span (0 = unlimited)",
+	}
+	RPCLogsCapFlag = cli.IntFlag{
+		Name:  "rpc.logscap",
+		Usage: "Maximum number of logs returned by a single eth_getLogs query (0 = unlimited)",
+	}
 	// Logging and debug settings
 	EthStatsURLFlag = cli.StringFlag{
 		Name:  "ethstats",
@@ -522,6 +568,10 @@ var (
 		Usage: "Comma separated list of virtual hostnames from which to accept requests (server enforced). Accepts '*' wildcard.",
 		Value: strings.Join(node.DefaultConfig.HTTPVirtualHosts, ","),
 	}
+	RPCMultiplexFlag = cli.BoolFlag{
+		Name:  "rpc.multiplex",
+		Usage: "Serve the WS-RPC and GraphQL interfaces on the HTTP-RPC port instead of their own",
+	}
 	RPCApiFlag = cli.StringFlag{
 		Name:  "rpcapi",
 		Usage: "API's offered over the HTTP-RPC interface",
@@ -559,6 +609,67 @@ var (
 		Usage: "Origins from which to accept websockets requests",
 		Value: "",
 	}
+	WSMaxMessageSizeFlag = cli.Int64Flag{
+		Name:  "ws.maxmessagesize",
+		Usage: "Maximum size of WS-RPC messages accepted from clients in bytes (0 = default)",
+	}
+	WSCompressionFlag = cli.BoolFlag{
+		Name:  "ws.compression",
+		Usage: "Enable permessage-deflate compression of WS-RPC connections",
+	}
+	WSPingIntervalFlag = cli.DurationFlag{
+		Name:  "ws.pinginterval",
+		Usage: "Interval of keepalive pings sent on idle WS-RPC connections (0 = default)",
+	}
+	RPCAuthSecretFlag = cli.StringFlag{
+		Name:  "rpc.authsecret",
+		Usage: "Path to a hex encoded secret for authenticating HTTP-RPC and WS-RPC requests (generated if missing)",
+		Value: "",
+	}
+	RPCAuthStaticFlag = cli.BoolFlag{
+		Name:  "rpc.authstatic",
+		Usage: "Accept the authentication secret as a static bearer token instead of requiring HS256 JWTs",
+	}
+	RPCAccessPolicyFlag = cli.StringFlag{
+		Name:  "rpc.accesspolicy",
+		Usage: "Path to a JSON file with per method access rules for the IPC, HTTP-RPC and WS-RPC interfaces",
+		Value: "",
+	}
+	RPCBatchLimitFlag = cli.IntFlag{
+		Name:  "rpc.batchlimit",
+		Usage: "Maximum number of requests in a JSON-RPC batch (0 = unlimited)",
+	}
+	RPCConnLimitFlag = cli.IntFlag{
+		Name:  "rpc.connlimit",
+		Usage: "Maximum number of concurrently executing requests per IPC or WebSocket connection (0 = unlimited)",
+	}
+	RPCRateLimitFlag = cli.Float64Flag{
+		Name:  "rpc.ratelimit",
+		Usage: "Request cost allowed per second for every remote HTTP-RPC and WS-RPC host (0 = unlimited)",
+	}
+	RPCRateBurstFlag = cli.Float64Flag{
+		Name:  "rpc.rateburst",
+		Usage: "Maximum request cost a remote host may accumulate (defaults to the rate limit)",
+	}
+	RPCMethodCostsFlag = cli.StringFlag{
+		Name:  "rpc.methodcosts",
+		Usage: "Comma separated rate limit costs of RPC methods or modules, others costing 1 (e.g. eth_getLogs=10,debug_*=50)",
+		Value: "",
+	}
+	RPCAccessLogFlag = cli.StringFlag{
+		Name:  "rpc.accesslog",
+		Usage: "Path of a file to append a JSON record of every served IPC, HTTP-RPC and WS-RPC call to",
+		Value: "",
+	}
+	RPCAccessLogRedactFlag = cli.StringFlag{
+		Name:  "rpc.accesslog.redact",
+		Usage: "Comma separated RPC methods or modules whose parameters are not recorded in the access log, besides personal_* (e.g. eth_sendRawTransaction,admin_*)",
+		Value: "",
+	}
+	RPCSlowThresholdFlag = cli.DurationFlag{
+		Name:  "rpc.slowthreshold",
+		Usage: "Duration above which RPC calls are reported as slow (0 = disabled)",
+	}
 	ExecFlag = cli.StringFlag{
 		Name:  "exec",
 		Usage: "Execute JavaScript statement",
@@ -887,6 +998,9 @@ func setHTTP(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(RPCVirtualHostsFlag.Name) {
 		cfg.HTTPVirtualHosts = splitAndTrim(ctx.GlobalString(RPCVirtualHostsFlag.Name))
 	}
+	if ctx.GlobalIsSet(RPCMultiplexFlag.Name) {
+		cfg.HTTPMultiplex = ctx.GlobalBool(RPCMultiplexFlag.Name)
+	}
 }
 
 // setGraphQL creates the GraphQL listener interface string from the set
@@ -926,6 +1040,73 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(WSApiFlag.Name) {
 		cfg.WSModules = splitAndTrim(ctx.GlobalString(WSApiFlag.Name))
 	}
+	if ctx.GlobalIsSet(WSMaxMessageSizeFlag.Name) {
+		cfg.WSConfig.MessageLimit = ctx.GlobalInt64(WSMaxMessageSizeFlag.Name)
+	}
+	if ctx.GlobalIsSet(WSCompressionFlag.Name) {
+		cfg.WSConfig.Compression = ctx.GlobalBool(WSCompressionFlag.Name)
+	}
+	if ctx.GlobalIsSet(WSPingIntervalFlag.Name) {
+		cfg.WSConfig.PingInterval = ctx.GlobalDuration(WSPingIntervalFlag.Name)
+	}
+}
+
+// setRPCAuth configures the authentication of the HTTP and WebSocket RPC
+// endpoints and the access policy of all RPC endpoints from the set command
+// line flags.
+func setRPCAuth(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(RPCAuthSecretFlag.Name) {
+		cfg.AuthSecretFile = ctx.GlobalString(RPCAuthSecretFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCAuthStaticFlag.Name) {
+		cfg.AuthStaticToken = ctx.GlobalBool(RPCAuthStaticFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCAccessPolicyFlag.Name) {
+		cfg.RPCAccessPolicy = ctx.GlobalString(RPCAccessPolicyFlag.Name)
+	}
+}
+
+// setRPCLimits applies the RPC request budget flags to the config.
+func setRPCLimits(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(RPCBatchLimitFlag.Name) {
+		cfg.RPCLimits.BatchLimit = ctx.GlobalInt(RPCBatchLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCConnLimitFlag.Name) {
+		cfg.RPCLimits.ConnLimit = ctx.GlobalInt(RPCConnLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCRateLimitFlag.Name) {
+		cfg.RPCLimits.Rate = ctx.GlobalFloat64(RPCRateLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCRateBurstFlag.Name) {
+		cfg.RPCLimits.Burst = ctx.GlobalFloat64(RPCRateBurstFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCMethodCostsFlag.Name) {
+		cfg.RPCLimits.MethodCosts = make(map[string]float64)
+		for _, entry := range splitAndTrim(ctx.GlobalString(RPCMethodCostsFlag.Name)) {
+			parts := strings.Split(entry, "=")
+			if len(parts) != 2 {
+				Fatalf("Invalid RPC method cost entry: %s", entry)
+			}
+			cost, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil {
+				Fatalf("Invalid RPC method cost %s: %v", parts[1], err)
+			}
+			cfg.RPCLimits.MethodCosts[parts[0]] = cost
+		}
+	}
+}
+
+// setRPCAccessLog applies the RPC access log flags to the config.
+func setRPCAccessLog(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(RPCAccessLogFlag.Name) {
+		cfg.RPCAccessLog = ctx.GlobalString(RPCAccessLogFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCAccessLogRedactFlag.Name) {
+		cfg.RPCAccessLogRedact = splitAndTrim(ctx.GlobalString(RPCAccessLogRedactFlag.Name))
+	}
+	if ctx.GlobalIsSet(RPCSlowThresholdFlag.Name) {
+		cfg.RPCSlowThreshold = ctx.GlobalDuration(RPCSlowThresholdFlag.Name)
+	}
 }
 
 // setIPC creates an IPC path configuration from the set command line flags,
@@ -1130,6 +1311,9 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setHTTP(ctx, cfg)
 	setGraphQL(ctx, cfg)
 	setWS(ctx, cfg)
+	setRPCAuth(ctx, cfg)
+	setRPCLimits(ctx, cfg)
+	setRPCAccessLog(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 	setDataDir(ctx, cfg)
 	setSmartCard(ctx, cfg)
@@ -1141,6 +1325,14 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(KeyStoreDirFlag.Name) {
 		cfg.KeyStoreDir = ctx.GlobalString(KeyStoreDirFlag.Name)
 	}
+	if ctx.GlobalIsSet(DBEngineFlag.Name) {
+		switch engine := ctx.GlobalString(DBEngineFlag.Name); engine {
+		case rawdb.DBLeveldb, rawdb.DBBadger:
+			cfg.DBEngine = engine
+		default:
+			Fatalf("--%s must be either '%s' or '%s'", DBEngineFlag.Name, rawdb.DBLeveldb, rawdb.DBBadger)
+		}
+	}
 	if ctx.GlobalIsSet(LightKDFFlag.Name) {
 		cfg.UseLightweightKDF = ctx.GlobalBool(LightKDFFlag.Name)
 	}
@@ -1216,6 +1408,12 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolRejournalFlag.Name) {
 		cfg.Rejournal = ctx.GlobalDuration(TxPoolRejournalFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolRemoteJournalFlag.Name) {
+		cfg.RemoteJournal = ctx.GlobalString(TxPoolRemoteJournalFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolRemoteJournalSizeFlag.Name) {
+		cfg.RemoteJournalSize = ctx.GlobalUint64(TxPoolRemoteJournalSizeFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxPoolPriceLimitFlag.Name) {
 		cfg.PriceLimit = ctx.GlobalUint64(TxPoolPriceLimitFlag.Name)
 	}
@@ -1412,6 +1610,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(AncientFlag.Name) {
 		cfg.DatabaseFreezer = ctx.GlobalString(AncientFlag.Name)
 	}
+	if ctx.GlobalIsSet(AncientCompressFlag.Name) {
+		cfg.DatabaseFreezerCompress = ctx.GlobalBool(AncientCompressFlag.Name)
+	}
 
 	if gcmode := ctx.GlobalString(GCModeFlag.Name); gcmode != "full" && gcmode != "archive" {
 		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
@@ -1425,6 +1626,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cfg.TrieDirtyCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
 	}
+	if ctx.GlobalBool(SnapshotFlag.Name) {
+		cfg.SnapshotCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheSnapshotFlag.Name) / 100
+	}
 	if ctx.GlobalIsSet(DocRootFlag.Name) {
 		cfg.DocRoot = ctx.GlobalString(DocRootFlag.Name)
 	}
@@ -1443,6 +1647,12 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(RPCGlobalGasCap.Name) {
 		cfg.RPCGasCap = new(big.Int).SetUint64(ctx.GlobalUint64(RPCGlobalGasCap.Name))
 	}
+	if ctx.GlobalIsSet(RPCLogsRangeFlag.Name) {
+		cfg.RPCLogsRange = ctx.GlobalUint64(RPCLogsRangeFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCLogsCapFlag.Name) {
+		cfg.RPCLogsCap = ctx.GlobalInt(RPCLogsCapFlag.Name)
+	}
 
 	// Override any default configs for hard coded networks.
 	switch {
@@ -1600,7 +1810,7 @@ func MakeChainDatabase(ctx *cli.Context, stack *node.Node) ethdb.Database {
 	if ctx.GlobalString(SyncModeFlag.Name) == "light" {
 		name = "lightchaindata"
 	}
-	chainDb, err := stack.OpenDatabaseWithFreezer(name, cache, handles, ctx.GlobalString(AncientFlag.Name), "")
+	chainDb, err := stack.OpenDatabaseWithFreezer(name, cache, handles, ctx.GlobalString(AncientFlag.Name), "", ctx.GlobalBool(AncientCompressFlag.Name))
 	if err != nil {
 		Fatalf("Could not open database: %v", err)
 	}
@@ -1662,6 +1872,9 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cache.TrieDirtyLimit = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
 	}
+	if ctx.GlobalBool(SnapshotFlag.Name) {
+		cache.SnapshotLimit = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheSnapshotFlag.Name) / 100
+	}
 	vmcfg := vm.Config{EnablePreimageRecording: ctx.GlobalBool(VMEnableDebugFlag.Name)}
 	chain, err = core.NewBlockChain(chainDb, cache, config, engine, vmcfg, nil)
 	if err != nil {
@@ -21,10 +21,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/badger"
 	"github.com/ethereum/go-ethereum/ethdb/leveldb"
 	"github.com/ethereum/go-ethereum/ethdb/memorydb"
 	"github.com/ethereum/go-ethereum/log"
@@ -103,10 +105,10 @@ func NewDatabase(db ethdb.KeyValueStore) ethdb.Database {
 
 // NewDatabaseWithFreezer creates a high level database on top of a given key-
 // value data store with a freezer moving immutable chain segments into cold
-// storage.
-func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace string) (ethdb.Database, error) {
+// storage. If compress is set, all newly created freezer tables are compressed.
+func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace string, compress bool) (ethdb.Database, error) {
 	// Create the idle freezer instance
-	frdb, err := newFreezer(freezer, namespace)
+	frdb, err := newFreezer(freezer, namespace, compress)
 	if err != nil {
 		return nil, err
 	}
@@ -194,24 +196,88 @@ func NewMemoryDatabaseWithCap(size int) ethdb.Database {
 	return NewDatabase(memorydb.NewWithCap(size))
 }
 
-// NewLevelDBDatabase creates a persistent key-value database without a freezer
-// moving immutable chain segments into cold storage.
-func NewLevelDBDatabase(file string, cache int, handles int, namespace string) (ethdb.Database, error) {
-	db, err := leveldb.New(file, cache, handles, namespace)
+const (
+	// DBLeveldb is the name of the LevelDB key-value store engine.
+	DBLeveldb = "leveldb"
+
+	// DBBadger is the name of the Badger key-value store engine.
+	DBBadger = "badger"
+)
+
+// PreexistingDatabase checks the given data directory whether a database is
+// already present, returning the name of its key-value store engine. An empty
+// string is returned if no database can be found.
+func PreexistingDatabase(file string) string {
+	if common.FileExist(filepath.Join(file, "CURRENT")) {
+		return DBLeveldb
+	}
+	if common.FileExist(filepath.Join(file, "MANIFEST")) {
+		return DBBadger
+	}
+	return ""
+}
+
+// NewKeyValueStore opens a persistent key-value store with the given engine. If
+// the engine is empty, the engine of a preexisting database is used, defaulting
+// to LevelDB for new ones. The engine is recorded in the database on creation,
+// and opening it later with a different engine is refused.
+func NewKeyValueStore(engine string, file string, cache int, handles int, namespace string) (ethdb.KeyValueStore, error) {
+	existing := PreexistingDatabase(file)
+	switch {
+	case engine == "" && existing == "":
+		engine = DBLeveldb
+	case engine == "":
+		engine = existing
+	case existing != "" && existing != engine:
+		return nil, fmt.Errorf("database engine mismatch: requested %s, database at %s uses %s", engine, file, existing)
+	}
+	var (
+		kvdb ethdb.KeyValueStore
+		err  error
+	)
+	switch engine {
+	case DBLeveldb:
+		log.Info("Using LevelDB as the backing database")
+		kvdb, err = leveldb.New(file, cache, handles, namespace)
+	case DBBadger:
+		log.Info("Using Badger as the backing database")
+		kvdb, err = badger.New(file, namespace)
+	default:
+		return nil, fmt.Errorf("unknown database engine %q", engine)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch recorded := ReadDatabaseEngine(kvdb); recorded {
+	case "":
+		WriteDatabaseEngine(kvdb, engine)
+	case engine:
+	default:
+		kvdb.Close()
+		return nil, fmt.Errorf("database engine mismatch: requested %s, database at %s was created with %s", engine, file, recorded)
+	}
+	return kvdb, nil
+}
+
+// NewDiskDatabase creates a persistent key-value database with the given engine
+// without a freezer moving immutable chain segments into cold storage.
+func NewDiskDatabase(engine string, file string, cache int, handles int, namespace string) (ethdb.Database, error) {
+	db, err := NewKeyValueStore(engine, file, cache, handles, namespace)
 	if err != nil {
 		return nil, err
 	}
 	return NewDatabase(db), nil
 }
 
-// NewLevelDBDatabaseWithFreezer creates a persistent key-value database with a
-// freezer moving immutable chain segments into cold storage.
-func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer string, namespace string) (ethdb.Database, error) {
-	kvdb, err := leveldb.New(file, cache, handles, namespace)
+// NewDiskDatabaseWithFreezer creates a persistent key-value database with the
+// given engine and a freezer moving immutable chain segments into cold storage.
+// If compress is set, all newly created freezer tables are compressed.
+func NewDiskDatabaseWithFreezer(engine string, file string, cache int, handles int, freezer string, namespace string, compress bool) (ethdb.Database, error) {
+	kvdb, err := NewKeyValueStore(engine, file, cache, handles, namespace)
 	if err != nil {
 		return nil, err
 	}
-	frdb, err := NewDatabaseWithFreezer(kvdb, freezer, namespace)
+	frdb, err := NewDatabaseWithFreezer(kvdb, freezer, namespace, compress)
 	if err != nil {
 		kvdb.Close()
 		return nil, err
@@ -219,6 +285,18 @@ func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer
 	return frdb, nil
 }
 
+// NewLevelDBDatabase creates a persistent key-value database without a freezer
+// moving immutable chain segments into cold storage.
+func NewLevelDBDatabase(file string, cache int, handles int, namespace string) (ethdb.Database, error) {
+	return NewDiskDatabase(DBLeveldb, file, cache, handles, namespace)
+}
+
+// NewLevelDBDatabaseWithFreezer creates a persistent key-value database with a
+// freezer moving immutable chain segments into cold storage.
+func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer string, namespace string) (ethdb.Database, error) {
+	return NewDiskDatabaseWithFreezer(DBLeveldb, file, cache, handles, freezer, namespace, false)
+}
+
 // InspectDatabase traverses the entire database and checks the size
 // of all different categories of data.
 func InspectDatabase(db ethdb.Database) error {
@@ -295,7 +373,7 @@ func InspectDatabase(db ethdb.Database) error {
 			trieSize += size
 		default:
 			var accounted bool
-			for _, meta := range [][]byte{databaseVerisionKey, headHeaderKey, headBlockKey, headFastBlockKey, fastTrieProgressKey} {
+			for _, meta := range [][]byte{databaseVerisionKey, databaseEngineKey, headHeaderKey, headBlockKey, headFastBlockKey, fastTrieProgressKey} {
 				if bytes.Equal(key, meta) {
 					metadata += size
 					accounted = true
@@ -0,0 +1,72 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package rawdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that the key-value store engine of a database is recorded on creation,
+// detected when reopening and that mismatching engines are rejected.
+func TestDatabaseEngine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "database-engine")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, engine := range []string{DBLeveldb, DBBadger} {
+		path := filepath.Join(dir, engine)
+
+		db, err := NewKeyValueStore(engine, path, 16, 16, "")
+		if err != nil {
+			t.Fatalf("%s: failed to create database: %v", engine, err)
+		}
+		if recorded := ReadDatabaseEngine(db); recorded != engine {
+			t.Errorf("%s: recorded engine mismatch: have %q", engine, recorded)
+		}
+		db.Close()
+
+		if have := PreexistingDatabase(path); have != engine {
+			t.Errorf("%s: detected engine mismatch: have %q", engine, have)
+		}
+		// Reopening without an explicit engine should use the existing one
+		db, err = NewKeyValueStore("", path, 16, 16, "")
+		if err != nil {
+			t.Fatalf("%s: failed to reopen database: %v", engine, err)
+		}
+		db.Close()
+
+		// Reopening with a different engine should be refused
+		other := DBBadger
+		if engine == DBBadger {
+			other = DBLeveldb
+		}
+		if db, err := NewKeyValueStore(other, path, 16, 16, ""); err == nil {
+			db.Close()
+			t.Errorf("%s: database opened with mismatching engine %s", engine, other)
+		}
+	}
+	if have := PreexistingDatabase(filepath.Join(dir, "missing")); have != "" {
+		t.Errorf("missing database detected as %q", have)
+	}
+	if _, err := NewKeyValueStore("unknown", filepath.Join(dir, "unknown"), 16, 16, ""); err == nil {
+		t.Errorf("database opened with unknown engine")
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/bitutil"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// errInvalidEntry is returned if the value of a well-known database entry can't be
+// interpreted according to its schema.
+var errInvalidEntry = errors.New("invalid database entry")
+
+// DecodeEntry interprets a raw key-value store entry according to the database
+// schema. It returns the kind of the entry along with its content in a form that
+// is suitable for JSON encoding. Entries which don't belong to any well-known
+// kind are reported as "unknown" with their raw value.
+func DecodeEntry(key, value []byte) (string, interface{}, error) {
+	switch {
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == len(headerPrefix)+8+common.HashLength+len(headerTDSuffix) && bytes.HasSuffix(key, headerTDSuffix):
+		td := new(big.Int)
+		if err := rlp.DecodeBytes(value, td); err != nil {
+			return "", nil, err
+		}
+		return "total difficulty", map[string]interface{}{
+			"number":          hexutil.Uint64(binary.BigEndian.Uint64(key[1:9])),
+			"hash":            common.BytesToHash(key[9:41]),
+			"totalDifficulty": (*hexutil.Big)(td),
+		}, nil
+
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == len(headerPrefix)+8+len(headerHashSuffix) && bytes.HasSuffix(key, headerHashSuffix):
+		return "canonical hash", map[string]interface{}{
+			"number": hexutil.Uint64(binary.BigEndian.Uint64(key[1:9])),
+			"hash":   common.BytesToHash(value),
+		}, nil
+
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == len(headerPrefix)+8+common.HashLength:
+		header := new(types.Header)
+		if err := rlp.DecodeBytes(value, header); err != nil {
+			return "", nil, err
+		}
+		return "header", header, nil
+
+	case bytes.HasPrefix(key, headerNumberPrefix) && len(key) == len(headerNumberPrefix)+common.HashLength:
+		if len(value) != 8 {
+			return "", nil, errInvalidEntry
+		}
+		return "header number", map[string]interface{}{
+			"hash":   common.BytesToHash(key[1:]),
+			"number": hexutil.Uint64(binary.BigEndian.Uint64(value)),
+		}, nil
+
+	case bytes.HasPrefix(key, blockBodyPrefix) && len(key) == len(blockBodyPrefix)+8+common.HashLength:
+		body := new(types.Body)
+		if err := rlp.DecodeBytes(value, body); err != nil {
+			return "", nil, err
+		}
+		return "body", map[string]interface{}{
+			"number":       hexutil.Uint64(binary.BigEndian.Uint64(key[1:9])),
+			"hash":         common.BytesToHash(key[9:]),
+			"transactions": body.Transactions,
+			"uncles":       body.Uncles,
+		}, nil
+
+	case bytes.HasPrefix(key, blockReceiptsPrefix) && len(key) == len(blockReceiptsPrefix)+8+common.HashLength:
+		var storageReceipts []*types.ReceiptForStorage
+		if err := rlp.DecodeBytes(value, &storageReceipts); err != nil {
+			return "", nil, err
+		}
+		receipts := make([]*types.Receipt, len(storageReceipts))
+		for i, receipt := range storageReceipts {
+			receipts[i] = (*types.Receipt)(receipt)
+		}
+		return "receipts", map[string]interface{}{
+			"number":   hexutil.Uint64(binary.BigEndian.Uint64(key[1:9])),
+			"hash":     common.BytesToHash(key[9:]),
+			"receipts": receipts,
+		}, nil
+
+	case bytes.HasPrefix(key, txLookupPrefix) && len(key) == len(txLookupPrefix)+common.HashLength:
+		entry := map[string]interface{}{"transaction": common.BytesToHash(key[1:])}
+		switch {
+		case len(value) < common.HashLength:
+			entry["number"] = hexutil.Uint64(new(big.Int).SetBytes(value).Uint64())
+		case len(value) == common.HashLength:
+			entry["blockHash"] = common.BytesToHash(value)
+		default:
+			var legacy LegacyTxLookupEntry
+			if err := rlp.DecodeBytes(value, &legacy); err != nil {
+				return "", nil, err
+			}
+			entry["blockHash"] = legacy.BlockHash
+			entry["number"] = hexutil.Uint64(legacy.BlockIndex)
+			entry["index"] = hexutil.Uint64(legacy.Index)
+		}
+		return "transaction lookup", entry, nil
+
+	case bytes.HasPrefix(key, bloomBitsPrefix) && len(key) == len(bloomBitsPrefix)+10+common.HashLength:
+		entry := map[string]interface{}{
+			"bit":     binary.BigEndian.Uint16(key[1:3]),
+			"section": hexutil.Uint64(binary.BigEndian.Uint64(key[3:11])),
+			"head":    common.BytesToHash(key[11:]),
+		}
+		// Sections of the light client are larger, keep their bits compressed
+		if bits, err := bitutil.DecompressBytes(value, int(params.BloomBitsBlocks)/8); err == nil {
+			entry["bits"] = hexutil.Bytes(bits)
+		} else {
+			entry["compressedBits"] = hexutil.Bytes(value)
+		}
+		return "bloom bits", entry, nil
+
+	case bytes.HasPrefix(key, preimagePrefix) && len(key) == len(preimagePrefix)+common.HashLength:
+		return "preimage", map[string]interface{}{
+			"hash":     common.BytesToHash(key[len(preimagePrefix):]),
+			"preimage": hexutil.Bytes(value),
+		}, nil
+
+	case bytes.HasPrefix(key, configPrefix) && len(key) == len(configPrefix)+common.HashLength:
+		config := new(params.ChainConfig)
+		if err := json.Unmarshal(value, config); err != nil {
+			return "", nil, err
+		}
+		return "chain config", config, nil
+
+	case bytes.Equal(key, headHeaderKey), bytes.Equal(key, headBlockKey), bytes.Equal(key, headFastBlockKey), bytes.Equal(key, snapshotRootKey):
+		if len(value) != common.HashLength {
+			return "", nil, errInvalidEntry
+		}
+		return "head marker", common.BytesToHash(value), nil
+
+	case bytes.Equal(key, databaseVerisionKey):
+		var version uint64
+		if err := rlp.DecodeBytes(value, &version); err != nil {
+			return "", nil, err
+		}
+		return "database version", version, nil
+
+	case bytes.Equal(key, databaseEngineKey):
+		return "database engine", string(value), nil
+
+	case bytes.Equal(key, fastTrieProgressKey):
+		return "fast trie progress", new(big.Int).SetBytes(value).Uint64(), nil
+
+	case len(key) == common.HashLength:
+		return "trie node or code", hexutil.Bytes(value), nil
+	}
+	return "unknown", hexutil.Bytes(value), nil
+}
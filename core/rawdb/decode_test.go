@@ -0,0 +1,98 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/bitutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that every well-known database entry is decoded into its kind and can
+// be encoded into JSON.
+func TestDecodeEntry(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	tx := types.NewTransaction(1, common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	receipts := []*types.Receipt{types.NewReceipt(nil, false, 21000)}
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1)}, []*types.Transaction{tx}, nil, receipts)
+
+	WriteBlock(db, block)
+	WriteCanonicalHash(db, block.Hash(), 1)
+	WriteTd(db, block.Hash(), 1, big.NewInt(2))
+	WriteReceipts(db, block.Hash(), 1, receipts)
+	WriteTxLookupEntries(db, block)
+	WriteBloomBits(db, 3, 0, block.Hash(), bitutil.CompressBytes(make([]byte, params.BloomBitsBlocks/8)))
+	WritePreimages(db, map[common.Hash][]byte{crypto.Keccak256Hash([]byte{0x01}): {0x01}})
+	WriteChainConfig(db, block.Hash(), params.TestChainConfig)
+	WriteHeadHeaderHash(db, block.Hash())
+	WriteDatabaseVersion(db, 7)
+	WriteDatabaseEngine(db, DBLeveldb)
+	db.Put(make([]byte, common.HashLength), []byte{0xc0})
+	db.Put([]byte("custom"), []byte{0x01})
+
+	want := map[string]int{
+		"header":             1,
+		"body":               1,
+		"header number":      1,
+		"canonical hash":     1,
+		"total difficulty":   1,
+		"receipts":           1,
+		"transaction lookup": 1,
+		"bloom bits":         1,
+		"preimage":           1,
+		"chain config":       1,
+		"head marker":        1,
+		"database version":   1,
+		"database engine":    1,
+		"trie node or code":  1,
+		"unknown":            1,
+	}
+	have := make(map[string]int)
+
+	it := db.NewIterator()
+	defer it.Release()
+	for it.Next() {
+		kind, value, err := DecodeEntry(it.Key(), it.Value())
+		if err != nil {
+			t.Errorf("failed to decode entry %x: %v", it.Key(), err)
+			continue
+		}
+		if _, err := json.Marshal(value); err != nil {
+			t.Errorf("failed to encode %s entry %x: %v", kind, it.Key(), err)
+		}
+		have[kind]++
+	}
+	for kind, count := range want {
+		if have[kind] != count {
+			t.Errorf("%s entry count mismatch: have %d, want %d", kind, have[kind], count)
+		}
+	}
+	if len(have) != len(want) {
+		t.Errorf("decoded kinds mismatch: have %v, want %v", have, want)
+	}
+	// Well-known entries with invalid content should be rejected
+	if _, _, err := DecodeEntry(headerKey(1, block.Hash()), []byte{0x01, 0x02}); err == nil {
+		t.Errorf("invalid header decoded")
+	}
+}
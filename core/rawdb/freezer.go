@@ -58,6 +58,23 @@ const (
 	freezerBatchLimit = 30000
 )
 
+// tableNoSnappy decides whether a freezer table should be stored uncompressed,
+// keeping the format of the table if it already exists. If compressAll is set,
+// new tables are compressed even if they store hardly compressible data (hashes
+// and difficulties). Compression can't be changed retroactively, so existing
+// tables always retain their format.
+func tableNoSnappy(datadir string, name string, noSnappy bool, compressAll bool) bool {
+	if compressAll {
+		noSnappy = false
+	}
+	if _, err := os.Stat(filepath.Join(datadir, tableFileName(name, noSnappy, "idx"))); os.IsNotExist(err) {
+		if _, err := os.Stat(filepath.Join(datadir, tableFileName(name, !noSnappy, "idx"))); err == nil {
+			return !noSnappy
+		}
+	}
+	return noSnappy
+}
+
 // freezer is an memory mapped append-only database to store immutable chain data
 // into flat files:
 //
@@ -76,8 +93,15 @@ type freezer struct {
 }
 
 // newFreezer creates a chain freezer that moves ancient chain data into
-// append-only flat file containers.
-func newFreezer(datadir string, namespace string) (*freezer, error) {
+// append-only flat file containers. If compress is set, all newly created tables
+// are snappy compressed, not only the ones storing compressible data.
+func newFreezer(datadir string, namespace string, compress bool) (*freezer, error) {
+	return openFreezer(datadir, namespace, compress, false)
+}
+
+// openFreezer opens a chain freezer. In read only mode none of the tables are
+// created or repaired, inconsistencies are left in place for inspection.
+func openFreezer(datadir string, namespace string, compress bool, readonly bool) (*freezer, error) {
 	// Create the initial freezer object
 	var (
 		readMeter  = metrics.NewRegisteredMeter(namespace+"ancient/read", nil)
@@ -102,7 +126,7 @@ func newFreezer(datadir string, namespace string) (*freezer, error) {
 		instanceLock: lock,
 	}
 	for name, disableSnappy := range freezerNoSnappy {
-		table, err := newTable(datadir, name, readMeter, writeMeter, disableSnappy)
+		table, err := openTable(datadir, name, readMeter, writeMeter, 2*1000*1000*1000, tableNoSnappy(datadir, name, disableSnappy, compress), readonly)
 		if err != nil {
 			for _, table := range freezer.tables {
 				table.Close()
@@ -112,14 +136,16 @@ func newFreezer(datadir string, namespace string) (*freezer, error) {
 		}
 		freezer.tables[name] = table
 	}
-	if err := freezer.repair(); err != nil {
+	if readonly {
+		freezer.frozen = freezer.minItems()
+	} else if err := freezer.repair(); err != nil {
 		for _, table := range freezer.tables {
 			table.Close()
 		}
 		lock.Release()
 		return nil, err
 	}
-	log.Info("Opened ancient database", "database", datadir)
+	log.Info("Opened ancient database", "database", datadir, "readonly", readonly)
 	return freezer, nil
 }
 
@@ -375,13 +401,7 @@ func (f *freezer) freeze(db ethdb.KeyValueStore) {
 
 // repair truncates all data tables to the same length.
 func (f *freezer) repair() error {
-	min := uint64(math.MaxUint64)
-	for _, table := range f.tables {
-		items := atomic.LoadUint64(&table.items)
-		if min > items {
-			min = items
-		}
-	}
+	min := f.minItems()
 	for _, table := range f.tables {
 		if err := table.truncate(min); err != nil {
 			return err
@@ -390,3 +410,15 @@ func (f *freezer) repair() error {
 	atomic.StoreUint64(&f.frozen, min)
 	return nil
 }
+
+// minItems returns the number of items contained in all the data tables.
+func (f *freezer) minItems() uint64 {
+	min := uint64(math.MaxUint64)
+	for _, table := range f.tables {
+		items := atomic.LoadUint64(&table.items)
+		if min > items {
+			min = items
+		}
+	}
+	return min
+}
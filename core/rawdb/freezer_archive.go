@@ -0,0 +1,374 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// ancientArchiveMagic identifies a stream as an ancient chain segment archive.
+	ancientArchiveMagic = "geth-ancients"
+
+	// ancientArchiveVersion is the version of the archive format.
+	ancientArchiveVersion = 1
+)
+
+// ancientArchiveTables is the order in which the items of the freezer tables
+// are stored in an archive.
+var ancientArchiveTables = []string{freezerHashTable, freezerHeaderTable, freezerBodiesTable, freezerReceiptTable, freezerDifficultyTable}
+
+var errArchiveChecksum = errors.New("ancient archive checksum mismatch")
+
+// ancientArchiveHeader describes the contents of an ancient chain segment archive.
+//
+// An archive is a stream of RLP items: the header, followed by one list of table
+// blobs per ancient item in the order given by the header, terminated by the
+// SHA256 checksum of all preceding bytes.
+type ancientArchiveHeader struct {
+	Magic   string
+	Version uint64
+	Tables  []string // Names of the freezer tables each item contains a blob of
+	First   uint64   // Number of the first ancient item in the archive
+	Count   uint64   // Number of ancient items in the archive
+}
+
+// ExportAncients writes the ancient items in the range [first, last] into an
+// archive that can be imported into the freezer of another node.
+func ExportAncients(db ethdb.AncientReader, w io.Writer, first, last uint64) error {
+	frozen, err := db.Ancients()
+	if err != nil {
+		return err
+	}
+	if first > last || last >= frozen {
+		return fmt.Errorf("invalid ancient range [%d, %d], %d items available", first, last, frozen)
+	}
+	var (
+		hasher = sha256.New()
+		out    = io.MultiWriter(w, hasher)
+		start  = time.Now()
+		logged = time.Now()
+	)
+	header := &ancientArchiveHeader{
+		Magic:   ancientArchiveMagic,
+		Version: ancientArchiveVersion,
+		Tables:  ancientArchiveTables,
+		First:   first,
+		Count:   last - first + 1,
+	}
+	if err := rlp.Encode(out, header); err != nil {
+		return err
+	}
+	for number := first; number <= last; number++ {
+		item := make([][]byte, len(ancientArchiveTables))
+		for i, kind := range ancientArchiveTables {
+			if item[i], err = db.Ancient(kind, number); err != nil {
+				return fmt.Errorf("failed to read ancient %s #%d: %v", kind, number, err)
+			}
+		}
+		if err := rlp.Encode(out, item); err != nil {
+			return err
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting ancient items", "number", number, "last", last, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	return rlp.Encode(w, hasher.Sum(nil))
+}
+
+// hashingReader is a buffered reader hashing all the bytes consumed from it. It
+// implements io.ByteReader so the RLP stream doesn't read ahead of the items it
+// decodes.
+type hashingReader struct {
+	r *bufio.Reader
+	h hash.Hash
+}
+
+func (r *hashingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.h.Write(p[:n])
+	return n, err
+}
+
+func (r *hashingReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.h.Write([]byte{b})
+	}
+	return b, err
+}
+
+// ancientArchive is an archive of ancient items being read.
+type ancientArchive struct {
+	input  *hashingReader
+	stream *rlp.Stream
+	header ancientArchiveHeader
+	index  map[string]int // Position of the blob of each freezer table within an item
+}
+
+// openAncientArchive reads and validates the header of an archive.
+func openAncientArchive(r io.Reader) (*ancientArchive, error) {
+	input := &hashingReader{r: bufio.NewReader(r), h: sha256.New()}
+	archive := &ancientArchive{
+		input:  input,
+		stream: rlp.NewStream(input, 0),
+		index:  make(map[string]int),
+	}
+	header := &archive.header
+	if err := archive.stream.Decode(header); err != nil {
+		return nil, fmt.Errorf("invalid ancient archive header: %v", err)
+	}
+	if header.Magic != ancientArchiveMagic {
+		return nil, errors.New("not an ancient archive")
+	}
+	if header.Version != ancientArchiveVersion {
+		return nil, fmt.Errorf("unsupported ancient archive version %d", header.Version)
+	}
+	for i, kind := range header.Tables {
+		archive.index[kind] = i
+	}
+	for _, kind := range ancientArchiveTables {
+		if _, ok := archive.index[kind]; !ok {
+			return nil, fmt.Errorf("ancient archive is missing table %s", kind)
+		}
+	}
+	return archive, nil
+}
+
+// ImportAncients appends the ancient items of an archive to the freezer, which
+// must contain exactly the items preceding the archive's range. Every item is
+// validated against its header and the header chain is checked to be linked to
+// the preceding items. If the import fails, the freezer is truncated back to its
+// original content. The range of imported items is returned.
+func ImportAncients(db ethdb.AncientStore, r io.Reader) (uint64, uint64, error) {
+	archive, err := openAncientArchive(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	return archive.importInto(db)
+}
+
+// importInto appends the items of the archive to the freezer.
+func (a *ancientArchive) importInto(db ethdb.AncientStore) (uint64, uint64, error) {
+	header := a.header
+
+	frozen, err := db.Ancients()
+	if err != nil {
+		return 0, 0, err
+	}
+	if header.First != frozen {
+		return 0, 0, fmt.Errorf("ancient archive starts at #%d, freezer contains %d items", header.First, frozen)
+	}
+	parent, td, err := archiveParent(db, header.First)
+	if err != nil {
+		return 0, 0, err
+	}
+	// Import all the items, rolling back on failure
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	fail := func(err error) (uint64, uint64, error) {
+		if terr := db.TruncateAncients(frozen); terr != nil {
+			log.Error("Failed to roll back ancient import", "err", terr)
+		}
+		return 0, 0, err
+	}
+	for number := header.First; number < header.First+header.Count; number++ {
+		item, err := a.next(number, parent, td)
+		if err != nil {
+			return fail(err)
+		}
+		if err := db.AppendAncient(number, item.hash, item.header, item.body, item.receipts, item.td); err != nil {
+			return fail(err)
+		}
+		parent = common.BytesToHash(item.hash)
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Importing ancient items", "number", number, "last", header.First+header.Count-1, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	// All items imported, ensure the archive wasn't tampered with
+	if err := a.verifyChecksum(); err != nil {
+		return fail(err)
+	}
+	if err := db.Sync(); err != nil {
+		return fail(err)
+	}
+	return header.First, header.Count, nil
+}
+
+// validate reads and validates all the items of the archive against the ancient
+// items preceding it and the checksum of the archive, without importing them.
+func (a *ancientArchive) validate(db ethdb.AncientReader) error {
+	header := a.header
+
+	parent, td, err := archiveParent(db, header.First)
+	if err != nil {
+		return err
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for number := header.First; number < header.First+header.Count; number++ {
+		item, err := a.next(number, parent, td)
+		if err != nil {
+			return err
+		}
+		parent = common.BytesToHash(item.hash)
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Validating ancient items", "number", number, "last", header.First+header.Count-1, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	return a.verifyChecksum()
+}
+
+// ancientItem contains the blobs of a single ancient item read from an archive.
+type ancientItem struct {
+	hash     []byte
+	header   []byte
+	body     []byte
+	receipts []byte
+	td       []byte
+}
+
+// archiveParent retrieves the hash and total difficulty of the ancient item
+// preceding the given one, which the first item of an archive is linked to.
+func archiveParent(db ethdb.AncientReader, first uint64) (common.Hash, *big.Int, error) {
+	td := new(big.Int)
+	if first == 0 {
+		return common.Hash{}, td, nil
+	}
+	blob, err := db.Ancient(freezerHashTable, first-1)
+	if err != nil {
+		return common.Hash{}, nil, err
+	}
+	parent := common.BytesToHash(blob)
+	if blob, err = db.Ancient(freezerDifficultyTable, first-1); err != nil {
+		return common.Hash{}, nil, err
+	}
+	if err := rlp.DecodeBytes(blob, td); err != nil {
+		return common.Hash{}, nil, err
+	}
+	return parent, td, nil
+}
+
+// next reads the next item of the archive and validates it as the child of the
+// given parent. The total difficulty is updated to the one of the item.
+func (a *ancientArchive) next(number uint64, parent common.Hash, td *big.Int) (*ancientItem, error) {
+	var blobs [][]byte
+	if err := a.stream.Decode(&blobs); err != nil {
+		return nil, fmt.Errorf("failed to read ancient #%d: %v", number, err)
+	}
+	if len(blobs) != len(a.header.Tables) {
+		return nil, fmt.Errorf("ancient #%d has %d blobs, want %d", number, len(blobs), len(a.header.Tables))
+	}
+	item := &ancientItem{
+		hash:     blobs[a.index[freezerHashTable]],
+		header:   blobs[a.index[freezerHeaderTable]],
+		body:     blobs[a.index[freezerBodiesTable]],
+		receipts: blobs[a.index[freezerReceiptTable]],
+		td:       blobs[a.index[freezerDifficultyTable]],
+	}
+	if err := validateAncient(number, parent, td, item.hash, item.header, item.body, item.receipts, item.td); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// verifyChecksum reads the checksum terminating the archive and compares it to
+// the one of all the bytes read so far.
+func (a *ancientArchive) verifyChecksum() error {
+	sum := a.input.h.Sum(nil)
+
+	var checksum []byte
+	if err := a.stream.Decode(&checksum); err != nil {
+		return fmt.Errorf("failed to read ancient archive checksum: %v", err)
+	}
+	if !bytes.Equal(checksum, sum) {
+		return errArchiveChecksum
+	}
+	return nil
+}
+
+// validateAncient checks that the blobs of an ancient item belong to the block
+// with the given number and hash, which is the child of the given parent. The
+// total difficulty is updated to the one of the validated item.
+func validateAncient(number uint64, parent common.Hash, td *big.Int, hashBlob, headerBlob, bodyBlob, receiptRLP, tdBlob []byte) error {
+	var header types.Header
+	if err := rlp.DecodeBytes(headerBlob, &header); err != nil {
+		return fmt.Errorf("invalid ancient header #%d: %v", number, err)
+	}
+	hash := header.Hash()
+	if header.Number == nil || header.Number.Uint64() != number {
+		return fmt.Errorf("ancient header number mismatch: have %v, want %d", header.Number, number)
+	}
+	if !bytes.Equal(hashBlob, hash[:]) {
+		return fmt.Errorf("ancient #%d hash mismatch: have %x, want %x", number, hashBlob, hash)
+	}
+	if number > 0 && header.ParentHash != parent {
+		return fmt.Errorf("ancient #%d not linked to parent: have %x, want %x", number, header.ParentHash, parent)
+	}
+	var body types.Body
+	if err := rlp.DecodeBytes(bodyBlob, &body); err != nil {
+		return fmt.Errorf("invalid ancient body #%d: %v", number, err)
+	}
+	if root := types.DeriveSha(types.Transactions(body.Transactions)); root != header.TxHash {
+		return fmt.Errorf("ancient #%d transaction root mismatch: have %x, want %x", number, root, header.TxHash)
+	}
+	if uncles := types.CalcUncleHash(body.Uncles); uncles != header.UncleHash {
+		return fmt.Errorf("ancient #%d uncle hash mismatch: have %x, want %x", number, uncles, header.UncleHash)
+	}
+	var storageReceipts []*types.ReceiptForStorage
+	if err := rlp.DecodeBytes(receiptRLP, &storageReceipts); err != nil {
+		return fmt.Errorf("invalid ancient receipts #%d: %v", number, err)
+	}
+	receipts := make(types.Receipts, len(storageReceipts))
+	for i, receipt := range storageReceipts {
+		receipts[i] = (*types.Receipt)(receipt)
+	}
+	if root := types.DeriveSha(receipts); root != header.ReceiptHash {
+		return fmt.Errorf("ancient #%d receipt root mismatch: have %x, want %x", number, root, header.ReceiptHash)
+	}
+	have := new(big.Int)
+	if err := rlp.DecodeBytes(tdBlob, have); err != nil {
+		return fmt.Errorf("invalid ancient total difficulty #%d: %v", number, err)
+	}
+	if td.Add(td, header.Difficulty); have.Cmp(td) != 0 {
+		return fmt.Errorf("ancient #%d total difficulty mismatch: have %v, want %v", number, have, td)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// newTestFreezer creates a freezer in a temporary directory, returning it along
+// with a cleanup function.
+func newTestFreezer(t *testing.T) (*freezer, func()) {
+	dir, err := ioutil.TempDir("", "freezer-archive")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	f, err := newFreezer(dir, "", false)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	return f, func() {
+		f.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// fillTestFreezer appends a chain of blocks to the freezer, each containing a
+// transaction and its receipt. The extra data distinguishes forks.
+func fillTestFreezer(f *freezer, count int, extra byte) {
+	var (
+		parent common.Hash
+		td     = new(big.Int)
+	)
+	for i := 0; i < count; i++ {
+		header := &types.Header{
+			ParentHash: parent,
+			Number:     big.NewInt(int64(i)),
+			Difficulty: big.NewInt(int64(i) + 1),
+			Extra:      []byte{extra},
+		}
+		var (
+			txs      = []*types.Transaction{types.NewTransaction(uint64(i), common.Address{extra}, big.NewInt(1), 21000, big.NewInt(1), nil)}
+			receipts = []*types.Receipt{types.NewReceipt(nil, false, uint64(21000*(i+1)))}
+		)
+		receipts[0].Logs = []*types.Log{{Address: common.Address{extra}, Data: []byte{byte(i)}}}
+		receipts[0].Bloom = types.CreateBloom(receipts)
+
+		block := types.NewBlock(header, txs, nil, receipts)
+		td.Add(td, block.Difficulty())
+		WriteAncientBlock(f, block, receipts, td)
+		parent = block.Hash()
+	}
+}
+
+// Tests that ancient items exported into an archive can be imported into another
+// freezer, either at once or in consecutive segments.
+func TestAncientArchiveRoundtrip(t *testing.T) {
+	src, cleanSrc := newTestFreezer(t)
+	defer cleanSrc()
+	fillTestFreezer(src, 20, 0)
+
+	dst, cleanDst := newTestFreezer(t)
+	defer cleanDst()
+
+	for _, segment := range [][2]uint64{{0, 9}, {10, 14}, {15, 19}} {
+		archive := new(bytes.Buffer)
+		if err := ExportAncients(src, archive, segment[0], segment[1]); err != nil {
+			t.Fatalf("segment %v: failed to export: %v", segment, err)
+		}
+		first, count, err := ImportAncients(dst, archive)
+		if err != nil {
+			t.Fatalf("segment %v: failed to import: %v", segment, err)
+		}
+		if first != segment[0] || count != segment[1]-segment[0]+1 {
+			t.Fatalf("segment %v: imported range mismatch: have %d+%d", segment, first, count)
+		}
+	}
+	if frozen, _ := dst.Ancients(); frozen != 20 {
+		t.Fatalf("imported item count mismatch: have %d, want %d", frozen, 20)
+	}
+	for number := uint64(0); number < 20; number++ {
+		for _, kind := range ancientArchiveTables {
+			want, _ := src.Ancient(kind, number)
+			if have, _ := dst.Ancient(kind, number); !bytes.Equal(have, want) {
+				t.Errorf("ancient %s #%d mismatch: have %x, want %x", kind, number, have, want)
+			}
+		}
+	}
+}
+
+// Tests that corrupt, unlinked or misplaced archives are rejected without leaving
+// any of their items in the freezer.
+func TestAncientArchiveRejection(t *testing.T) {
+	src, cleanSrc := newTestFreezer(t)
+	defer cleanSrc()
+	fillTestFreezer(src, 10, 0)
+
+	fork, cleanFork := newTestFreezer(t)
+	defer cleanFork()
+	fillTestFreezer(fork, 10, 1)
+
+	dst, cleanDst := newTestFreezer(t)
+	defer cleanDst()
+
+	// Import the first half of the chain to link the rejected archives to
+	archive := new(bytes.Buffer)
+	if err := ExportAncients(src, archive, 0, 4); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	if _, _, err := ImportAncients(dst, archive); err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	// Archive of a different chain not linking to the imported items
+	archive.Reset()
+	if err := ExportAncients(fork, archive, 5, 9); err != nil {
+		t.Fatalf("failed to export fork: %v", err)
+	}
+	if _, _, err := ImportAncients(dst, archive); err == nil {
+		t.Errorf("unlinked archive imported")
+	}
+	// Archive not starting at the end of the freezer
+	archive.Reset()
+	if err := ExportAncients(src, archive, 6, 9); err != nil {
+		t.Fatalf("failed to export gapped segment: %v", err)
+	}
+	if _, _, err := ImportAncients(dst, archive); err == nil {
+		t.Errorf("gapped archive imported")
+	}
+	// Archive with a corrupted checksum
+	archive.Reset()
+	if err := ExportAncients(src, archive, 5, 9); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	corrupt := archive.Bytes()
+	corrupt[len(corrupt)-1] ^= 0xff
+	if _, _, err := ImportAncients(dst, bytes.NewReader(corrupt)); err != errArchiveChecksum {
+		t.Errorf("corrupt archive error mismatch: have %v, want %v", err, errArchiveChecksum)
+	}
+	if frozen, _ := dst.Ancients(); frozen != 5 {
+		t.Fatalf("rejected items retained: have %d items, want %d", frozen, 5)
+	}
+	// Restoring the checksum should make the archive importable
+	corrupt[len(corrupt)-1] ^= 0xff
+	if _, _, err := ImportAncients(dst, bytes.NewReader(corrupt)); err != nil {
+		t.Fatalf("failed to import restored archive: %v", err)
+	}
+	if frozen, _ := dst.Ancients(); frozen != 10 {
+		t.Fatalf("imported item count mismatch: have %d, want %d", frozen, 10)
+	}
+}
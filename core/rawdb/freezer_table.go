@@ -20,10 +20,13 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
@@ -42,8 +45,20 @@ var (
 
 	// errNotSupported is returned if the database doesn't support the required operation.
 	errNotSupported = errors.New("this operation is not supported")
+
+	// errChecksumMismatch is returned if the data of an item retrieved from the
+	// freezer table doesn't match the checksum stored for it.
+	errChecksumMismatch = errors.New("checksum mismatch")
+
+	// errMissingChecksum is returned if an item retrieved from a freezer table
+	// opened in read only mode should have a checksum, but it is missing. Tables
+	// opened for writing serve such items unverified.
+	errMissingChecksum = errors.New("missing checksum")
 )
 
+// checksumTable is the CRC32 polynomial table used to checksum freezer items.
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
 // indexEntry contains the number/id of the file that the data resides in, aswell as the
 // offset within the file to the end of the data
 // In serialized form, the filenum is stored as uint16.
@@ -54,6 +69,16 @@ type indexEntry struct {
 
 const indexEntrySize = 6
 
+const (
+	// checksumHeaderSize is the size of the checksum file header, containing the
+	// first index entry covered by checksums as uint64. Items appended before the
+	// table was checksummed are not covered.
+	checksumHeaderSize = 8
+
+	// checksumSize is the size of the CRC32 checksum stored for every item.
+	checksumSize = 4
+)
+
 // unmarshallBinary deserializes binary b into the rawIndex entry.
 func (i *indexEntry) unmarshalBinary(b []byte) error {
 	i.filenum = uint32(binary.BigEndian.Uint16(b[:2]))
@@ -70,8 +95,9 @@ func (i *indexEntry) marshallBinary() []byte {
 }
 
 // freezerTable represents a single chained data table within the freezer (e.g. blocks).
-// It consists of a data file (snappy encoded arbitrary data blobs) and an indexEntry
-// file (uncompressed 64 bit indices into the data file).
+// It consists of a data file (snappy encoded arbitrary data blobs), an indexEntry
+// file (uncompressed 64 bit indices into the data file) and a checksum file (CRC32
+// checksums of the stored data blobs).
 type freezerTable struct {
 	// WARNING: The `items` field is accessed atomically. On 32 bit platforms, only
 	// 64-bit aligned fields can be atomic. The struct is guaranteed to be so aligned,
@@ -89,6 +115,11 @@ type freezerTable struct {
 	tailId uint32              // number of the earliest file
 	index  *os.File            // File descriptor for the indexEntry file of the table
 
+	checksums *os.File // File descriptor for the checksum file of the table
+	sumStart  uint64   // First item covered by a checksum
+
+	readonly bool // Whether the table is opened for inspection, never modifying it
+
 	// In the case that old items are deleted (from the tail), we use itemOffset
 	// to count how many historic items have gone missing.
 	itemOffset uint32 // Offset (number of discarded items)
@@ -110,25 +141,60 @@ func newTable(path string, name string, readMeter metrics.Meter, writeMeter metr
 // non existent. Both files are truncated to the shortest common length to ensure
 // they don't go out of sync.
 func newCustomTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, maxFilesize uint32, noCompression bool) (*freezerTable, error) {
+	return openTable(path, name, readMeter, writeMeter, maxFilesize, noCompression, false)
+}
+
+// openTable opens a freezer table. In read only mode the table must already
+// exist and none of its files are modified: inconsistencies are not repaired and
+// missing checksums are not padded.
+func openTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, maxFilesize uint32, noCompression bool, readonly bool) (*freezerTable, error) {
+	if readonly {
+		offsets, err := os.Open(filepath.Join(path, tableFileName(name, noCompression, "idx")))
+		if err != nil {
+			return nil, err
+		}
+		// Tables created before checksums were introduced don't have a checksum file
+		checksums, err := os.Open(filepath.Join(path, tableFileName(name, noCompression, "sum")))
+		if err != nil && !os.IsNotExist(err) {
+			offsets.Close()
+			return nil, err
+		}
+		tab := &freezerTable{
+			index:         offsets,
+			checksums:     checksums,
+			files:         make(map[uint32]*os.File),
+			readMeter:     readMeter,
+			writeMeter:    writeMeter,
+			name:          name,
+			path:          path,
+			logger:        log.New("database", path, "table", name),
+			noCompression: noCompression,
+			maxFileSize:   maxFilesize,
+			readonly:      true,
+		}
+		if err := tab.load(); err != nil {
+			tab.Close()
+			return nil, err
+		}
+		return tab, nil
+	}
 	// Ensure the containing directory exists and open the indexEntry file
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return nil, err
 	}
-	var idxName string
-	if noCompression {
-		// raw idx
-		idxName = fmt.Sprintf("%s.ridx", name)
-	} else {
-		// compressed idx
-		idxName = fmt.Sprintf("%s.cidx", name)
+	offsets, err := os.OpenFile(filepath.Join(path, tableFileName(name, noCompression, "idx")), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
 	}
-	offsets, err := os.OpenFile(filepath.Join(path, idxName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	checksums, err := os.OpenFile(filepath.Join(path, tableFileName(name, noCompression, "sum")), os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
+		offsets.Close()
 		return nil, err
 	}
 	// Create the table and repair any past inconsistency
 	tab := &freezerTable{
 		index:         offsets,
+		checksums:     checksums,
 		files:         make(map[uint32]*os.File),
 		readMeter:     readMeter,
 		writeMeter:    writeMeter,
@@ -145,6 +211,15 @@ func newCustomTable(path string, name string, readMeter metrics.Meter, writeMete
 	return tab, nil
 }
 
+// tableFileName returns the name of a non-data file of a freezer table, prefixing
+// the extension with the compression type of the table.
+func tableFileName(name string, noCompression bool, ext string) string {
+	if noCompression {
+		return fmt.Sprintf("%s.r%s", name, ext) // raw table
+	}
+	return fmt.Sprintf("%s.c%s", name, ext) // compressed table
+}
+
 // repair cross checks the head and the index file and truncates them to
 // be in sync with each other after a potential crash / data loss.
 func (t *freezerTable) repair() error {
@@ -251,10 +326,171 @@ func (t *freezerTable) repair() error {
 	if err := t.preopen(); err != nil {
 		return err
 	}
+	// Bring the checksums in sync with the index
+	if err := t.repairChecksums(t.items); err != nil {
+		return err
+	}
 	t.logger.Debug("Chain freezer table opened", "items", t.items, "size", common.StorageSize(t.headBytes))
 	return nil
 }
 
+// load initializes a table opened in read only mode from its index, without
+// cross checking it against the data and checksum files. Any inconsistency is
+// reported when the affected items are retrieved.
+func (t *freezerTable) load() error {
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	offsetsSize := stat.Size() - stat.Size()%indexEntrySize
+	if offsetsSize == 0 {
+		return fmt.Errorf("freezer table %s has an empty index", t.name)
+	}
+	var (
+		buffer     = make([]byte, indexEntrySize)
+		firstIndex indexEntry
+		lastIndex  indexEntry
+	)
+	if _, err := t.index.ReadAt(buffer, 0); err != nil {
+		return err
+	}
+	firstIndex.unmarshalBinary(buffer)
+	if _, err := t.index.ReadAt(buffer, offsetsSize-indexEntrySize); err != nil {
+		return err
+	}
+	lastIndex.unmarshalBinary(buffer)
+
+	t.tailId = firstIndex.offset
+	t.itemOffset = firstIndex.filenum
+	t.items = uint64(t.itemOffset) + uint64(offsetsSize/indexEntrySize-1)
+	t.headId = lastIndex.filenum
+	t.headBytes = lastIndex.offset
+
+	for i := t.tailId; i <= t.headId; i++ {
+		if _, err := t.openFile(i, os.O_RDONLY); err != nil {
+			return err
+		}
+	}
+	t.head = t.files[t.headId]
+
+	// Without a complete checksum header, none of the items are checksummed
+	t.sumStart = t.items
+	if t.checksums == nil {
+		return nil
+	}
+	if stat, err = t.checksums.Stat(); err != nil {
+		return err
+	}
+	if stat.Size() >= checksumHeaderSize {
+		header := make([]byte, checksumHeaderSize)
+		if _, err := t.checksums.ReadAt(header, 0); err != nil {
+			return err
+		}
+		if start := binary.BigEndian.Uint64(header); start < t.items {
+			t.sumStart = start
+		}
+	}
+	return nil
+}
+
+// repairChecksums cross checks the checksum file with the number of items in the
+// table, truncating dangling checksums and padding missing ones with empty entries.
+// The data of items without checksums can't be trusted, so no checksums are minted
+// for them: they are reported as missing on verification instead. If the checksum
+// file was just created, checksumming starts with the next appended item.
+func (t *freezerTable) repairChecksums(items uint64) error {
+	stat, err := t.checksums.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() < checksumHeaderSize {
+		if unchecked := items - uint64(t.itemOffset); unchecked > 0 {
+			t.logger.Info("Enabling checksums on freezer table", "unchecked", unchecked)
+		}
+		return t.resetChecksums(items)
+	}
+	header := make([]byte, checksumHeaderSize)
+	if _, err := t.checksums.ReadAt(header, 0); err != nil {
+		return err
+	}
+	t.sumStart = binary.BigEndian.Uint64(header)
+	if t.sumStart > items {
+		return t.resetChecksums(items)
+	}
+	size, expected := stat.Size(), t.checksumOffset(items)
+	if size > expected {
+		t.logger.Warn("Truncating dangling checksums", "indexed", expected, "stored", size)
+		if err := t.checksums.Truncate(expected); err != nil {
+			return err
+		}
+	}
+	if size < expected {
+		// Checksums are written before the index, so this is not a crash artifact
+		first := t.sumStart + uint64(size-checksumHeaderSize)/checksumSize
+		t.logger.Error("Freezer items missing checksums, unverifiable", "first", first, "last", items-1)
+
+		// Drop any partial entry and pad the gap with empty ones
+		if err := t.checksums.Truncate(t.checksumOffset(first)); err != nil {
+			return err
+		}
+		if err := t.checksums.Truncate(expected); err != nil {
+			return err
+		}
+	}
+	return t.checksums.Sync()
+}
+
+// resetChecksums discards all checksums and starts checksumming at the given item.
+func (t *freezerTable) resetChecksums(first uint64) error {
+	header := make([]byte, checksumHeaderSize)
+	binary.BigEndian.PutUint64(header, first)
+
+	if err := t.checksums.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := t.checksums.WriteAt(header, 0); err != nil {
+		return err
+	}
+	t.sumStart = first
+	return t.checksums.Sync()
+}
+
+// checksumOffset returns the offset of the checksum of the given item within the
+// checksum file.
+func (t *freezerTable) checksumOffset(item uint64) int64 {
+	return checksumHeaderSize + int64(item-t.sumStart)*checksumSize
+}
+
+// writeChecksum stores the checksum of the stored blob of the given item.
+func (t *freezerTable) writeChecksum(item uint64, blob []byte) error {
+	sum := make([]byte, checksumSize)
+	binary.BigEndian.PutUint32(sum, crc32.Checksum(blob, checksumTable))
+	_, err := t.checksums.WriteAt(sum, t.checksumOffset(item))
+	return err
+}
+
+// verifyChecksum checks the stored blob of the given item against its checksum,
+// if it has one. Empty checksum entries mark items whose checksum was lost.
+func (t *freezerTable) verifyChecksum(item uint64, blob []byte) error {
+	if item < t.sumStart {
+		return nil
+	}
+	sum := make([]byte, checksumSize)
+	if _, err := t.checksums.ReadAt(sum, t.checksumOffset(item)); err == io.EOF {
+		return errMissingChecksum
+	} else if err != nil {
+		return err
+	}
+	switch stored := binary.BigEndian.Uint32(sum); stored {
+	case crc32.Checksum(blob, checksumTable):
+		return nil
+	case 0:
+		return errMissingChecksum
+	default:
+		return errChecksumMismatch
+	}
+}
+
 // preopen opens all files that the freezer will need. This method should be called from an init-context,
 // since it assumes that it doesn't have to bother with locking
 // The rationale for doing preopen is to not have to do it from within Retrieve, thus not needing to ever
@@ -278,6 +514,9 @@ func (t *freezerTable) truncate(items uint64) error {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
+	if t.readonly {
+		return errNotSupported
+	}
 	// If our item count is correct, don't do anything
 	if atomic.LoadUint64(&t.items) <= items {
 		return nil
@@ -313,6 +552,14 @@ func (t *freezerTable) truncate(items uint64) error {
 	if err := t.head.Truncate(int64(expected.offset)); err != nil {
 		return err
 	}
+	// Drop the checksums of the discarded items
+	if items < t.sumStart {
+		if err := t.resetChecksums(items); err != nil {
+			return err
+		}
+	} else if err := t.checksums.Truncate(t.checksumOffset(items)); err != nil {
+		return err
+	}
 	// All data files truncated, set internal counters and return
 	atomic.StoreUint64(&t.items, items)
 	atomic.StoreUint32(&t.headBytes, expected.offset)
@@ -330,6 +577,11 @@ func (t *freezerTable) Close() error {
 	}
 	t.index = nil
 
+	if t.checksums != nil {
+		if err := t.checksums.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
 	for _, f := range t.files {
 		if err := f.Close(); err != nil {
 			errs = append(errs, err)
@@ -398,6 +650,10 @@ func (t *freezerTable) Append(item uint64, blob []byte) error {
 		t.lock.RUnlock()
 		return errClosed
 	}
+	if t.readonly {
+		t.lock.RUnlock()
+		return errNotSupported
+	}
 	// Ensure only the next item can be written, nothing else
 	if atomic.LoadUint64(&t.items) != item {
 		t.lock.RUnlock()
@@ -438,6 +694,11 @@ func (t *freezerTable) Append(item uint64, blob []byte) error {
 	if _, err := t.head.Write(blob); err != nil {
 		return err
 	}
+	// Store the checksum before the index entry, so the index never covers items
+	// without checksums after a crash
+	if err := t.writeChecksum(item, blob); err != nil {
+		return err
+	}
 	newOffset := atomic.AddUint32(&t.headBytes, bLen)
 	idx := indexEntry{
 		filenum: atomic.LoadUint32(&t.headId),
@@ -445,7 +706,7 @@ func (t *freezerTable) Append(item uint64, blob []byte) error {
 	}
 	// Write indexEntry
 	t.index.Write(idx.marshallBinary())
-	t.writeMeter.Mark(int64(bLen + indexEntrySize))
+	t.writeMeter.Mark(int64(bLen + indexEntrySize + checksumSize))
 	atomic.AddUint64(&t.items, 1)
 	return nil
 }
@@ -473,7 +734,7 @@ func (t *freezerTable) getBounds(item uint64) (uint32, uint32, uint32, error) {
 }
 
 // Retrieve looks up the data offset of an item with the given number and retrieves
-// the raw binary blob from the data file.
+// the raw binary blob from the data file, verifying its checksum.
 func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
 	// Ensure the table and the item is accessible
 	if t.index == nil || t.head == nil {
@@ -488,29 +749,74 @@ func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
 		return nil, errOutOfBounds
 	}
 	t.lock.RLock()
-	startOffset, endOffset, filenum, err := t.getBounds(item - uint64(offset))
+	blob, err := t.retrieveRaw(item - uint64(offset))
+	if err == nil {
+		err = t.verifyChecksum(item, blob)
+		if err == errMissingChecksum && !t.readonly {
+			err = nil // reported when the table was opened
+		}
+	}
+	t.lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	t.readMeter.Mark(int64(len(blob) + 2*indexEntrySize + checksumSize))
+
+	if t.noCompression {
+		return blob, nil
+	}
+	return snappy.Decode(nil, blob)
+}
+
+// retrieveRaw retrieves the blob stored in the data file for the given index
+// entry (item number minus the tail offset), without decompressing it. The caller
+// must hold the read lock.
+func (t *freezerTable) retrieveRaw(entry uint64) ([]byte, error) {
+	startOffset, endOffset, filenum, err := t.getBounds(entry)
 	if err != nil {
-		t.lock.RUnlock()
 		return nil, err
 	}
 	dataFile, exist := t.files[filenum]
 	if !exist {
-		t.lock.RUnlock()
 		return nil, fmt.Errorf("missing data file %d", filenum)
 	}
-	// Retrieve the data itself, decompress and return
 	blob := make([]byte, endOffset-startOffset)
 	if _, err := dataFile.ReadAt(blob, int64(startOffset)); err != nil {
-		t.lock.RUnlock()
 		return nil, err
 	}
-	t.lock.RUnlock()
-	t.readMeter.Mark(int64(len(blob) + 2*indexEntrySize))
+	return blob, nil
+}
 
-	if t.noCompression {
-		return blob, nil
+// verify retrieves every item of the table, reporting the ones which fail their
+// checksum, can't be decompressed or are missing. The number of items without
+// checksums, which can only be checked for decompression, is returned.
+func (t *freezerTable) verify(report func(item uint64, err error)) uint64 {
+	var (
+		offset = uint64(atomic.LoadUint32(&t.itemOffset))
+		items  = atomic.LoadUint64(&t.items)
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for item := offset; item < items; item++ {
+		if _, err := t.Retrieve(item); err != nil {
+			report(item, err)
+		}
+		if time.Since(logged) > 8*time.Second {
+			t.logger.Info("Verifying freezer table", "item", item, "items", items, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	switch {
+	case t.sumStart <= offset:
+		return 0
+	case t.sumStart < items:
+		return t.sumStart - offset
+	default:
+		return items - offset
 	}
-	return snappy.Decode(nil, blob)
 }
 
 // has returns an indicator whether the specified number data
@@ -529,12 +835,25 @@ func (t *freezerTable) size() (uint64, error) {
 		return 0, err
 	}
 	total := uint64(t.maxFileSize)*uint64(t.headId-t.tailId) + uint64(t.headBytes) + uint64(stat.Size())
-	return total, nil
+
+	if t.checksums == nil {
+		return total, nil
+	}
+	if stat, err = t.checksums.Stat(); err != nil {
+		return 0, err
+	}
+	return total + uint64(stat.Size()), nil
 }
 
 // Sync pushes any pending data from memory out to disk. This is an expensive
 // operation, so use it with care.
 func (t *freezerTable) Sync() error {
+	if t.readonly {
+		return nil
+	}
+	if err := t.checksums.Sync(); err != nil {
+		return err
+	}
 	if err := t.index.Sync(); err != nil {
 		return err
 	}
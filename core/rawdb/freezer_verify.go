@@ -0,0 +1,126 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// FreezerCorruption is an item of a freezer table which failed verification.
+type FreezerCorruption struct {
+	Table string // Name of the freezer table containing the item
+	Item  uint64 // Number of the corrupt item
+	Err   error  // Reason of the verification failure
+}
+
+// FreezerReport is the result of verifying the integrity of a freezer.
+type FreezerReport struct {
+	Items     uint64              // Number of items in the freezer
+	Unchecked map[string]uint64   // Number of items without checksums per table
+	Corrupt   []FreezerCorruption // Items failing verification
+}
+
+// VerifyFreezer opens the freezer at the given path and retrieves every item of
+// all its tables, reporting the ones whose checksum doesn't match, is missing or
+// which can't be read at all. The freezer is opened read only, so it is never
+// repaired. The freezer must not be in use by a running node.
+func VerifyFreezer(path string) (*FreezerReport, error) {
+	f, err := openFreezer(path, "", false, true)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	report := &FreezerReport{
+		Items:     f.frozen,
+		Unchecked: make(map[string]uint64),
+	}
+	names := make([]string, 0, len(f.tables))
+	for name := range f.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		unchecked := f.tables[name].verify(func(item uint64, err error) {
+			report.Corrupt = append(report.Corrupt, FreezerCorruption{Table: name, Item: item, Err: err})
+		})
+		if unchecked > 0 {
+			report.Unchecked[name] = unchecked
+		}
+	}
+	return report, nil
+}
+
+// RestoreFreezer overwrites a corrupt range of the freezer at the given path with
+// the items of an archive created by ExportAncients on a healthy node. Since the
+// freezer is append-only, all items from the start of the archive onwards are
+// replaced, so the archive must reach the end of the freezer. The range of the
+// restored items is returned.
+//
+// The archive is read twice, so open must return a new reader of it on every
+// call. The first pass validates the entire archive against the freezer, which
+// is only truncated and restored if that succeeds. Should the import still fail,
+// e.g. due to the archive changing in between, the freezer is left truncated to
+// the start of the archive.
+func RestoreFreezer(path string, open func() (io.ReadCloser, error)) (uint64, uint64, error) {
+	f, err := newFreezer(path, "", false)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	// Validate the entire archive before touching any freezer data
+	r, err := open()
+	if err != nil {
+		return 0, 0, err
+	}
+	archive, err := openAncientArchive(r)
+	if err != nil {
+		r.Close()
+		return 0, 0, err
+	}
+	first, last := archive.header.First, archive.header.First+archive.header.Count
+	if first > f.frozen || last < f.frozen {
+		r.Close()
+		return 0, 0, fmt.Errorf("ancient archive range [%d, %d) doesn't reach the end of the freezer (%d items)", first, last, f.frozen)
+	}
+	err = archive.validate(f)
+	r.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+	// Archive is valid, replace the freezer items with its content
+	if r, err = open(); err != nil {
+		return 0, 0, err
+	}
+	defer r.Close()
+
+	if archive, err = openAncientArchive(r); err != nil {
+		return 0, 0, err
+	}
+	if archive.header.First != first || archive.header.First+archive.header.Count != last {
+		return 0, 0, errors.New("ancient archive changed during restore")
+	}
+	if err := f.TruncateAncients(first); err != nil {
+		return 0, 0, err
+	}
+	return archive.importInto(f)
+}
@@ -0,0 +1,316 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// archiveOpener returns an archive opener for RestoreFreezer reading the given
+// archive from memory.
+func archiveOpener(archive []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(archive)), nil
+	}
+}
+
+// Tests that corrupted freezer items are detected by their checksums, both on
+// retrieval and by verification, and that they can be restored from an archive.
+func TestFreezerVerifyAndRestore(t *testing.T) {
+	src, cleanSrc := newTestFreezer(t)
+	defer cleanSrc()
+	fillTestFreezer(src, 10, 0)
+
+	dir, err := ioutil.TempDir("", "freezer-verify")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := newFreezer(dir, "", false)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	fillTestFreezer(f, 10, 0)
+	f.Close()
+
+	// Flip the last byte of the hash table, belonging to the last item
+	path := filepath.Join(dir, "hashes.0000.rdat")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read data file: %v", err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to corrupt data file: %v", err)
+	}
+	if f, err = newFreezer(dir, "", false); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	if _, err := f.Ancient(freezerHashTable, 9); err != errChecksumMismatch {
+		t.Errorf("corrupt item retrieval error mismatch: have %v, want %v", err, errChecksumMismatch)
+	}
+	f.Close()
+
+	report, err := VerifyFreezer(dir)
+	if err != nil {
+		t.Fatalf("failed to verify freezer: %v", err)
+	}
+	if report.Items != 10 || len(report.Unchecked) != 0 {
+		t.Errorf("report mismatch: have %d items, %d unchecked tables, want %d items, none unchecked", report.Items, len(report.Unchecked), 10)
+	}
+	if len(report.Corrupt) != 1 || report.Corrupt[0].Table != freezerHashTable || report.Corrupt[0].Item != 9 {
+		t.Fatalf("corruption mismatch: have %v, want %s #%d", report.Corrupt, freezerHashTable, 9)
+	}
+	// Restore the corrupt range from the healthy freezer
+	archive := new(bytes.Buffer)
+	if err := ExportAncients(src, archive, 8, 9); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	if first, count, err := RestoreFreezer(dir, archiveOpener(archive.Bytes())); err != nil || first != 8 || count != 2 {
+		t.Fatalf("failed to restore freezer: have %d+%d, %v", first, count, err)
+	}
+	if report, err = VerifyFreezer(dir); err != nil {
+		t.Fatalf("failed to verify restored freezer: %v", err)
+	}
+	if report.Items != 10 || len(report.Corrupt) != 0 {
+		t.Errorf("restored report mismatch: have %d items, %d corrupt, want %d items, none corrupt", report.Items, len(report.Corrupt), 10)
+	}
+}
+
+// Tests that restoring from an archive which fails validation leaves the freezer
+// untouched, wherever in the archive the failure is.
+func TestFreezerRestoreInvalid(t *testing.T) {
+	fork, cleanFork := newTestFreezer(t)
+	defer cleanFork()
+	fillTestFreezer(fork, 10, 1)
+
+	dir, err := ioutil.TempDir("", "freezer-verify")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := newFreezer(dir, "", false)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	fillTestFreezer(f, 10, 0)
+	f.Close()
+
+	// Create an archive not linked to the freezer and one with a bad checksum
+	forked := new(bytes.Buffer)
+	if err := ExportAncients(fork, forked, 8, 9); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	corrupt := new(bytes.Buffer)
+	if err := ExportAncients(fork, corrupt, 0, 9); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	corrupt.Bytes()[corrupt.Len()-1] ^= 0xff
+
+	for i, archive := range [][]byte{forked.Bytes(), corrupt.Bytes()} {
+		if _, _, err := RestoreFreezer(dir, archiveOpener(archive)); err == nil {
+			t.Errorf("archive %d: invalid archive restored", i)
+		}
+		report, err := VerifyFreezer(dir)
+		if err != nil {
+			t.Fatalf("archive %d: failed to verify freezer: %v", i, err)
+		}
+		if report.Items != 10 || len(report.Corrupt) != 0 {
+			t.Errorf("archive %d: freezer modified: have %d items, %d corrupt, want %d items, none corrupt", i, report.Items, len(report.Corrupt), 10)
+		}
+	}
+}
+
+// Tests that verification doesn't modify the freezer, reporting missing checksums
+// instead of regenerating them and leaving dangling data in place.
+func TestFreezerVerifyReadonly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-verify")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := newFreezer(dir, "", false)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	fillTestFreezer(f, 10, 0)
+	f.Close()
+
+	// Drop the checksum of the last header and append junk to the hash data
+	sums := filepath.Join(dir, tableFileName(freezerHeaderTable, false, "sum"))
+	stat, err := os.Stat(sums)
+	if err != nil {
+		t.Fatalf("failed to stat checksums: %v", err)
+	}
+	if err := os.Truncate(sums, stat.Size()-checksumSize); err != nil {
+		t.Fatalf("failed to truncate checksums: %v", err)
+	}
+	hashes := filepath.Join(dir, "hashes.0000.rdat")
+	data, err := ioutil.ReadFile(hashes)
+	if err != nil {
+		t.Fatalf("failed to read data file: %v", err)
+	}
+	if err := ioutil.WriteFile(hashes, append(data, 0xde, 0xad), 0644); err != nil {
+		t.Fatalf("failed to extend data file: %v", err)
+	}
+	report, err := VerifyFreezer(dir)
+	if err != nil {
+		t.Fatalf("failed to verify freezer: %v", err)
+	}
+	if len(report.Corrupt) != 1 || report.Corrupt[0].Table != freezerHeaderTable || report.Corrupt[0].Item != 9 || report.Corrupt[0].Err != errMissingChecksum {
+		t.Fatalf("corruption mismatch: have %v, want %s #%d: %v", report.Corrupt, freezerHeaderTable, 9, errMissingChecksum)
+	}
+	if have, _ := os.Stat(sums); have.Size() != stat.Size()-checksumSize {
+		t.Errorf("checksum file modified: have size %d, want %d", have.Size(), stat.Size()-checksumSize)
+	}
+	if have, _ := os.Stat(hashes); have.Size() != int64(len(data)+2) {
+		t.Errorf("data file modified: have size %d, want %d", have.Size(), len(data)+2)
+	}
+}
+
+// Tests that checksums missing from a writable freezer are not regenerated from
+// the possibly corrupt data, but are reported as missing on verification.
+func TestFreezerMissingChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-verify")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := newFreezer(dir, "", false)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	fillTestFreezer(f, 10, 0)
+	f.Close()
+
+	// Drop the checksum of the last hash and corrupt its data
+	sums := filepath.Join(dir, tableFileName(freezerHashTable, true, "sum"))
+	stat, err := os.Stat(sums)
+	if err != nil {
+		t.Fatalf("failed to stat checksums: %v", err)
+	}
+	if err := os.Truncate(sums, stat.Size()-checksumSize); err != nil {
+		t.Fatalf("failed to truncate checksums: %v", err)
+	}
+	hashes := filepath.Join(dir, "hashes.0000.rdat")
+	data, err := ioutil.ReadFile(hashes)
+	if err != nil {
+		t.Fatalf("failed to read data file: %v", err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := ioutil.WriteFile(hashes, data, 0644); err != nil {
+		t.Fatalf("failed to corrupt data file: %v", err)
+	}
+	// Reopen the freezer for writing, which must still serve the item
+	if f, err = newFreezer(dir, "", false); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	if _, err := f.Ancient(freezerHashTable, 9); err != nil {
+		t.Errorf("failed to retrieve item without checksum: %v", err)
+	}
+	f.Close()
+
+	report, err := VerifyFreezer(dir)
+	if err != nil {
+		t.Fatalf("failed to verify freezer: %v", err)
+	}
+	if len(report.Corrupt) != 1 || report.Corrupt[0].Table != freezerHashTable || report.Corrupt[0].Item != 9 || report.Corrupt[0].Err != errMissingChecksum {
+		t.Fatalf("corruption mismatch: have %v, want %s #%d: %v", report.Corrupt, freezerHashTable, 9, errMissingChecksum)
+	}
+}
+
+// Tests that tables created before checksums were introduced remain readable and
+// report their items as unchecked, while new items get checksums.
+func TestFreezerLegacyChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-verify")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := newFreezer(dir, "", false)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	fillTestFreezer(f, 10, 0)
+	f.Close()
+
+	if err := os.Remove(filepath.Join(dir, "bodies.csum")); err != nil {
+		t.Fatalf("failed to remove checksums: %v", err)
+	}
+	report, err := VerifyFreezer(dir)
+	if err != nil {
+		t.Fatalf("failed to verify freezer: %v", err)
+	}
+	if len(report.Corrupt) != 0 {
+		t.Errorf("legacy items reported corrupt: %v", report.Corrupt)
+	}
+	if len(report.Unchecked) != 1 || report.Unchecked[freezerBodiesTable] != 10 {
+		t.Errorf("unchecked items mismatch: have %v, want %d %s", report.Unchecked, 10, freezerBodiesTable)
+	}
+	// Truncating below the checksummed range should enable checksums for new items
+	if f, err = newFreezer(dir, "", false); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	if err := f.TruncateAncients(5); err != nil {
+		t.Fatalf("failed to truncate freezer: %v", err)
+	}
+	f.Close()
+
+	if report, err = VerifyFreezer(dir); err != nil {
+		t.Fatalf("failed to verify freezer: %v", err)
+	}
+	if report.Unchecked[freezerBodiesTable] != 5 {
+		t.Errorf("unchecked items mismatch: have %d, want %d", report.Unchecked[freezerBodiesTable], 5)
+	}
+}
+
+// Tests that enabling compression applies to new tables only, keeping the format
+// of existing ones.
+func TestFreezerCompression(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-verify")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if tableNoSnappy(dir, freezerHashTable, true, false) != true {
+		t.Errorf("hash table compressed by default")
+	}
+	if tableNoSnappy(dir, freezerHashTable, true, true) != false {
+		t.Errorf("new hash table not compressed")
+	}
+	// Create an uncompressed table, which should keep its format
+	table, err := newTable(dir, freezerDifficultyTable, nil, nil, true)
+	if err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	table.Close()
+
+	if tableNoSnappy(dir, freezerDifficultyTable, true, true) != true {
+		t.Errorf("existing uncompressed table switched to compression")
+	}
+}
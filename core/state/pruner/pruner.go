@@ -0,0 +1,319 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package pruner implements offline pruning of the persisted state.
+package pruner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/steakknife/bloomfilter"
+)
+
+const (
+	// BloomFileName is the name of the file the state bloom is persisted into
+	// once all retained state is marked, used to resume an interrupted pruning.
+	BloomFileName = "statebloom.bf.gz"
+
+	// bloomFilterHashes is the number of hash functions used by the state bloom.
+	bloomFilterHashes = 4
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256(nil)
+)
+
+// stateBloomHasher is a wrapper around a byte blob to satisfy the interface API
+// requirements of the bloom library used. It's used to convert a trie hash or
+// code hash into a 64 bit mini hash.
+type stateBloomHasher []byte
+
+func (f stateBloomHasher) Write(p []byte) (n int, err error) { panic("not implemented") }
+func (f stateBloomHasher) Sum(b []byte) []byte               { panic("not implemented") }
+func (f stateBloomHasher) Reset()                            { panic("not implemented") }
+func (f stateBloomHasher) BlockSize() int                    { panic("not implemented") }
+func (f stateBloomHasher) Size() int                         { return 8 }
+func (f stateBloomHasher) Sum64() uint64                     { return binary.BigEndian.Uint64(f) }
+
+// Pruner is an offline tool deleting all trie nodes and contract code from the
+// database which are not reachable from a set of retained state roots.
+//
+// The retained state is marked in a bloom filter of bounded size, so false
+// positives leave some stale data behind, but live data is never deleted. Once
+// marking is done, the bloom is persisted to disk, allowing an interrupted sweep
+// to be resumed with the same marking.
+type Pruner struct {
+	db        ethdb.Database
+	bloomPath string // Path of the file to persist the state bloom into
+	bloomSize uint64 // Size of the state bloom in megabytes
+}
+
+// NewPruner creates a state pruner operating on the given database.
+func NewPruner(db ethdb.Database, bloomPath string, bloomSize uint64) *Pruner {
+	return &Pruner{
+		db:        db,
+		bloomPath: bloomPath,
+		bloomSize: bloomSize,
+	}
+}
+
+// Prune deletes all state not reachable from the given roots and compacts the
+// database. The first root is marked in full, every further one only in its
+// difference to the root preceding it, so roots should be ordered such that
+// neighbours share most of their state (e.g. by block number). The state of the
+// genesis block, if the database has one, is always retained.
+//
+// If a previous pruning was interrupted after marking its state, that pruning is
+// completed instead and the given roots are ignored.
+func (p *Pruner) Prune(roots []common.Hash) error {
+	if _, err := os.Stat(p.bloomPath); err == nil {
+		log.Warn("Interrupted state pruning found, ignoring requested roots", "bloom", p.bloomPath)
+		return RecoverPruning(p.bloomPath, p.db)
+	}
+	if len(roots) == 0 {
+		return errors.New("no state roots to retain")
+	}
+	// The genesis state is needed to start up the chain, always retain it too
+	if genesis := rawdb.ReadCanonicalHash(p.db, 0); genesis != (common.Hash{}) {
+		header := rawdb.ReadHeader(p.db, genesis, 0)
+		if header == nil {
+			return fmt.Errorf("missing genesis header %x", genesis)
+		}
+		retained := false
+		for _, root := range roots {
+			if root == header.Root {
+				retained = true
+				break
+			}
+		}
+		if !retained {
+			roots = append(roots, header.Root)
+		}
+	}
+	for _, root := range roots {
+		if ok, _ := p.db.Has(root[:]); !ok {
+			return fmt.Errorf("missing state root %x", root)
+		}
+	}
+	bloom, err := bloomfilter.New(p.bloomSize*1024*1024*8, bloomFilterHashes)
+	if err != nil {
+		return err
+	}
+	log.Info("Allocated state bloom", "size", common.StorageSize(p.bloomSize*1024*1024))
+
+	start := time.Now()
+	if err := markState(p.db, bloom, roots); err != nil {
+		return err
+	}
+	if err := writeBloom(bloom, p.bloomPath); err != nil {
+		return err
+	}
+	return sweep(p.db, bloom, p.bloomPath, start)
+}
+
+// RecoverPruning completes a state pruning interrupted after its marking phase,
+// if there is any. It must be run before the database is used to avoid deleting
+// state created after the interrupted pruning.
+func RecoverPruning(bloomPath string, db ethdb.Database) error {
+	if _, err := os.Stat(bloomPath); os.IsNotExist(err) {
+		return nil
+	}
+	bloom, _, err := bloomfilter.ReadFile(bloomPath)
+	if err != nil {
+		return fmt.Errorf("failed to load state bloom: %v", err)
+	}
+	log.Info("Resuming interrupted state pruning", "bloom", bloomPath)
+	return sweep(db, bloom, bloomPath, time.Now())
+}
+
+// markStats tracks the progress of the marking phase.
+type markStats struct {
+	nodes  uint64
+	codes  uint64
+	start  time.Time
+	logged time.Time
+}
+
+// markState adds every trie node and contract code reachable from the given
+// roots into the state bloom.
+func markState(db ethdb.Database, bloom *bloomfilter.Filter, roots []common.Hash) error {
+	var (
+		triedb = trie.NewDatabase(db)
+		stats  = &markStats{start: time.Now(), logged: time.Now()}
+		base   common.Hash
+	)
+	for _, root := range roots {
+		if err := markTrie(triedb, bloom, base, root, true, stats); err != nil {
+			return err
+		}
+		base = root
+	}
+	log.Info("Marked retained state", "roots", len(roots), "nodes", stats.nodes, "codes", stats.codes, "elapsed", common.PrettyDuration(time.Since(stats.start)))
+	return nil
+}
+
+// markTrie adds the nodes of the trie with the given root which are not part of
+// the base trie into the state bloom. For account tries, the contract code and
+// the changed parts of the storage tries are marked too.
+func markTrie(triedb *trie.Database, bloom *bloomfilter.Filter, base, root common.Hash, accounts bool, stats *markStats) error {
+	baseTrie, err := trie.New(base, triedb)
+	if err != nil {
+		return err
+	}
+	rootTrie, err := trie.New(root, triedb)
+	if err != nil {
+		return err
+	}
+	it, _ := trie.NewDifferenceIterator(baseTrie.NodeIterator(nil), rootTrie.NodeIterator(nil))
+	for it.Next(true) {
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			bloom.Add(stateBloomHasher(hash[:]))
+			stats.nodes++
+		}
+		if time.Since(stats.logged) > 8*time.Second {
+			log.Info("Marking retained state", "nodes", stats.nodes, "codes", stats.codes, "elapsed", common.PrettyDuration(time.Since(stats.start)))
+			stats.logged = time.Now()
+		}
+		if !accounts || !it.Leaf() {
+			continue
+		}
+		var account state.Account
+		if err := rlp.DecodeBytes(it.LeafBlob(), &account); err != nil {
+			return err
+		}
+		if !bytes.Equal(account.CodeHash, emptyCode) {
+			bloom.Add(stateBloomHasher(account.CodeHash))
+			stats.codes++
+		}
+		if account.Root == emptyRoot {
+			continue
+		}
+		// Only mark the storage changed since the account's version in the base
+		var baseStorage common.Hash
+		blob, err := baseTrie.TryGet(it.LeafKey())
+		if err != nil {
+			return err
+		}
+		if blob != nil {
+			var prev state.Account
+			if err := rlp.DecodeBytes(blob, &prev); err != nil {
+				return err
+			}
+			baseStorage = prev.Root
+		}
+		if err := markTrie(triedb, bloom, baseStorage, account.Root, false, stats); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// writeBloom atomically persists the state bloom to the given path.
+func writeBloom(bloom *bloomfilter.Filter, path string) error {
+	if _, err := bloom.WriteFile(path + ".tmp"); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// sweep deletes every trie node and contract code not contained in the state
+// bloom, compacts the database and removes the persisted bloom.
+func sweep(db ethdb.Database, bloom *bloomfilter.Filter, bloomPath string, start time.Time) error {
+	var (
+		count  int
+		size   common.StorageSize
+		batch  = db.NewBatch()
+		it     = db.NewIterator()
+		logged = time.Now()
+	)
+	for it.Next() {
+		key := it.Key()
+		if len(key) != common.HashLength || bloom.Contains(stateBloomHasher(key)) {
+			continue
+		}
+		// Only delete content addressed data, other entries may share the key length
+		if !bytes.Equal(crypto.Keccak256(it.Value()), key) {
+			continue
+		}
+		count++
+		size += common.StorageSize(len(key) + len(it.Value()))
+		batch.Delete(key)
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				it.Release()
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning state data", "nodes", count, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Pruned state data", "nodes", count, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	// Compact the entire database in chunks to reclaim the disk space
+	cstart := time.Now()
+	for b := 0x00; b <= 0xf0; b += 0x10 {
+		var (
+			begin = []byte{byte(b)}
+			end   = []byte{byte(b + 0x10)}
+		)
+		if b == 0x00 {
+			begin = nil
+		}
+		if b == 0xf0 {
+			end = nil
+		}
+		log.Info("Compacting database", "range", fmt.Sprintf("%#x-%#x", begin, end), "elapsed", common.PrettyDuration(time.Since(cstart)))
+		if err := db.Compact(begin, end); err != nil {
+			return err
+		}
+	}
+	log.Info("Database compaction finished", "elapsed", common.PrettyDuration(time.Since(cstart)))
+
+	// Pruning is complete, don't resume it on the next start
+	if err := os.Remove(bloomPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	log.Info("State pruning successful", "pruned", size, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
@@ -0,0 +1,257 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/steakknife/bloomfilter"
+)
+
+// makeStates creates three consecutive generations of a state, each modifying
+// accounts, contract code and storage of the previous one.
+func makeStates(t *testing.T, db ethdb.Database) []common.Hash {
+	sdb := state.NewDatabase(db)
+
+	var (
+		roots  []common.Hash
+		parent common.Hash
+	)
+	for gen := byte(0); gen < 3; gen++ {
+		statedb, err := state.New(parent, sdb)
+		if err != nil {
+			t.Fatalf("generation %d: failed to open state: %v", gen, err)
+		}
+		for i := byte(0); i < 50; i++ {
+			addr := common.BytesToAddress([]byte{i})
+			if i%(gen+1) == 0 {
+				statedb.AddBalance(addr, big.NewInt(int64(gen)+1))
+			}
+			if i%5 == 0 {
+				statedb.SetCode(addr, []byte{i, gen, 0xfe})
+			}
+			if i%3 == 0 {
+				for j := byte(0); j < 20; j++ {
+					statedb.SetState(addr, common.BytesToHash([]byte{j}), common.BytesToHash([]byte{i, j, gen + 1}))
+				}
+			}
+		}
+		root, err := statedb.Commit(false)
+		if err != nil {
+			t.Fatalf("generation %d: failed to commit state: %v", gen, err)
+		}
+		if err := sdb.TrieDB().Commit(root, false); err != nil {
+			t.Fatalf("generation %d: failed to flush state: %v", gen, err)
+		}
+		roots = append(roots, root)
+		parent = root
+	}
+	return roots
+}
+
+// checkState iterates over an entire state, failing if any part is missing.
+func checkState(t *testing.T, db ethdb.Database, root common.Hash) {
+	statedb, err := state.New(root, state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("failed to open state %x: %v", root, err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	if it.Error != nil {
+		t.Fatalf("state %x incomplete: %v", root, it.Error)
+	}
+}
+
+// Tests that pruning retains every requested state, deletes the state only
+// reachable from other roots and leaves non-state data untouched.
+func TestPruneState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pruner")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := rawdb.NewLevelDBDatabase(filepath.Join(dir, "chaindata"), 16, 16, "")
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	roots := makeStates(t, db)
+
+	// Insert an entry sharing the length of trie nodes which isn't content addressed
+	unrelated := crypto.Keccak256([]byte("unrelated"))
+	db.Put(unrelated, []byte{0x01})
+
+	bloomPath := filepath.Join(dir, BloomFileName)
+	if err := NewPruner(db, bloomPath, 1).Prune([]common.Hash{roots[2], roots[1]}); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	checkState(t, db, roots[2])
+	checkState(t, db, roots[1])
+
+	if ok, _ := db.Has(roots[0][:]); ok {
+		t.Errorf("stale state root retained")
+	}
+	if ok, _ := db.Has(crypto.Keccak256([]byte{0, 0, 0xfe})); ok {
+		t.Errorf("stale contract code retained")
+	}
+	if ok, _ := db.Has(unrelated); !ok {
+		t.Errorf("unrelated entry deleted")
+	}
+	if _, err := os.Stat(bloomPath); !os.IsNotExist(err) {
+		t.Errorf("state bloom not removed after pruning: %v", err)
+	}
+}
+
+// Tests that a pruning interrupted after marking is completed from the persisted
+// state bloom, even if different roots are requested.
+func TestPruneStateRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pruner")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := rawdb.NewLevelDBDatabase(filepath.Join(dir, "chaindata"), 16, 16, "")
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	roots := makeStates(t, db)
+
+	// Mark the latest state and persist the bloom, but stop before sweeping
+	bloomPath := filepath.Join(dir, BloomFileName)
+	bloom, err := bloomfilter.New(1024*1024*8, bloomFilterHashes)
+	if err != nil {
+		t.Fatalf("failed to create bloom: %v", err)
+	}
+	if err := markState(db, bloom, roots[2:]); err != nil {
+		t.Fatalf("failed to mark state: %v", err)
+	}
+	if err := writeBloom(bloom, bloomPath); err != nil {
+		t.Fatalf("failed to persist bloom: %v", err)
+	}
+	if err := NewPruner(db, bloomPath, 1).Prune(roots[:2]); err != nil {
+		t.Fatalf("failed to resume pruning: %v", err)
+	}
+	checkState(t, db, roots[2])
+	for _, root := range roots[:2] {
+		if ok, _ := db.Has(root[:]); ok {
+			t.Errorf("stale state root %x retained", root)
+		}
+	}
+	if _, err := os.Stat(bloomPath); !os.IsNotExist(err) {
+		t.Errorf("state bloom not removed after pruning: %v", err)
+	}
+	// Recovering without an interrupted pruning should be a noop
+	if err := RecoverPruning(bloomPath, db); err != nil {
+		t.Errorf("failed to skip recovery: %v", err)
+	}
+}
+
+// Tests that pruning a chain database retains the genesis state even if it isn't
+// requested, so the chain can be reopened afterwards.
+func TestPruneChainRetainsGenesis(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pruner")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := rawdb.NewLevelDBDatabase(filepath.Join(dir, "chaindata"), 16, 16, "")
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// Create a chain persisting the state of every block
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		signer  = types.HomesteadSigner{}
+		genesis = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{address: {Balance: big.NewInt(1000000000000000)}},
+		}
+		cache = &core.CacheConfig{TrieCleanLimit: 16, TrieDirtyLimit: 16, TrieDirtyDisabled: true}
+	)
+	gblock := genesis.MustCommit(db)
+	blocks, _ := core.GenerateChain(genesis.Config, gblock, ethash.NewFaker(), db, 8, func(i int, block *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{byte(i + 1)}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		block.AddTx(tx)
+	})
+	chain, err := core.NewBlockChain(db, cache, genesis.Config, ethash.NewFaker(), vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import chain: %v", err)
+	}
+	chain.Stop()
+
+	// Prune all but the last two states and ensure the chain still starts up
+	head := blocks[len(blocks)-1]
+	if err := NewPruner(db, filepath.Join(dir, BloomFileName), 1).Prune([]common.Hash{blocks[len(blocks)-2].Root(), head.Root()}); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	if ok, _ := db.Has(blocks[0].Root().Bytes()); ok {
+		t.Errorf("stale state root retained")
+	}
+	checkState(t, db, gblock.Root())
+
+	if _, hash, err := core.SetupGenesisBlock(db, nil); err != nil {
+		t.Fatalf("failed to set up genesis after pruning: %v", err)
+	} else if hash != gblock.Hash() {
+		t.Fatalf("genesis hash mismatch: have %x, want %x", hash, gblock.Hash())
+	}
+	chain, err = core.NewBlockChain(db, cache, genesis.Config, ethash.NewFaker(), vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen chain after pruning: %v", err)
+	}
+	defer chain.Stop()
+
+	if have := chain.CurrentBlock().Hash(); have != head.Hash() {
+		t.Errorf("head block mismatch: have %x, want %x", have, head.Hash())
+	}
+	statedb, err := chain.State()
+	if err != nil {
+		t.Fatalf("failed to open head state: %v", err)
+	}
+	if balance := statedb.GetBalance(common.Address{byte(len(blocks))}); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("head state balance mismatch: have %v, want %v", balance, 1000)
+	}
+}
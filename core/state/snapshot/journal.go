@@ -0,0 +1,135 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// journal is the serialized form of the diff layers of a snapshot tree, saved
+// on shutdown so the recent layers don't need to be flattened into disk.
+type journal struct {
+	Base   common.Hash    // Root of the disk layer the diffs are stacked on
+	Layers []journalLayer // Diff layers from the bottom-most one upwards
+}
+
+// journalLayer is a diff layer entry containing the modifications of a block.
+type journalLayer struct {
+	Root      common.Hash
+	Destructs []common.Hash
+	Accounts  []journalAccount
+	Storage   []journalStorage
+}
+
+// journalAccount is an account entry of a diff layer, empty if deleted.
+type journalAccount struct {
+	Hash common.Hash
+	Blob []byte
+}
+
+// journalStorage is the set of storage slots of an account in a diff layer,
+// with empty values for deleted slots.
+type journalStorage struct {
+	Hash common.Hash
+	Keys []common.Hash
+	Vals [][]byte
+}
+
+// journalDiffs serializes the given diff layers, ordered from the bottom-most
+// one upwards, stacked on the disk layer with the given root.
+func journalDiffs(base common.Hash, diffs []*diffLayer) ([]byte, error) {
+	entry := journal{Base: base}
+	for _, diff := range diffs {
+		diff.lock.RLock()
+		layer := journalLayer{Root: diff.root}
+		for hash := range diff.destructSet {
+			layer.Destructs = append(layer.Destructs, hash)
+		}
+		for hash, blob := range diff.accountData {
+			layer.Accounts = append(layer.Accounts, journalAccount{Hash: hash, Blob: blob})
+		}
+		for hash, slots := range diff.storageData {
+			storage := journalStorage{Hash: hash}
+			for key, val := range slots {
+				storage.Keys = append(storage.Keys, key)
+				storage.Vals = append(storage.Vals, val)
+			}
+			layer.Storage = append(layer.Storage, storage)
+		}
+		diff.lock.RUnlock()
+
+		entry.Layers = append(entry.Layers, layer)
+	}
+	return rlp.EncodeToBytes(entry)
+}
+
+// loadDiffs stacks the diff layers saved at the last shutdown on top of the disk
+// layer and returns the top-most one. If there is no journal, or it belongs to a
+// different disk layer, the disk layer itself is returned.
+func loadDiffs(db ethdb.KeyValueReader, base *diskLayer) (snapshot, error) {
+	blob := rawdb.ReadSnapshotJournal(db)
+	if len(blob) == 0 {
+		return base, nil
+	}
+	var entry journal
+	if err := rlp.DecodeBytes(blob, &entry); err != nil {
+		return nil, fmt.Errorf("failed to load snapshot journal: %v", err)
+	}
+	if entry.Base != base.root {
+		log.Warn("Discarding stale snapshot journal", "base", entry.Base, "disk", base.root)
+		return base, nil
+	}
+	var head snapshot = base
+	for _, layer := range entry.Layers {
+		destructs := make(map[common.Hash]struct{})
+		for _, hash := range layer.Destructs {
+			destructs[hash] = struct{}{}
+		}
+		accounts := make(map[common.Hash][]byte)
+		for _, account := range layer.Accounts {
+			if len(account.Blob) > 0 {
+				accounts[account.Hash] = account.Blob
+			} else {
+				accounts[account.Hash] = nil
+			}
+		}
+		storage := make(map[common.Hash]map[common.Hash][]byte)
+		for _, entry := range layer.Storage {
+			if len(entry.Keys) != len(entry.Vals) {
+				return nil, fmt.Errorf("snapshot journal layer [%#x] storage key/value count mismatch", layer.Root)
+			}
+			slots := make(map[common.Hash][]byte)
+			for i, key := range entry.Keys {
+				if len(entry.Vals[i]) > 0 {
+					slots[key] = entry.Vals[i]
+				} else {
+					slots[key] = nil
+				}
+			}
+			storage[entry.Hash] = slots
+		}
+		head = head.Update(layer.Root, destructs, accounts, storage)
+	}
+	log.Debug("Loaded snapshot journal", "base", base.root, "head", head.Root(), "layers", len(entry.Layers))
+	return head, nil
+}
@@ -0,0 +1,330 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// randomHash generates a random blob of data and returns it as a hash.
+func randomHash(seed int) common.Hash {
+	return crypto.Keccak256Hash(big.NewInt(int64(seed)).Bytes())
+}
+
+// accountBlob encodes a test account with the given nonce and storage root.
+func accountBlob(nonce uint64, root common.Hash) []byte {
+	blob, _ := rlp.EncodeToBytes(&Account{
+		Nonce:    nonce,
+		Balance:  big.NewInt(int64(nonce)),
+		Root:     root,
+		CodeHash: crypto.Keccak256(nil),
+	})
+	return blob
+}
+
+// slotBlob encodes a storage slot value the same way the state does.
+func slotBlob(value byte) []byte {
+	blob, _ := rlp.EncodeToBytes([]byte{value})
+	return blob
+}
+
+// testState creates a small state with a couple of accounts, some of them with
+// storage, commits it to disk and returns the backing databases and root.
+func testState(t *testing.T) (ethdb.Database, *trie.Database, common.Hash) {
+	var (
+		diskdb = rawdb.NewMemoryDatabase()
+		triedb = trie.NewDatabase(diskdb)
+	)
+	accTrie, _ := trie.New(common.Hash{}, triedb)
+	for i := 0; i < 32; i++ {
+		root := emptyRoot
+		if i%4 == 0 {
+			stTrie, _ := trie.New(common.Hash{}, triedb)
+			for j := 1; j <= 8; j++ {
+				stTrie.Update(randomHash(1000*i+j).Bytes(), slotBlob(byte(j)))
+			}
+			root, _ = stTrie.Commit(nil)
+		}
+		accTrie.Update(randomHash(i).Bytes(), accountBlob(uint64(i), root))
+	}
+	root, err := accTrie.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit account trie: %v", err)
+	}
+	if err := triedb.Commit(root, false); err != nil {
+		t.Fatalf("failed to flush tries: %v", err)
+	}
+	return diskdb, triedb, root
+}
+
+// Tests that a snapshot generated from scratch contains the exact same data as
+// the state trie and that it passes verification.
+func TestGeneration(t *testing.T) {
+	diskdb, triedb, root := testState(t)
+
+	snaps := New(diskdb, triedb, 16, root, false)
+	if err := snaps.Verify(root); err != nil {
+		t.Fatalf("generated snapshot failed verification: %v", err)
+	}
+	snap := snaps.Snapshot(root)
+	if snap == nil {
+		t.Fatalf("snapshot missing for root %x", root)
+	}
+	for i := 0; i < 32; i++ {
+		acc, err := snap.Account(randomHash(i))
+		if err != nil {
+			t.Fatalf("account %d: failed to retrieve: %v", i, err)
+		}
+		if acc == nil || acc.Nonce != uint64(i) {
+			t.Fatalf("account %d: mismatch: have %v", i, acc)
+		}
+		if i%4 == 0 {
+			blob, err := snap.Storage(randomHash(i), randomHash(1000*i+1))
+			if err != nil {
+				t.Fatalf("account %d: failed to retrieve slot: %v", i, err)
+			}
+			if !bytes.Equal(blob, slotBlob(1)) {
+				t.Fatalf("account %d: slot mismatch: have %x, want %x", i, blob, slotBlob(1))
+			}
+		}
+	}
+	if acc, err := snap.Account(randomHash(100)); err != nil || acc != nil {
+		t.Fatalf("missing account: have %v/%v, want nil/nil", acc, err)
+	}
+	// Reopening the tree should load the persisted snapshot instead of regenerating
+	if err := snaps.Persist(root, 0); err != nil {
+		t.Fatalf("failed to persist snapshot: %v", err)
+	}
+	if _, err := loadSnapshot(diskdb, triedb, 16, root); err != nil {
+		t.Fatalf("failed to load persisted snapshot: %v", err)
+	}
+}
+
+// Tests that verification detects missing, dangling and mismatching entries.
+func TestVerifyCorruption(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(db ethdb.KeyValueWriter)
+	}{
+		{"missing account", func(db ethdb.KeyValueWriter) {
+			rawdb.DeleteAccountSnapshot(db, randomHash(1))
+		}},
+		{"dangling account", func(db ethdb.KeyValueWriter) {
+			rawdb.WriteAccountSnapshot(db, randomHash(100), accountBlob(100, emptyRoot))
+		}},
+		{"mismatching account", func(db ethdb.KeyValueWriter) {
+			rawdb.WriteAccountSnapshot(db, randomHash(1), accountBlob(100, emptyRoot))
+		}},
+		{"missing slot", func(db ethdb.KeyValueWriter) {
+			rawdb.DeleteStorageSnapshot(db, randomHash(4), randomHash(4001))
+		}},
+		{"dangling slot", func(db ethdb.KeyValueWriter) {
+			rawdb.WriteStorageSnapshot(db, randomHash(1), randomHash(1), slotBlob(1))
+		}},
+		{"mismatching slot", func(db ethdb.KeyValueWriter) {
+			rawdb.WriteStorageSnapshot(db, randomHash(4), randomHash(4001), slotBlob(100))
+		}},
+	}
+	for _, tt := range tests {
+		diskdb, triedb, root := testState(t)
+
+		snaps := New(diskdb, triedb, 16, root, false)
+		snaps.Persist(root, 0)
+
+		tt.corrupt(diskdb)
+		if err := verifyState(diskdb, triedb, root, nil); err == nil {
+			t.Errorf("%s: corruption not detected", tt.name)
+		}
+	}
+}
+
+// Tests that diff layers shadow their parents correctly, including destructed
+// accounts and their storage.
+func TestDiffLayerReads(t *testing.T) {
+	diskdb, triedb, root := testState(t)
+	snaps := New(diskdb, triedb, 16, root, false)
+
+	// Delete an account with storage, modify another and create a new one
+	var (
+		acc0, acc1, acc2 = randomHash(0), randomHash(1), randomHash(100)
+		slot             = randomHash(1)
+	)
+	destructs := map[common.Hash]struct{}{acc0: {}}
+	accounts := map[common.Hash][]byte{
+		acc1: accountBlob(101, emptyRoot),
+		acc2: accountBlob(102, emptyRoot),
+	}
+	if err := snaps.Update(common.HexToHash("0x01"), root, destructs, accounts, nil); err != nil {
+		t.Fatalf("failed to create diff layer: %v", err)
+	}
+	// Resurrect the deleted account with fresh storage on top
+	accounts = map[common.Hash][]byte{acc0: accountBlob(103, emptyRoot)}
+	storage := map[common.Hash]map[common.Hash][]byte{acc0: {slot: slotBlob(42)}}
+	if err := snaps.Update(common.HexToHash("0x02"), common.HexToHash("0x01"), nil, accounts, storage); err != nil {
+		t.Fatalf("failed to create diff layer: %v", err)
+	}
+	mid, head := snaps.Snapshot(common.HexToHash("0x01")), snaps.Snapshot(common.HexToHash("0x02"))
+
+	if acc, _ := mid.Account(acc0); acc != nil {
+		t.Errorf("destructed account present in diff: %v", acc)
+	}
+	if blob, _ := mid.Storage(acc0, randomHash(1)); blob != nil {
+		t.Errorf("destructed storage present in diff: %x", blob)
+	}
+	if acc, _ := head.Account(acc0); acc == nil || acc.Nonce != 103 {
+		t.Errorf("resurrected account mismatch: %v", acc)
+	}
+	if blob, _ := head.Storage(acc0, slot); !bytes.Equal(blob, slotBlob(42)) {
+		t.Errorf("resurrected slot mismatch: have %x, want %x", blob, slotBlob(42))
+	}
+	if blob, _ := head.Storage(acc0, randomHash(2)); blob != nil {
+		t.Errorf("stale slot of resurrected account present: %x", blob)
+	}
+	if acc, _ := head.Account(acc1); acc == nil || acc.Nonce != 101 {
+		t.Errorf("modified account mismatch: %v", acc)
+	}
+	if acc, _ := head.Account(randomHash(2)); acc == nil || acc.Nonce != 2 {
+		t.Errorf("untouched account mismatch: %v", acc)
+	}
+}
+
+// Tests that capping the diff layers flattens them into the disk layer while
+// retaining the requested number of layers, invalidating any stale ones.
+func TestCap(t *testing.T) {
+	diskdb, triedb, root := testState(t)
+	snaps := New(diskdb, triedb, 16, root, false)
+
+	// Force every flattening to be written to disk
+	defer func(memcap uint64) { aggregatorMemoryLimit = memcap }(aggregatorMemoryLimit)
+	aggregatorMemoryLimit = 0
+
+	parent := root
+	for i := 1; i <= 4; i++ {
+		layer := common.BigToHash(big.NewInt(int64(i)))
+		accounts := map[common.Hash][]byte{randomHash(i): accountBlob(uint64(100+i), emptyRoot)}
+		if err := snaps.Update(layer, parent, nil, accounts, nil); err != nil {
+			t.Fatalf("layer %d: failed to create diff: %v", i, err)
+		}
+		parent = layer
+	}
+	bottom := snaps.Snapshot(common.BigToHash(big.NewInt(1)))
+	if err := snaps.Cap(parent, 2); err != nil {
+		t.Fatalf("failed to cap snapshot tree: %v", err)
+	}
+	// The two top layers must be retained, the third flattened into disk
+	if n := len(snaps.layers); n != 3 {
+		t.Fatalf("layer count mismatch: have %d, want %d", n, 3)
+	}
+	if _, ok := snaps.layers[common.BigToHash(big.NewInt(2))].(*diskLayer); !ok {
+		t.Fatalf("bottom layer not persisted")
+	}
+	if rawdb.ReadSnapshotRoot(diskdb) != common.BigToHash(big.NewInt(2)) {
+		t.Fatalf("persisted snapshot root mismatch")
+	}
+	if _, err := bottom.Account(randomHash(1)); err != ErrSnapshotStale {
+		t.Fatalf("flattened layer access error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	head := snaps.Snapshot(parent)
+	for i := 1; i <= 4; i++ {
+		if acc, err := head.Account(randomHash(i)); err != nil || acc.Nonce != uint64(100+i) {
+			t.Errorf("account %d: mismatch after cap: %v/%v", i, acc, err)
+		}
+	}
+	if blob := rawdb.ReadAccountSnapshot(diskdb, randomHash(2)); !bytes.Equal(blob, accountBlob(102, emptyRoot)) {
+		t.Errorf("flattened account not written to disk")
+	}
+	if blob := rawdb.ReadAccountSnapshot(diskdb, randomHash(3)); !bytes.Equal(blob, accountBlob(3, emptyRoot)) {
+		t.Errorf("retained diff leaked to disk")
+	}
+}
+
+// Tests that persisting a snapshot tree journals the retained diff layers, which
+// are stacked back onto the disk layer when the tree is reopened.
+func TestJournal(t *testing.T) {
+	diskdb, triedb, root := testState(t)
+	snaps := New(diskdb, triedb, 16, root, false)
+
+	// Force every flattening to be written to disk
+	defer func(memcap uint64) { aggregatorMemoryLimit = memcap }(aggregatorMemoryLimit)
+	aggregatorMemoryLimit = 0
+
+	var (
+		acc0, acc1, acc2 = randomHash(0), randomHash(1), randomHash(2)
+		slot             = randomHash(1)
+	)
+	layers := []struct {
+		destructs map[common.Hash]struct{}
+		accounts  map[common.Hash][]byte
+		storage   map[common.Hash]map[common.Hash][]byte
+	}{
+		{nil, map[common.Hash][]byte{acc1: accountBlob(101, emptyRoot)}, nil},
+		{map[common.Hash]struct{}{acc0: {}}, map[common.Hash][]byte{acc2: nil}, nil},
+		{nil, map[common.Hash][]byte{acc0: accountBlob(100, emptyRoot)}, map[common.Hash]map[common.Hash][]byte{acc0: {slot: slotBlob(42)}}},
+	}
+	parent := root
+	for i, layer := range layers {
+		head := common.BigToHash(big.NewInt(int64(i + 1)))
+		if err := snaps.Update(head, parent, layer.destructs, layer.accounts, layer.storage); err != nil {
+			t.Fatalf("layer %d: failed to create diff: %v", i, err)
+		}
+		parent = head
+	}
+	if err := snaps.Persist(parent, 2); err != nil {
+		t.Fatalf("failed to persist snapshot: %v", err)
+	}
+	// Reopen the tree and ensure the two top layers were retained as diffs
+	snaps = New(diskdb, triedb, 16, parent, false)
+	if n := len(snaps.layers); n != 3 {
+		t.Fatalf("layer count mismatch: have %d, want %d", n, 3)
+	}
+	if _, ok := snaps.layers[common.BigToHash(big.NewInt(1))].(*diskLayer); !ok {
+		t.Fatalf("bottom layer not persisted")
+	}
+	mid := snaps.Snapshot(common.BigToHash(big.NewInt(2)))
+	if acc, _ := mid.Account(acc0); acc != nil {
+		t.Errorf("destructed account present in diff: %v", acc)
+	}
+	if acc, _ := mid.Account(acc2); acc != nil {
+		t.Errorf("deleted account present in diff: %v", acc)
+	}
+	head := snaps.Snapshot(parent)
+	if acc, _ := head.Account(acc0); acc == nil || acc.Nonce != 100 {
+		t.Errorf("resurrected account mismatch: %v", acc)
+	}
+	if blob, _ := head.Storage(acc0, slot); !bytes.Equal(blob, slotBlob(42)) {
+		t.Errorf("resurrected slot mismatch: have %x, want %x", blob, slotBlob(42))
+	}
+	if acc, _ := head.Account(acc1); acc == nil || acc.Nonce != 101 {
+		t.Errorf("flattened account mismatch: %v", acc)
+	}
+	// Moving the disk layer must invalidate the journal
+	if err := snaps.Cap(parent, 1); err != nil {
+		t.Fatalf("failed to cap snapshot tree: %v", err)
+	}
+	if blob := rawdb.ReadSnapshotJournal(diskdb); len(blob) != 0 {
+		t.Fatalf("stale journal retained after flattening")
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// errVerifyInterrupted is returned if snapshot verification was aborted by the
+// caller before it could complete.
+var errVerifyInterrupted = errors.New("verification interrupted")
+
+// snapIterator walks the entries of a flat snapshot key-range, skipping over any
+// unrelated database keys sharing the same prefix.
+type snapIterator struct {
+	it     ethdb.Iterator
+	keylen int
+
+	key   []byte // Current key with the prefix stripped, nil when exhausted
+	value []byte // Current value, copied out of the database iterator
+}
+
+// newSnapIterator creates an iterator over the snapshot entries with the given
+// prefix, positioned at the first element.
+func newSnapIterator(db ethdb.Iteratee, prefix []byte, keylen int) *snapIterator {
+	it := &snapIterator{
+		it:     db.NewIteratorWithPrefix(prefix),
+		keylen: keylen,
+	}
+	it.next()
+	return it
+}
+
+// next moves the iterator to the next snapshot entry.
+func (it *snapIterator) next() {
+	for it.it.Next() {
+		if key := it.it.Key(); len(key) == it.keylen {
+			it.key = common.CopyBytes(key[1:])
+			it.value = common.CopyBytes(it.it.Value())
+			return
+		}
+	}
+	it.key, it.value = nil, nil
+}
+
+// verifyState checks that the flat snapshot persisted in the database holds the
+// exact same data as the state trie with the given root, without any extra or
+// missing entries. The trie and the snapshot are both iterated in key order in
+// lockstep, so memory use is constant regardless of the state size.
+//
+// The optional interrupt callback is polled periodically and verification is
+// aborted with errVerifyInterrupted if it returns true.
+func verifyState(diskdb ethdb.KeyValueStore, triedb *trie.Database, root common.Hash, interrupt func() bool) error {
+	accTrie, err := trie.New(root, triedb)
+	if err != nil {
+		return err
+	}
+	var (
+		accIt  = trie.NewIterator(accTrie.NodeIterator(nil))
+		snapIt = newSnapIterator(diskdb, rawdb.SnapshotAccountPrefix, 1+common.HashLength)
+		slotIt = newSnapIterator(diskdb, rawdb.SnapshotStoragePrefix, 1+2*common.HashLength)
+	)
+	defer snapIt.it.Release()
+	defer slotIt.it.Release()
+
+	for accIt.Next() {
+		if interrupt != nil && interrupt() {
+			return errVerifyInterrupted
+		}
+		// Ensure the snapshot contains the exact same account
+		if err := compareEntry("account", accIt.Key, accIt.Value, snapIt.key, snapIt.value); err != nil {
+			return err
+		}
+		snapIt.next()
+
+		// Any storage slot before the current account is dangling
+		if slotIt.key != nil && bytes.Compare(slotIt.key[:common.HashLength], accIt.Key) < 0 {
+			return fmt.Errorf("dangling storage slot %x in snapshot", slotIt.key)
+		}
+		var acc Account
+		if err := rlp.DecodeBytes(accIt.Value, &acc); err != nil {
+			return err
+		}
+		if acc.Root == emptyRoot {
+			continue
+		}
+		// Ensure the storage of the account matches the snapshot slot by slot
+		storeTrie, err := trie.New(acc.Root, triedb)
+		if err != nil {
+			return err
+		}
+		storeIt := trie.NewIterator(storeTrie.NodeIterator(nil))
+		for storeIt.Next() {
+			var key, value []byte
+			if slotIt.key != nil && bytes.Equal(slotIt.key[:common.HashLength], accIt.Key) {
+				key, value = slotIt.key, slotIt.value
+			}
+			if err := compareEntry("storage slot", append(common.CopyBytes(accIt.Key), storeIt.Key...), storeIt.Value, key, value); err != nil {
+				return err
+			}
+			slotIt.next()
+		}
+		if storeIt.Err != nil {
+			return storeIt.Err
+		}
+		// Any storage slot left for the current account is dangling
+		if slotIt.key != nil && bytes.Equal(slotIt.key[:common.HashLength], accIt.Key) {
+			return fmt.Errorf("dangling storage slot %x in snapshot", slotIt.key)
+		}
+	}
+	if accIt.Err != nil {
+		return accIt.Err
+	}
+	// All trie entries matched, make sure there's nothing left in the snapshot
+	if snapIt.key != nil {
+		return fmt.Errorf("dangling account %x in snapshot", snapIt.key)
+	}
+	if slotIt.key != nil {
+		return fmt.Errorf("dangling storage slot %x in snapshot", slotIt.key)
+	}
+	if err := snapIt.it.Error(); err != nil {
+		return err
+	}
+	return slotIt.it.Error()
+}
+
+// compareEntry checks that a trie entry and the snapshot entry at the current
+// iterator position are identical.
+func compareEntry(kind string, key, value []byte, snapKey, snapValue []byte) error {
+	switch cmp := bytes.Compare(snapKey, key); {
+	case snapKey == nil || cmp > 0:
+		return fmt.Errorf("%s %x missing from snapshot", kind, key)
+	case cmp < 0:
+		return fmt.Errorf("dangling %s %x in snapshot", kind, snapKey)
+	}
+	if !bytes.Equal(value, snapValue) {
+		return fmt.Errorf("%s %x mismatch: have %x, want %x", kind, key, snapValue, value)
+	}
+	return nil
+}
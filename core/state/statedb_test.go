@@ -32,6 +32,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
 )
 
@@ -449,3 +450,100 @@ func TestCopyOfCopy(t *testing.T) {
 		t.Fatalf("2nd copy fail, expected 42, got %v", got)
 	}
 }
+
+// Tests that state changes are propagated into the flat state snapshot on commit
+// and that the snapshot, once flattened, matches the state trie exactly.
+func TestSnapshotCommit(t *testing.T) {
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		sdb   = NewDatabase(db)
+		addr1 = common.BytesToAddress([]byte{0x01})
+		addr2 = common.BytesToAddress([]byte{0x02})
+		addr3 = common.BytesToAddress([]byte{0x03})
+		addr4 = common.BytesToAddress([]byte{0x04})
+	)
+	state, _ := New(common.Hash{}, sdb)
+	state.SetBalance(addr1, big.NewInt(1))
+	state.SetState(addr2, common.Hash{0x01}, common.Hash{0x11})
+	state.SetState(addr2, common.Hash{0x02}, common.Hash{0x22})
+	state.SetState(addr3, common.Hash{0x01}, common.Hash{0x33})
+	root, _ := state.Commit(false)
+	sdb.TrieDB().Commit(root, false)
+
+	snaps := snapshot.New(db, sdb.TrieDB(), 16, root, false)
+
+	// Modify the state on top of the snapshot, including a destruct-and-recreate
+	state, _ = NewWithSnapshot(root, sdb, snaps)
+	if have := state.GetState(addr2, common.Hash{0x02}); have != (common.Hash{0x22}) {
+		t.Fatalf("snapshot storage read mismatch: have %x, want %x", have, common.Hash{0x22})
+	}
+	state.SetState(addr2, common.Hash{0x01}, common.Hash{})
+	state.SetState(addr2, common.Hash{0x03}, common.Hash{0x44})
+	state.Suicide(addr3)
+	state.Finalise(true)
+	state.CreateAccount(addr3)
+	state.SetState(addr3, common.Hash{0x02}, common.Hash{0x55})
+	state.SetBalance(addr4, big.NewInt(4))
+
+	root, _ = state.Commit(true)
+	sdb.TrieDB().Commit(root, false)
+
+	if snaps.Snapshot(root) == nil {
+		t.Fatalf("snapshot not updated on commit")
+	}
+	// Reads through the diff layer must match the trie
+	snapState, _ := NewWithSnapshot(root, sdb, snaps)
+	trieState, _ := New(root, sdb)
+	for _, addr := range []common.Address{addr1, addr2, addr3, addr4} {
+		if have, want := snapState.GetBalance(addr), trieState.GetBalance(addr); have.Cmp(want) != 0 {
+			t.Errorf("%x: balance mismatch: have %v, want %v", addr, have, want)
+		}
+		for i := byte(1); i <= 3; i++ {
+			if have, want := snapState.GetState(addr, common.Hash{i}), trieState.GetState(addr, common.Hash{i}); have != want {
+				t.Errorf("%x: slot %d mismatch: have %x, want %x", addr, i, have, want)
+			}
+		}
+	}
+	// Flatten everything to disk and verify against the trie
+	if err := snaps.Cap(root, 0); err != nil {
+		t.Fatalf("failed to flatten snapshot: %v", err)
+	}
+	if err := snaps.Verify(root); err != nil {
+		t.Fatalf("flattened snapshot failed verification: %v", err)
+	}
+}
+
+// Tests that storage reads of an account destructed and resurrected within the
+// same block do not leak the pre-destruct slots out of the snapshot.
+func TestSnapshotDestructedStorage(t *testing.T) {
+	var (
+		db   = rawdb.NewMemoryDatabase()
+		sdb  = NewDatabase(db)
+		addr = common.BytesToAddress([]byte{0x01})
+	)
+	state, _ := New(common.Hash{}, sdb)
+	state.SetState(addr, common.Hash{0x01}, common.Hash{0x11})
+	state.SetState(addr, common.Hash{0x02}, common.Hash{0x22})
+	root, _ := state.Commit(false)
+	sdb.TrieDB().Commit(root, false)
+
+	snaps := snapshot.New(db, sdb.TrieDB(), 16, root, false)
+
+	snapState, _ := NewWithSnapshot(root, sdb, snaps)
+	trieState, _ := New(root, sdb)
+	for _, state := range []*StateDB{snapState, trieState} {
+		state.Suicide(addr)
+		state.Finalise(true)
+		state.CreateAccount(addr)
+		state.SetState(addr, common.Hash{0x02}, common.Hash{0x33})
+	}
+	for i := byte(1); i <= 3; i++ {
+		slot := common.Hash{i}
+		if have, want := snapState.GetState(addr, slot), trieState.GetState(addr, slot); have != want {
+			t.Errorf("slot %d mismatch: have %x, want %x", i, have, want)
+		}
+		if have, want := snapState.GetCommittedState(addr, slot), trieState.GetCommittedState(addr, slot); have != want {
+			t.Errorf("committed slot %d mismatch: have %x, want %x", i, have, want)
+		}
+	}
+}
@@ -177,12 +177,52 @@ func (st *StateTransition) preCheck() error {
 	return st.buyGas()
 }
 
+// ExecutionResult includes all output after executing a given EVM message,
+// regardless of whether the execution itself was successful or not.
+type ExecutionResult struct {
+	UsedGas    uint64 // Total used gas, after refunds
+	Err        error  // Any error encountered during the execution (listed in core/vm/errors.go)
+	ReturnData []byte // Data returned from the EVM (function result or data supplied with the revert opcode)
+}
+
+// Failed returns whether the execution failed with an EVM error.
+func (result *ExecutionResult) Failed() bool { return result.Err != nil }
+
+// Return is a helper function to retrieve the return data if the execution
+// succeeded, or nil otherwise.
+func (result *ExecutionResult) Return() []byte {
+	if result.Err != nil {
+		return nil
+	}
+	return common.CopyBytes(result.ReturnData)
+}
+
+// Revert returns the concrete revert data if the execution was aborted by the
+// REVERT opcode. Note the reason can be nil if no data was supplied with it.
+func (result *ExecutionResult) Revert() []byte {
+	if result.Err != vm.ErrExecutionReverted {
+		return nil
+	}
+	return common.CopyBytes(result.ReturnData)
+}
+
 // TransitionDb will transition the state by applying the current message and
 // returning the result including the used gas. It returns an error if failed.
 // An error indicates a consensus issue.
 func (st *StateTransition) TransitionDb() (ret []byte, usedGas uint64, failed bool, err error) {
-	if err = st.preCheck(); err != nil {
-		return
+	result, err := st.Execute()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	return result.ReturnData, result.UsedGas, result.Failed(), nil
+}
+
+// Execute transitions the state by applying the current message, returning the
+// full execution result including the EVM error, if any. Similarly to TransitionDb,
+// the returned error indicates a consensus issue.
+func (st *StateTransition) Execute() (*ExecutionResult, error) {
+	if err := st.preCheck(); err != nil {
+		return nil, err
 	}
 	msg := st.msg
 	sender := vm.AccountRef(msg.From())
@@ -192,10 +232,10 @@ func (st *StateTransition) TransitionDb() (ret []byte, usedGas uint64, failed bo
 	// Pay intrinsic gas
 	gas, err := IntrinsicGas(st.data, contractCreation, homestead)
 	if err != nil {
-		return nil, 0, false, err
+		return nil, err
 	}
 	if err = st.useGas(gas); err != nil {
-		return nil, 0, false, err
+		return nil, err
 	}
 
 	var (
@@ -204,6 +244,7 @@ func (st *StateTransition) TransitionDb() (ret []byte, usedGas uint64, failed bo
 		// not assigned to err, except for insufficient balance
 		// error.
 		vmerr error
+		ret   []byte
 	)
 	if contractCreation {
 		ret, _, st.gas, vmerr = evm.Create(sender, st.data, st.gas, st.value)
@@ -218,13 +259,17 @@ func (st *StateTransition) TransitionDb() (ret []byte, usedGas uint64, failed bo
 		// sufficient balance to make the transfer happen. The first
 		// balance transfer may never fail.
 		if vmerr == vm.ErrInsufficientBalance {
-			return nil, 0, false, vmerr
+			return nil, vmerr
 		}
 	}
 	st.refundGas()
 	st.state.AddBalance(st.evm.Coinbase, new(big.Int).Mul(new(big.Int).SetUint64(st.gasUsed()), st.gasPrice))
 
-	return ret, st.gasUsed(), vmerr != nil, err
+	return &ExecutionResult{
+		UsedGas:    st.gasUsed(),
+		Err:        vmerr,
+		ReturnData: ret,
+	}, nil
 }
 
 func (st *StateTransition) refundGas() {
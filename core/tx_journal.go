@@ -43,13 +43,15 @@ func (*devNull) Close() error                      { return nil }
 // txJournal is a rotating log of transactions with the aim of storing locally
 // created transactions to allow non-executed ones to survive node restarts.
 type txJournal struct {
+	kind   string         // Kind of the journaled transactions (local or remote), for logging
 	path   string         // Filesystem path to store the transactions at
 	writer io.WriteCloser // Output stream to write new transactions into
 }
 
 // newTxJournal creates a new transaction journal to
-func newTxJournal(path string) *txJournal {
+func newTxJournal(path string, kind string) *txJournal {
 	return &txJournal{
+		kind: kind,
 		path: path,
 	}
 }
@@ -111,7 +113,7 @@ func (journal *txJournal) load(add func([]*types.Transaction) []error) error {
 			batch = batch[:0]
 		}
 	}
-	log.Info("Loaded local transaction journal", "transactions", total, "dropped", dropped)
+	log.Info("Loaded transaction journal", "kind", journal.kind, "transactions", total, "dropped", dropped)
 
 	return failure
 }
@@ -138,16 +140,33 @@ func (journal *txJournal) rotate(all map[common.Address]types.Transactions) erro
 		journal.writer = nil
 	}
 	// Generate a new journal with the contents of the current pool
-	replacement, err := os.OpenFile(journal.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	journaled, err := journal.dump(all)
+	if err != nil {
+		return err
+	}
+	sink, err := os.OpenFile(journal.path, os.O_WRONLY|os.O_APPEND, 0755)
 	if err != nil {
 		return err
 	}
+	journal.writer = sink
+	log.Info("Regenerated transaction journal", "kind", journal.kind, "transactions", journaled, "accounts", len(all))
+
+	return nil
+}
+
+// dump atomically replaces the contents of the journal with the specified
+// transactions, returning the number of transactions written.
+func (journal *txJournal) dump(all map[common.Address]types.Transactions) (int, error) {
+	replacement, err := os.OpenFile(journal.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return 0, err
+	}
 	journaled := 0
 	for _, txs := range all {
 		for _, tx := range txs {
 			if err = rlp.Encode(replacement, tx); err != nil {
 				replacement.Close()
-				return err
+				return 0, err
 			}
 		}
 		journaled += len(txs)
@@ -156,16 +175,9 @@ func (journal *txJournal) rotate(all map[common.Address]types.Transactions) erro
 
 	// Replace the live journal with the newly generated one
 	if err = os.Rename(journal.path+".new", journal.path); err != nil {
-		return err
-	}
-	sink, err := os.OpenFile(journal.path, os.O_WRONLY|os.O_APPEND, 0755)
-	if err != nil {
-		return err
+		return 0, err
 	}
-	journal.writer = sink
-	log.Info("Regenerated local transaction journal", "transactions", journaled, "accounts", len(all))
-
-	return nil
+	return journaled, nil
 }
 
 // close flushes the transaction journal contents to disk and closes the file.
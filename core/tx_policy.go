@@ -0,0 +1,272 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	// ErrDeniedSender is returned if a transaction is sent from an account that
+	// the pool policy refuses to accept transactions from.
+	ErrDeniedSender = errors.New("sender denied by txpool policy")
+
+	// ErrDeniedRecipient is returned if a transaction is sent to an account that
+	// the pool policy refuses to accept transactions to.
+	ErrDeniedRecipient = errors.New("recipient denied by txpool policy")
+
+	// ErrDeniedSelector is returned if a transaction calls a contract method whose
+	// selector is refused by the pool policy.
+	ErrDeniedSelector = errors.New("method selector denied by txpool policy")
+)
+
+// TxFilter is an admission rule consulted by the transaction pool before a new
+// transaction is accepted. Filters run after the pool's own consensus and
+// pricing checks, so they only see otherwise valid transactions.
+type TxFilter interface {
+	// Name returns a short identifier of the filter, used for reporting.
+	Name() string
+
+	// Admit returns nil if the transaction may enter the pool, or the reason
+	// of the rejection otherwise. The local flag is set if the sender is
+	// considered local by the pool.
+	Admit(tx *types.Transaction, from common.Address, local bool) error
+}
+
+// TxOrdering assigns priorities to the senders of pending transactions. When a
+// block is assembled, all transactions of higher priority senders are included
+// before any lower priority ones, ordering by price and nonce within the same
+// priority.
+type TxOrdering interface {
+	// Name returns a short identifier of the ordering, used for reporting.
+	Name() string
+
+	// Priority returns the priority of the given sender, higher values being
+	// preferred. The local flag is set if the sender is considered local by the
+	// pool.
+	Priority(from common.Address, local bool) int
+}
+
+// TxAccountClass is a named group of accounts receiving the same treatment from
+// the transaction pool policy.
+type TxAccountClass struct {
+	Name       string           `json:"name"`
+	Accounts   []common.Address `json:"accounts"`
+	PriceLimit uint64           `json:"priceLimit" toml:",omitempty"` // Minimum gas price for non-local transactions of the class, replacing the pool default (0 = pool default)
+	Priority   int              `json:"priority" toml:",omitempty"`   // Block inclusion priority of the class (locals default to 1, others to 0)
+}
+
+// TxPolicyConfig contains the configurable admission and ordering rules of the
+// transaction pool.
+type TxPolicyConfig struct {
+	DenySenders    []common.Address `json:"denySenders" toml:",omitempty"`    // Accounts whose transactions are rejected
+	DenyRecipients []common.Address `json:"denyRecipients" toml:",omitempty"` // Accounts transactions may not be sent to
+	DenySelectors  []hexutil.Bytes  `json:"denySelectors" toml:",omitempty"`  // 4 byte contract method selectors that may not be called
+	Classes        []TxAccountClass `json:"classes" toml:",omitempty"`        // Account classes with custom price floors and priorities
+}
+
+// TxPolicy is the summary of the active transaction pool policy.
+type TxPolicy struct {
+	Filters  []string       `json:"filters"`
+	Ordering string         `json:"ordering"`
+	Config   TxPolicyConfig `json:"config"`
+}
+
+// newTxFilters creates the built-in admission filters configured by the policy.
+func newTxFilters(config *TxPolicyConfig) []TxFilter {
+	var filters []TxFilter
+	if len(config.DenySenders) > 0 {
+		filters = append(filters, &senderFilter{deny: newAddressSet(config.DenySenders)})
+	}
+	if len(config.DenyRecipients) > 0 {
+		filters = append(filters, &recipientFilter{deny: newAddressSet(config.DenyRecipients)})
+	}
+	if len(config.DenySelectors) > 0 {
+		filter := &selectorFilter{deny: make(map[[4]byte]struct{})}
+		for _, selector := range config.DenySelectors {
+			var id [4]byte
+			copy(id[:], selector)
+			filter.deny[id] = struct{}{}
+		}
+		filters = append(filters, filter)
+	}
+	if floors := newClassFloors(config); len(floors) > 0 {
+		filters = append(filters, &classPriceFilter{floors: floors})
+	}
+	return filters
+}
+
+// newClassFloors gathers the minimum gas prices of all the accounts belonging
+// to a class with a custom price limit. If an account is part of multiple
+// classes, the first one wins.
+func newClassFloors(config *TxPolicyConfig) map[common.Address]*big.Int {
+	floors := make(map[common.Address]*big.Int)
+	for _, class := range config.Classes {
+		if class.PriceLimit == 0 {
+			continue
+		}
+		for _, addr := range class.Accounts {
+			if _, ok := floors[addr]; !ok {
+				floors[addr] = new(big.Int).SetUint64(class.PriceLimit)
+			}
+		}
+	}
+	return floors
+}
+
+// newAddressSet converts a list of addresses into a lookup set.
+func newAddressSet(addrs []common.Address) map[common.Address]struct{} {
+	set := make(map[common.Address]struct{}, len(addrs))
+	for _, addr := range addrs {
+		set[addr] = struct{}{}
+	}
+	return set
+}
+
+// senderFilter rejects transactions originating from a denied set of accounts.
+type senderFilter struct {
+	deny map[common.Address]struct{}
+}
+
+func (f *senderFilter) Name() string { return "deny-senders" }
+
+func (f *senderFilter) Admit(tx *types.Transaction, from common.Address, local bool) error {
+	if _, ok := f.deny[from]; ok {
+		return ErrDeniedSender
+	}
+	return nil
+}
+
+// recipientFilter rejects transactions destined to a denied set of accounts.
+type recipientFilter struct {
+	deny map[common.Address]struct{}
+}
+
+func (f *recipientFilter) Name() string { return "deny-recipients" }
+
+func (f *recipientFilter) Admit(tx *types.Transaction, from common.Address, local bool) error {
+	if to := tx.To(); to != nil {
+		if _, ok := f.deny[*to]; ok {
+			return ErrDeniedRecipient
+		}
+	}
+	return nil
+}
+
+// selectorFilter rejects contract calls invoking a denied set of methods.
+type selectorFilter struct {
+	deny map[[4]byte]struct{}
+}
+
+func (f *selectorFilter) Name() string { return "deny-selectors" }
+
+func (f *selectorFilter) Admit(tx *types.Transaction, from common.Address, local bool) error {
+	if tx.To() == nil || len(tx.Data()) < 4 {
+		return nil
+	}
+	var id [4]byte
+	copy(id[:], tx.Data())
+	if _, ok := f.deny[id]; ok {
+		return ErrDeniedSelector
+	}
+	return nil
+}
+
+// classPriceFilter enforces the per class minimum gas prices on remote
+// transactions. The class limit replaces the pool wide price limit for the
+// accounts of the class, so it may be both above and below it.
+type classPriceFilter struct {
+	floors map[common.Address]*big.Int
+}
+
+func (f *classPriceFilter) Name() string { return "class-price-limit" }
+
+func (f *classPriceFilter) Admit(tx *types.Transaction, from common.Address, local bool) error {
+	if local {
+		return nil
+	}
+	if floor, ok := f.floors[from]; ok && floor.Cmp(tx.GasPrice()) > 0 {
+		return ErrUnderpriced
+	}
+	return nil
+}
+
+// classOrdering prioritises senders based on their account class, falling back
+// to preferring local accounts over remote ones.
+type classOrdering struct {
+	priorities map[common.Address]int
+}
+
+// newTxOrdering creates the built-in ordering configured by the policy.
+func newTxOrdering(config *TxPolicyConfig) *classOrdering {
+	ordering := &classOrdering{priorities: make(map[common.Address]int)}
+	for _, class := range config.Classes {
+		for _, addr := range class.Accounts {
+			if _, ok := ordering.priorities[addr]; !ok {
+				ordering.priorities[addr] = class.Priority
+			}
+		}
+	}
+	return ordering
+}
+
+func (o *classOrdering) Name() string {
+	if len(o.priorities) == 0 {
+		return "locals-first"
+	}
+	return "account-classes"
+}
+
+func (o *classOrdering) Priority(from common.Address, local bool) int {
+	if priority, ok := o.priorities[from]; ok {
+		return priority
+	}
+	if local {
+		return 1
+	}
+	return 0
+}
+
+// groupByPriority splits a set of pending transactions into groups of equal
+// sender priority, ordered from the highest priority to the lowest.
+func groupByPriority(pending map[common.Address]types.Transactions, priority func(common.Address) int) []map[common.Address]types.Transactions {
+	groups := make(map[int]map[common.Address]types.Transactions)
+	for addr, txs := range pending {
+		prio := priority(addr)
+		if groups[prio] == nil {
+			groups[prio] = make(map[common.Address]types.Transactions)
+		}
+		groups[prio][addr] = txs
+	}
+	prios := make([]int, 0, len(groups))
+	for prio := range groups {
+		prios = append(prios, prio)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(prios)))
+
+	ordered := make([]map[common.Address]types.Transactions, len(prios))
+	for i, prio := range prios {
+		ordered[i] = groups[prio]
+	}
+	return ordered
+}
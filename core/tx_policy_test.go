@@ -0,0 +1,290 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// setupPolicyTxPool creates a transaction pool with the given policy and funds
+// a number of test accounts in it.
+func setupPolicyTxPool(policy TxPolicyConfig, n int) (*TxPool, []*ecdsa.PrivateKey) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.Policy = policy
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := 0; i < n; i++ {
+		keys[i], _ = crypto.GenerateKey()
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000000))
+	}
+	return pool, keys
+}
+
+// callTransaction creates a signed transaction calling the given recipient with
+// the specified input data.
+func callTransaction(nonce uint64, to common.Address, data []byte, gasprice *big.Int, key *ecdsa.PrivateKey) *types.Transaction {
+	tx, _ := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(100), 100000, gasprice, data), types.HomesteadSigner{}, key)
+	return tx
+}
+
+// Tests that the deny list filters of the pool policy reject the matching
+// transactions, and only those.
+func TestTransactionPolicyDenyLists(t *testing.T) {
+	t.Parallel()
+
+	var (
+		denied   = common.HexToAddress("0xdead")
+		contract = common.HexToAddress("0xc0de")
+		selector = hexutil.Bytes{0xa9, 0x05, 0x9c, 0xbb}
+	)
+	pool, keys := setupPolicyTxPool(TxPolicyConfig{
+		DenyRecipients: []common.Address{denied},
+		DenySelectors:  []hexutil.Bytes{selector, {0x01}},
+	}, 2)
+	defer pool.Stop()
+
+	// Deny the second sender after creation to exercise custom filters too
+	pool.AddFilter(&senderFilter{deny: newAddressSet([]common.Address{crypto.PubkeyToAddress(keys[1].PublicKey)})})
+
+	tests := []struct {
+		tx  *types.Transaction
+		err error
+	}{
+		{callTransaction(0, denied, nil, big.NewInt(1), keys[0]), ErrDeniedRecipient},
+		{callTransaction(0, contract, append(selector, 0x00), big.NewInt(1), keys[0]), ErrDeniedSelector},
+		{callTransaction(0, contract, []byte{0xa9, 0x05, 0x9c}, big.NewInt(1), keys[0]), nil},
+		{callTransaction(1, contract, []byte{0x01, 0x00, 0x00, 0x00}, big.NewInt(1), keys[0]), nil},
+		{callTransaction(0, contract, nil, big.NewInt(1), keys[1]), ErrDeniedSender},
+	}
+	for i, tt := range tests {
+		if err := pool.AddRemote(tt.tx); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	if pending, _ := pool.Stats(); pending != 2 {
+		t.Errorf("pending transactions mismatch: have %d, want %d", pending, 2)
+	}
+	// The invalid selector should have been dropped during sanitization
+	policy := pool.Policy()
+	if len(policy.Config.DenySelectors) != 1 {
+		t.Errorf("sanitized selector count mismatch: have %d, want %d", len(policy.Config.DenySelectors), 1)
+	}
+	want := []string{"deny-recipients", "deny-selectors", "deny-senders"}
+	if len(policy.Filters) != len(want) {
+		t.Fatalf("filter count mismatch: have %v, want %v", policy.Filters, want)
+	}
+	for i, name := range want {
+		if policy.Filters[i] != name {
+			t.Errorf("filter %d: name mismatch: have %s, want %s", i, policy.Filters[i], name)
+		}
+	}
+}
+
+// Tests that the per class price limits are enforced on remote transactions,
+// but local ones are exempt.
+func TestTransactionPolicyClassPriceLimit(t *testing.T) {
+	t.Parallel()
+
+	var (
+		premiumKey, _ = crypto.GenerateKey()
+		otherKey, _   = crypto.GenerateKey()
+		premium       = crypto.PubkeyToAddress(premiumKey.PublicKey)
+		other         = crypto.PubkeyToAddress(otherKey.PublicKey)
+	)
+	pool, _ := setupPolicyTxPool(TxPolicyConfig{
+		Classes: []TxAccountClass{{Name: "premium", Accounts: []common.Address{premium}, PriceLimit: 100}},
+	}, 0)
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(premium, big.NewInt(1000000000))
+	pool.currentState.AddBalance(other, big.NewInt(1000000000))
+
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(99), premiumKey)); err != ErrUnderpriced {
+		t.Errorf("underpriced class transaction error mismatch: have %v, want %v", err, ErrUnderpriced)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(100), premiumKey)); err != nil {
+		t.Errorf("failed to add class transaction at price limit: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(1), otherKey)); err != nil {
+		t.Errorf("failed to add classless transaction: %v", err)
+	}
+	if err := pool.AddLocal(pricedTransaction(1, 100000, big.NewInt(1), premiumKey)); err != nil {
+		t.Errorf("failed to add underpriced local class transaction: %v", err)
+	}
+}
+
+// Tests that a class price limit below the pool wide one admits remote class
+// transactions the pool would otherwise reject.
+func TestTransactionPolicyClassPriceLimitBelowPool(t *testing.T) {
+	t.Parallel()
+
+	var (
+		discountKey, _ = crypto.GenerateKey()
+		otherKey, _    = crypto.GenerateKey()
+		discount       = crypto.PubkeyToAddress(discountKey.PublicKey)
+		other          = crypto.PubkeyToAddress(otherKey.PublicKey)
+	)
+	pool, _ := setupPolicyTxPool(TxPolicyConfig{
+		Classes: []TxAccountClass{{Name: "discount", Accounts: []common.Address{discount}, PriceLimit: 5}},
+	}, 0)
+	defer pool.Stop()
+
+	pool.SetGasPrice(big.NewInt(10))
+
+	pool.currentState.AddBalance(discount, big.NewInt(1000000000))
+	pool.currentState.AddBalance(other, big.NewInt(1000000000))
+
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(4), discountKey)); err != ErrUnderpriced {
+		t.Errorf("underpriced class transaction error mismatch: have %v, want %v", err, ErrUnderpriced)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(5), discountKey)); err != nil {
+		t.Errorf("failed to add class transaction below pool price limit: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(5), otherKey)); err != ErrUnderpriced {
+		t.Errorf("underpriced classless transaction error mismatch: have %v, want %v", err, ErrUnderpriced)
+	}
+}
+
+// Tests that account class price limits are also enforced when the pool is full,
+// even if the transaction would outbid the cheapest one tracked.
+func TestTransactionPolicyClassUnderpricing(t *testing.T) {
+	t.Parallel()
+
+	premiumKey, _ := crypto.GenerateKey()
+	premium := crypto.PubkeyToAddress(premiumKey.PublicKey)
+
+	pool, keys := setupPolicyTxPool(TxPolicyConfig{
+		Classes: []TxAccountClass{{Name: "premium", Accounts: []common.Address{premium}, PriceLimit: 5}},
+	}, 2)
+	defer pool.Stop()
+
+	pool.config.GlobalSlots = 2
+	pool.config.GlobalQueue = 0
+	pool.currentState.AddBalance(premium, big.NewInt(1000000000))
+
+	// Fill the pool with cheap remote transactions
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(1), keys[0])); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(2), keys[1])); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	// A class transaction below its own price limit must be rejected, even though
+	// it pays more than the cheapest transaction in the pool
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(4), premiumKey)); err != ErrUnderpriced {
+		t.Errorf("underpriced class transaction error mismatch: have %v, want %v", err, ErrUnderpriced)
+	}
+	// A class transaction meeting its price limit must evict the cheapest one
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(5), premiumKey)); err != nil {
+		t.Fatalf("failed to add class transaction to full pool: %v", err)
+	}
+	if pool.Get(pricedTransaction(0, 100000, big.NewInt(1), keys[0]).Hash()) != nil {
+		t.Errorf("cheapest remote transaction not evicted from full pool")
+	}
+	if pool.Get(pricedTransaction(0, 100000, big.NewInt(2), keys[1]).Hash()) == nil {
+		t.Errorf("pricier remote transaction evicted from full pool")
+	}
+}
+
+// testOrdering is a custom ordering preferring a single sender.
+type testOrdering struct {
+	favourite common.Address
+}
+
+func (o *testOrdering) Name() string { return "test" }
+
+func (o *testOrdering) Priority(from common.Address, local bool) int {
+	if from == o.favourite {
+		return 10
+	}
+	return 0
+}
+
+// Tests that pending transactions are grouped according to the pool ordering,
+// both the built-in class based one and custom ones.
+func TestTransactionPolicyOrdering(t *testing.T) {
+	t.Parallel()
+
+	var (
+		keys  = make([]*ecdsa.PrivateKey, 3)
+		addrs = make([]common.Address, 3)
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	pool, _ := setupPolicyTxPool(TxPolicyConfig{
+		Classes: []TxAccountClass{{Name: "relayer", Accounts: []common.Address{addrs[2]}, Priority: 5}},
+	}, 0)
+	defer pool.Stop()
+
+	for _, addr := range addrs {
+		pool.currentState.AddBalance(addr, big.NewInt(1000000000))
+	}
+	if err := pool.AddRemote(transaction(0, 100000, keys[0])); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	if err := pool.AddLocal(transaction(0, 100000, keys[1])); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.AddRemote(transaction(0, 100000, keys[2])); err != nil {
+		t.Fatalf("failed to add relayer transaction: %v", err)
+	}
+	check := func(want ...common.Address) error {
+		groups, _ := pool.PendingByPriority()
+		if len(groups) != len(want) {
+			return errors.New("group count mismatch")
+		}
+		for i, addr := range want {
+			if _, ok := groups[i][addr]; !ok || len(groups[i]) != 1 {
+				return errors.New("group content mismatch")
+			}
+		}
+		return nil
+	}
+	if name := pool.Policy().Ordering; name != "account-classes" {
+		t.Errorf("ordering name mismatch: have %s, want %s", name, "account-classes")
+	}
+	if err := check(addrs[2], addrs[1], addrs[0]); err != nil {
+		t.Errorf("class ordering: %v", err)
+	}
+	pool.SetOrdering(&testOrdering{favourite: addrs[0]})
+	groups, _ := pool.PendingByPriority()
+	if len(groups) != 2 || len(groups[0]) != 1 || len(groups[1]) != 2 {
+		t.Fatalf("custom ordering group mismatch: %v", groups)
+	}
+	if _, ok := groups[0][addrs[0]]; !ok {
+		t.Errorf("custom ordering favourite not first")
+	}
+}
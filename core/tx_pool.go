@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/prque"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -99,6 +100,12 @@ var (
 	// General tx metrics
 	invalidTxCounter     = metrics.NewRegisteredCounter("txpool/invalid", nil)
 	underpricedTxCounter = metrics.NewRegisteredCounter("txpool/underpriced", nil)
+
+	// Metrics for the remote transaction journal
+	remoteJournalStoredGauge    = metrics.NewRegisteredGauge("txpool/journal/remote/stored", nil)
+	remoteJournalOmittedCounter = metrics.NewRegisteredCounter("txpool/journal/remote/omitted", nil) // Not stored due to the size limit
+	remoteJournalLoadedCounter  = metrics.NewRegisteredCounter("txpool/journal/remote/loaded", nil)
+	remoteJournalDroppedCounter = metrics.NewRegisteredCounter("txpool/journal/remote/dropped", nil) // Invalid against the new head
 )
 
 // TxStatus is the current status of a transaction as seen by the pool.
@@ -128,6 +135,9 @@ type TxPoolConfig struct {
 	Journal   string           // Journal of local transactions to survive node restarts
 	Rejournal time.Duration    // Time interval to regenerate the local transaction journal
 
+	RemoteJournal     string // Snapshot of remote transactions to survive node restarts (empty = disabled)
+	RemoteJournalSize uint64 // Maximum total size of the transactions in the remote snapshot in bytes
+
 	PriceLimit uint64 // Minimum gas price to enforce for acceptance into the pool
 	PriceBump  uint64 // Minimum price bump percentage to replace an already existing transaction (nonce)
 
@@ -137,6 +147,8 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	Policy TxPolicyConfig // Admission and ordering rules beyond the pricing limits
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -145,6 +157,8 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	Journal:   "transactions.rlp",
 	Rejournal: time.Hour,
 
+	RemoteJournalSize: 64 * 1024 * 1024,
+
 	PriceLimit: 1,
 	PriceBump:  10,
 
@@ -164,6 +178,10 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool journal time", "provided", conf.Rejournal, "updated", time.Second)
 		conf.Rejournal = time.Second
 	}
+	if conf.RemoteJournalSize < 1 {
+		log.Warn("Sanitizing invalid txpool remote journal size", "provided", conf.RemoteJournalSize, "updated", DefaultTxPoolConfig.RemoteJournalSize)
+		conf.RemoteJournalSize = DefaultTxPoolConfig.RemoteJournalSize
+	}
 	if conf.PriceLimit < 1 {
 		log.Warn("Sanitizing invalid txpool price limit", "provided", conf.PriceLimit, "updated", DefaultTxPoolConfig.PriceLimit)
 		conf.PriceLimit = DefaultTxPoolConfig.PriceLimit
@@ -192,6 +210,17 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool lifetime", "provided", conf.Lifetime, "updated", DefaultTxPoolConfig.Lifetime)
 		conf.Lifetime = DefaultTxPoolConfig.Lifetime
 	}
+	if len(conf.Policy.DenySelectors) > 0 {
+		selectors := make([]hexutil.Bytes, 0, len(conf.Policy.DenySelectors))
+		for _, selector := range conf.Policy.DenySelectors {
+			if len(selector) != 4 {
+				log.Warn("Dropping invalid txpool denied selector", "selector", selector)
+				continue
+			}
+			selectors = append(selectors, selector)
+		}
+		conf.Policy.DenySelectors = selectors
+	}
 	return conf
 }
 
@@ -218,8 +247,9 @@ type TxPool struct {
 	pendingState  *state.ManagedState // Pending state tracking virtual nonces
 	currentMaxGas uint64              // Current gas limit for transaction caps
 
-	locals  *accountSet // Set of local transaction to exempt from eviction rules
-	journal *txJournal  // Journal of local transaction to back up to disk
+	locals        *accountSet // Set of local transaction to exempt from eviction rules
+	journal       *txJournal  // Journal of local transaction to back up to disk
+	remoteJournal *txJournal  // Snapshot of remote transactions to back up to disk
 
 	pending map[common.Address]*txList   // All currently processable transactions
 	queue   map[common.Address]*txList   // Queued but non-processable transactions
@@ -227,6 +257,10 @@ type TxPool struct {
 	all     *txLookup                    // All transactions to allow lookups
 	priced  *txPricedList                // All transactions sorted by price
 
+	filters  []TxFilter                  // Admission filters run on every new transaction
+	floors   map[common.Address]*big.Int // Account class price limits overriding the pool's own
+	ordering TxOrdering                  // Sender prioritisation of the pending transactions
+
 	wg sync.WaitGroup // for shutdown sync
 
 	homestead bool
@@ -256,12 +290,15 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		log.Info("Setting new local account", "address", addr)
 		pool.locals.add(addr)
 	}
+	pool.filters = newTxFilters(&config.Policy)
+	pool.floors = newClassFloors(&config.Policy)
+	pool.ordering = newTxOrdering(&config.Policy)
 	pool.priced = newTxPricedList(pool.all)
 	pool.reset(nil, chain.CurrentBlock().Header())
 
 	// If local transactions and journaling is enabled, load from disk
 	if !config.NoLocals && config.Journal != "" {
-		pool.journal = newTxJournal(config.Journal)
+		pool.journal = newTxJournal(config.Journal, "local")
 
 		if err := pool.journal.load(pool.AddLocals); err != nil {
 			log.Warn("Failed to load transaction journal", "err", err)
@@ -270,6 +307,15 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 			log.Warn("Failed to rotate transaction journal", "err", err)
 		}
 	}
+	// If remote transaction journaling is enabled, reload the last snapshot. The
+	// transactions are re-validated against the current head like any other.
+	if config.RemoteJournal != "" {
+		pool.remoteJournal = newTxJournal(config.RemoteJournal, "remote")
+
+		if err := pool.remoteJournal.load(pool.addJournaledRemotes); err != nil {
+			log.Warn("Failed to load remote transaction journal", "err", err)
+		}
+	}
 	// Subscribe events from blockchain
 	pool.chainHeadSub = pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh)
 
@@ -358,6 +404,9 @@ func (pool *TxPool) loop() {
 				}
 				pool.mu.Unlock()
 			}
+			if pool.remoteJournal != nil {
+				pool.snapshotRemotes()
+			}
 		}
 	}
 }
@@ -482,6 +531,9 @@ func (pool *TxPool) Stop() {
 	if pool.journal != nil {
 		pool.journal.close()
 	}
+	if pool.remoteJournal != nil {
+		pool.snapshotRemotes()
+	}
 	log.Info("Transaction pool stopped")
 }
 
@@ -574,6 +626,23 @@ func (pool *TxPool) Pending() (map[common.Address]types.Transactions, error) {
 	return pending, nil
 }
 
+// PendingByPriority retrieves the same transactions as Pending, but splits the
+// accounts into groups of equal sender priority according to the pool's ordering
+// policy. The groups are returned from the highest priority to the lowest, and
+// are meant to be included into blocks in that order.
+func (pool *TxPool) PendingByPriority() ([]map[common.Address]types.Transactions, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pending := make(map[common.Address]types.Transactions)
+	for addr, list := range pool.pending {
+		pending[addr] = list.Flatten()
+	}
+	return groupByPriority(pending, func(addr common.Address) int {
+		return pool.ordering.Priority(addr, pool.locals.contains(addr))
+	}), nil
+}
+
 // Locals retrieves the accounts currently considered local by the pool.
 func (pool *TxPool) Locals() []common.Address {
 	pool.mu.Lock()
@@ -582,6 +651,39 @@ func (pool *TxPool) Locals() []common.Address {
 	return pool.locals.flatten()
 }
 
+// AddFilter registers an additional admission filter with the pool. The filter
+// only applies to transactions arriving after the call.
+func (pool *TxPool) AddFilter(filter TxFilter) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.filters = append(pool.filters, filter)
+}
+
+// SetOrdering replaces the sender prioritisation used by PendingByPriority.
+func (pool *TxPool) SetOrdering(ordering TxOrdering) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.ordering = ordering
+}
+
+// Policy retrieves a summary of the admission and ordering rules of the pool.
+func (pool *TxPool) Policy() TxPolicy {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	policy := TxPolicy{
+		Filters:  make([]string, 0, len(pool.filters)),
+		Ordering: pool.ordering.Name(),
+		Config:   pool.config.Policy,
+	}
+	for _, filter := range pool.filters {
+		policy.Filters = append(policy.Filters, filter.Name())
+	}
+	return policy
+}
+
 // local retrieves all currently known local transactions, grouped by origin
 // account and sorted by nonce. The returned transaction set is a copy and can be
 // freely modified by calling code.
@@ -598,6 +700,79 @@ func (pool *TxPool) local() map[common.Address]types.Transactions {
 	return txs
 }
 
+// remote retrieves the remote transactions currently in the pool, limited to the
+// configured remote journal size. Executable transactions are retained in favour
+// of queued ones, and within those the accounts paying the highest price for their
+// next transaction. The number of transactions omitted due to the limit is also
+// returned.
+func (pool *TxPool) remote() (map[common.Address]types.Transactions, int) {
+	type accountTxs struct {
+		addr common.Address
+		txs  types.Transactions
+	}
+	collect := func(lists map[common.Address]*txList) []accountTxs {
+		accounts := make([]accountTxs, 0, len(lists))
+		for addr, list := range lists {
+			if !pool.locals.contains(addr) {
+				accounts = append(accounts, accountTxs{addr, list.Flatten()})
+			}
+		}
+		sort.Slice(accounts, func(i, j int) bool {
+			return accounts[i].txs[0].GasPrice().Cmp(accounts[j].txs[0].GasPrice()) > 0
+		})
+		return accounts
+	}
+	var (
+		txs     = make(map[common.Address]types.Transactions)
+		size    uint64
+		omitted int
+	)
+	for _, accounts := range [][]accountTxs{collect(pool.pending), collect(pool.queue)} {
+		for _, account := range accounts {
+			for i, tx := range account.txs {
+				if size+uint64(tx.Size()) > pool.config.RemoteJournalSize {
+					omitted += len(account.txs) - i
+					break
+				}
+				size += uint64(tx.Size())
+				txs[account.addr] = append(txs[account.addr], tx)
+			}
+		}
+	}
+	return txs, omitted
+}
+
+// snapshotRemotes regenerates the remote transaction journal from the current
+// contents of the pool.
+func (pool *TxPool) snapshotRemotes() {
+	pool.mu.Lock()
+	remotes, omitted := pool.remote()
+	pool.mu.Unlock()
+
+	stored, err := pool.remoteJournal.dump(remotes)
+	if err != nil {
+		log.Warn("Failed to snapshot remote transactions", "err", err)
+		return
+	}
+	remoteJournalStoredGauge.Update(int64(stored))
+	remoteJournalOmittedCounter.Inc(int64(omitted))
+	log.Info("Regenerated transaction journal", "kind", "remote", "transactions", stored, "accounts", len(remotes), "omitted", omitted)
+}
+
+// addJournaledRemotes adds the transactions loaded from the remote journal to the
+// pool, tracking how many of them are still valid.
+func (pool *TxPool) addJournaledRemotes(txs []*types.Transaction) []error {
+	errs := pool.AddRemotes(txs)
+	for _, err := range errs {
+		if err != nil {
+			remoteJournalDroppedCounter.Inc(1)
+		} else {
+			remoteJournalLoadedCounter.Inc(1)
+		}
+	}
+	return errs
+}
+
 // validateTx checks whether a transaction is valid according to the consensus
 // rules and adheres to some heuristic limits of the local node (price and size).
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
@@ -619,11 +794,18 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if err != nil {
 		return ErrInvalidSender
 	}
-	// Drop non-local transactions under our own minimal accepted gas price
+	// Drop non-local transactions under our own minimal accepted gas price. Accounts
+	// with a class price limit are checked against that by the policy filters.
 	local = local || pool.locals.contains(from) // account may be local even if the transaction arrived from the network
-	if !local && pool.gasPrice.Cmp(tx.GasPrice()) > 0 {
+	if _, classed := pool.floors[from]; !local && !classed && pool.gasPrice.Cmp(tx.GasPrice()) > 0 {
 		return ErrUnderpriced
 	}
+	// Run the transaction through any admission filters of the pool policy
+	for _, filter := range pool.filters {
+		if err := filter.Admit(tx, from, local); err != nil {
+			return err
+		}
+	}
 	// Ensure the transaction adheres to nonce ordering
 	if pool.currentState.GetNonce(from) > tx.Nonce() {
 		return ErrNonceTooLow
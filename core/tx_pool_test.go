@@ -23,6 +23,7 @@ import (
 	"math/big"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -1680,6 +1681,115 @@ func testTransactionJournaling(t *testing.T, nolocals bool) {
 	pool.Stop()
 }
 
+// Tests that remote transactions are snapshotted to disk if enabled, and that they
+// are re-validated against the new head when loaded.
+func TestTransactionRemoteJournaling(t *testing.T) {
+	t.Parallel()
+
+	// Create a temporary directory for the remote journal
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.RemoteJournal = filepath.Join(dir, "remotes.rlp")
+	config.Rejournal = time.Second
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+
+	local, _ := crypto.GenerateKey()
+	remote, _ := crypto.GenerateKey()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(local.PublicKey), big.NewInt(1000000000))
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(remote.PublicKey), big.NewInt(1000000000))
+
+	// Add a local and three remote transactions, one of them gapped
+	if err := pool.AddLocal(pricedTransaction(0, 100000, big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	for _, nonce := range []uint64{0, 1, 3} {
+		if err := pool.AddRemote(pricedTransaction(nonce, 100000, big.NewInt(1), remote)); err != nil {
+			t.Fatalf("failed to add remote transaction %d: %v", nonce, err)
+		}
+	}
+	if pending, queued := pool.Stats(); pending != 3 || queued != 1 {
+		t.Fatalf("pool stats mismatch: have %d/%d, want %d/%d", pending, queued, 3, 1)
+	}
+	// Restart the pool after the first remote transaction was included, only the
+	// remaining remote transactions should survive
+	pool.Stop()
+	statedb.SetNonce(crypto.PubkeyToAddress(remote.PublicKey), 1)
+	blockchain = &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	pool = NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	if pending, queued := pool.Stats(); pending != 1 || queued != 1 {
+		t.Fatalf("pool stats mismatch: have %d/%d, want %d/%d", pending, queued, 1, 1)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the remote transaction snapshot is limited in size, retaining the
+// executable transactions of the best paying accounts.
+func TestTransactionRemoteJournalLimit(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := 0; i < len(keys); i++ {
+		keys[i], _ = crypto.GenerateKey()
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000000))
+	}
+	// Add two executable transactions for each account at increasing prices, and
+	// a queued one for the best paying account
+	var size uint64
+	for i, key := range keys {
+		for nonce := uint64(0); nonce < 2; nonce++ {
+			tx := pricedTransaction(nonce, 100000, big.NewInt(int64(i+1)), key)
+			if err := pool.AddRemote(tx); err != nil {
+				t.Fatalf("failed to add remote transaction: %v", err)
+			}
+			size = uint64(tx.Size())
+		}
+	}
+	if err := pool.AddRemote(pricedTransaction(5, 100000, big.NewInt(3), keys[2])); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	// Limit the snapshot to three transactions: both executable ones of the best
+	// paying account and the first one of the second best
+	pool.config.RemoteJournalSize = 3 * size
+
+	pool.mu.Lock()
+	remotes, omitted := pool.remote()
+	pool.mu.Unlock()
+
+	if omitted != 4 {
+		t.Errorf("omitted transactions mismatch: have %d, want %d", omitted, 4)
+	}
+	if txs := remotes[crypto.PubkeyToAddress(keys[2].PublicKey)]; len(txs) != 2 || txs[1].Nonce() != 1 {
+		t.Errorf("best account transactions mismatch: have %d", len(txs))
+	}
+	if txs := remotes[crypto.PubkeyToAddress(keys[1].PublicKey)]; len(txs) != 1 || txs[0].Nonce() != 0 {
+		t.Errorf("second account transactions mismatch: have %d", len(txs))
+	}
+	if txs := remotes[crypto.PubkeyToAddress(keys[0].PublicKey)]; len(txs) != 0 {
+		t.Errorf("worst account transactions mismatch: have %d", len(txs))
+	}
+}
+
 // TestTransactionStatusCheck tests that the pool can correctly retrieve the
 // pending status of individual transactions.
 func TestTransactionStatusCheck(t *testing.T) {
@@ -0,0 +1,399 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// defaultBundleTimeout is the amount of time an entire bundle can execute by
+// default before being forcefully aborted.
+const defaultBundleTimeout = 5 * time.Second
+
+// BundleCall is a single entry of a simulated bundle. It is either a signed raw
+// transaction (if Raw is set) or a plain call message described by the embedded
+// call arguments.
+type BundleCall struct {
+	ethapi.CallArgs
+	Raw *hexutil.Bytes `json:"raw"`
+}
+
+// CallBundleConfig holds extra parameters to bundle simulation.
+type CallBundleConfig struct {
+	TxIndex *uint64 // Simulate before this transaction of the block instead of after the block
+	Timeout *string // Maximum time the entire bundle may execute
+	Reexec  *uint64 // Number of blocks to reexecute to regenerate missing state
+}
+
+// bundleCallResult is the outcome of a single bundle entry.
+type bundleCallResult struct {
+	TxHash     *common.Hash   `json:"txHash,omitempty"` // Hash of the entry if it was a signed transaction
+	GasUsed    hexutil.Uint64 `json:"gasUsed"`
+	ReturnData hexutil.Bytes  `json:"returnData"`
+	Logs       []*types.Log   `json:"logs"`
+	Failed     bool           `json:"failed"`
+	Revert     hexutil.Bytes  `json:"revert,omitempty"`       // Raw revert data if the execution was reverted
+	Reason     string         `json:"revertReason,omitempty"` // Decoded Error(string) reason of the revert, if any
+}
+
+// diffPair is the value of an account field before and after a bundle.
+type diffPair struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// bundleAccountDiff is the modification of a single account caused by a bundle.
+// Fields that were left untouched are omitted.
+type bundleAccountDiff struct {
+	Balance *diffPair                 `json:"balance,omitempty"`
+	Nonce   *diffPair                 `json:"nonce,omitempty"`
+	Code    *diffPair                 `json:"code,omitempty"`
+	Storage map[common.Hash]*diffPair `json:"storage,omitempty"`
+}
+
+// CallBundleResult is the result of simulating an entire bundle.
+type CallBundleResult struct {
+	BlockNumber hexutil.Uint64                        `json:"blockNumber"`
+	BlockHash   common.Hash                           `json:"blockHash"`
+	GasUsed     hexutil.Uint64                        `json:"gasUsed"`
+	Results     []*bundleCallResult                   `json:"results"`
+	StateDiff   map[common.Address]*bundleAccountDiff `json:"stateDiff"`
+}
+
+// CallBundle executes an ordered list of transactions and call messages on top
+// of the state of the requested block, each entry seeing the modifications of
+// the previous ones. No changes are persisted. It returns the per entry results
+// as well as the cumulative state diff of the whole bundle.
+func (api *PrivateDebugAPI) CallBundle(ctx context.Context, calls []BundleCall, number rpc.BlockNumber, config *CallBundleConfig) (*CallBundleResult, error) {
+	if len(calls) == 0 {
+		return nil, errors.New("empty bundle")
+	}
+	// Fetch the block that we want to simulate on top of
+	var (
+		block   *types.Block
+		statedb *state.StateDB
+	)
+	switch number {
+	case rpc.PendingBlockNumber:
+		block, statedb = api.eth.miner.Pending()
+	case rpc.LatestBlockNumber:
+		block = api.eth.blockchain.CurrentBlock()
+	default:
+		block = api.eth.blockchain.GetBlockByNumber(uint64(number))
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return api.callBundle(ctx, calls, block, statedb, config)
+}
+
+// CallBundleByHash executes an ordered list of transactions and call messages on
+// top of the state of the block with the given hash.
+func (api *PrivateDebugAPI) CallBundleByHash(ctx context.Context, calls []BundleCall, hash common.Hash, config *CallBundleConfig) (*CallBundleResult, error) {
+	if len(calls) == 0 {
+		return nil, errors.New("empty bundle")
+	}
+	block := api.eth.blockchain.GetBlockByHash(hash)
+	if block == nil {
+		return nil, fmt.Errorf("block %#x not found", hash)
+	}
+	return api.callBundle(ctx, calls, block, nil, config)
+}
+
+// callBundle assembles the execution environment of a bundle and runs all of its
+// entries sequentially. If statedb is non-nil, it is used as the starting state
+// instead of regenerating it from the block.
+func (api *PrivateDebugAPI) callBundle(ctx context.Context, calls []BundleCall, block *types.Block, statedb *state.StateDB, config *CallBundleConfig) (*CallBundleResult, error) {
+	var (
+		reexec  = defaultTraceReexec
+		timeout = defaultBundleTimeout
+		header  = block.Header()
+		err     error
+	)
+	if config != nil && config.Reexec != nil {
+		reexec = *config.Reexec
+	}
+	if config != nil && config.Timeout != nil {
+		if timeout, err = time.ParseDuration(*config.Timeout); err != nil {
+			return nil, err
+		}
+	}
+	// Retrieve the state the bundle should be executed on
+	switch {
+	case config != nil && config.TxIndex != nil:
+		if *config.TxIndex >= uint64(len(block.Transactions())) {
+			return nil, fmt.Errorf("transaction index %d out of range for block %#x", *config.TxIndex, block.Hash())
+		}
+		if _, _, statedb, err = api.computeTxEnv(block.Hash(), int(*config.TxIndex), reexec); err != nil {
+			return nil, err
+		}
+	case statedb != nil:
+		statedb = statedb.Copy()
+	default:
+		if statedb, err = api.computeStateDB(block, reexec); err != nil {
+			return nil, err
+		}
+	}
+	// Setup context so it may be cancelled once the bundle has completed
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		chainConfig = api.eth.blockchain.Config()
+		signer      = types.MakeSigner(chainConfig, block.Number())
+		tracer      = newBundleAccessTracer()
+		prestate    = statedb.Copy()
+		result      = &CallBundleResult{
+			BlockNumber: hexutil.Uint64(block.NumberU64()),
+			BlockHash:   block.Hash(),
+			Results:     make([]*bundleCallResult, 0, len(calls)),
+		}
+	)
+	tracer.touch(header.Coinbase)
+
+	for i, call := range calls {
+		msg, txhash, err := api.bundleMessage(call, header, statedb, signer)
+		if err != nil {
+			return nil, fmt.Errorf("bundle entry %d: %v", i, err)
+		}
+		statedb.Prepare(txhash, block.Hash(), i)
+
+		vmctx := core.NewEVMContext(msg, header, api.eth.blockchain, nil)
+		vmenv := vm.NewEVM(vmctx, statedb, chainConfig, vm.Config{Debug: true, Tracer: tracer})
+
+		// Wait for the context to be done and cancel the evm. Even if the
+		// EVM has finished, cancelling may be done (repeatedly)
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				vmenv.Cancel()
+			case <-done:
+			}
+		}()
+		exec, err := core.NewStateTransition(vmenv, msg, new(core.GasPool).AddGas(math.MaxUint64)).Execute()
+		close(done)
+
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("bundle execution aborted (timeout = %v)", timeout)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bundle entry %d failed: %v", i, err)
+		}
+		// Ensure any modifications are visible to the next entry
+		statedb.Finalise(chainConfig.IsEIP158(block.Number()))
+
+		res := &bundleCallResult{
+			GasUsed:    hexutil.Uint64(exec.UsedGas),
+			ReturnData: exec.ReturnData,
+			Logs:       statedb.GetLogs(txhash),
+			Failed:     exec.Failed(),
+		}
+		if res.Logs == nil {
+			res.Logs = []*types.Log{}
+		}
+		if call.Raw != nil {
+			res.TxHash = &txhash
+		}
+		if exec.Err == vm.ErrExecutionReverted {
+			res.Revert = exec.Revert()
+			if reason, err := abi.UnpackRevert(res.Revert); err == nil {
+				res.Reason = reason
+			}
+		}
+		result.GasUsed += res.GasUsed
+		result.Results = append(result.Results, res)
+	}
+	result.StateDiff = tracer.diff(prestate, statedb)
+	return result, nil
+}
+
+// bundleMessage converts a bundle entry into a message executable by the EVM,
+// also returning the hash logs generated by the entry should be filed under.
+func (api *PrivateDebugAPI) bundleMessage(call BundleCall, header *types.Header, statedb *state.StateDB, signer types.Signer) (core.Message, common.Hash, error) {
+	// If the entry is a signed transaction, decode and use it as is
+	if call.Raw != nil {
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(*call.Raw, tx); err != nil {
+			return nil, common.Hash{}, fmt.Errorf("could not decode transaction: %v", err)
+		}
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return nil, common.Hash{}, err
+		}
+		return msg, tx.Hash(), nil
+	}
+	// Otherwise assemble a call message, filling in any defaults
+	var from common.Address
+	if call.From != nil {
+		from = *call.From
+	}
+	gas := header.GasLimit
+	if call.Gas != nil {
+		gas = uint64(*call.Gas)
+	}
+	if gasCap := api.eth.config.RPCGasCap; gasCap != nil && gasCap.Uint64() < gas {
+		gas = gasCap.Uint64()
+	}
+	gasPrice := new(big.Int)
+	if call.GasPrice != nil {
+		gasPrice = call.GasPrice.ToInt()
+	}
+	value := new(big.Int)
+	if call.Value != nil {
+		value = call.Value.ToInt()
+	}
+	var data []byte
+	if call.Data != nil {
+		data = []byte(*call.Data)
+	}
+	// Call messages have no hash of their own, derive one from the unsigned
+	// transaction they would correspond to so their logs can be told apart.
+	nonce := statedb.GetNonce(from)
+
+	var tx *types.Transaction
+	if call.To == nil {
+		tx = types.NewContractCreation(nonce, value, gas, gasPrice, data)
+	} else {
+		tx = types.NewTransaction(nonce, *call.To, value, gas, gasPrice, data)
+	}
+	return types.NewMessage(from, call.To, nonce, value, gas, gasPrice, data, false), tx.Hash(), nil
+}
+
+// bundleAccessTracer is a vm.Tracer recording every account and storage slot a
+// bundle might have modified, so that the resulting state diff can be assembled.
+type bundleAccessTracer struct {
+	accounts map[common.Address]map[common.Hash]struct{}
+}
+
+// newBundleAccessTracer creates a new tracer with no accounts touched.
+func newBundleAccessTracer() *bundleAccessTracer {
+	return &bundleAccessTracer{
+		accounts: make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+// touch marks an account as potentially modified.
+func (t *bundleAccessTracer) touch(addr common.Address) {
+	if _, ok := t.accounts[addr]; !ok {
+		t.accounts[addr] = make(map[common.Hash]struct{})
+	}
+}
+
+// touchSlot marks a storage slot of an account as potentially modified.
+func (t *bundleAccessTracer) touchSlot(addr common.Address, slot common.Hash) {
+	t.touch(addr)
+	t.accounts[addr][slot] = struct{}{}
+}
+
+// CaptureStart implements vm.Tracer, marking the sender and recipient of the
+// top level call as touched.
+func (t *bundleAccessTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.touch(from)
+	t.touch(to)
+	return nil
+}
+
+// CaptureState implements vm.Tracer, marking all accounts and slots that the
+// current opcode may modify as touched.
+func (t *bundleAccessTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if err != nil {
+		return nil
+	}
+	size := len(stack.Data())
+	switch {
+	case op == vm.SSTORE && size >= 1:
+		t.touchSlot(contract.Address(), common.BigToHash(stack.Back(0)))
+
+	case (op == vm.CALL || op == vm.CALLCODE || op == vm.DELEGATECALL || op == vm.STATICCALL) && size >= 2:
+		t.touch(common.BigToAddress(stack.Back(1)))
+
+	case op == vm.SELFDESTRUCT && size >= 1:
+		t.touch(contract.Address())
+		t.touch(common.BigToAddress(stack.Back(0)))
+
+	case op == vm.CREATE:
+		t.touch(crypto.CreateAddress(contract.Address(), env.StateDB.GetNonce(contract.Address())))
+
+	case op == vm.CREATE2 && size >= 4:
+		var (
+			offset = stack.Back(1).Int64()
+			length = stack.Back(2).Int64()
+			salt   = common.BigToHash(stack.Back(3))
+		)
+		t.touch(crypto.CreateAddress2(contract.Address(), salt, crypto.Keccak256(memory.Get(offset, length))))
+	}
+	return nil
+}
+
+// CaptureFault implements vm.Tracer.
+func (t *bundleAccessTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements vm.Tracer.
+func (t *bundleAccessTracer) CaptureEnd(output []byte, gasUsed uint64, duration time.Duration, err error) error {
+	return nil
+}
+
+// diff compares all touched accounts and slots between the pre- and post-state,
+// returning the ones that were actually modified.
+func (t *bundleAccessTracer) diff(pre, post *state.StateDB) map[common.Address]*bundleAccountDiff {
+	diffs := make(map[common.Address]*bundleAccountDiff)
+	for addr, slots := range t.accounts {
+		diff := new(bundleAccountDiff)
+		if from, to := pre.GetBalance(addr), post.GetBalance(addr); from.Cmp(to) != 0 {
+			diff.Balance = &diffPair{From: (*hexutil.Big)(from), To: (*hexutil.Big)(to)}
+		}
+		if from, to := pre.GetNonce(addr), post.GetNonce(addr); from != to {
+			diff.Nonce = &diffPair{From: hexutil.Uint64(from), To: hexutil.Uint64(to)}
+		}
+		if from, to := pre.GetCode(addr), post.GetCode(addr); !bytes.Equal(from, to) {
+			diff.Code = &diffPair{From: hexutil.Bytes(from), To: hexutil.Bytes(to)}
+		}
+		for slot := range slots {
+			if from, to := pre.GetState(addr, slot), post.GetState(addr, slot); from != to {
+				if diff.Storage == nil {
+					diff.Storage = make(map[common.Hash]*diffPair)
+				}
+				diff.Storage[slot] = &diffPair{From: from, To: to}
+			}
+		}
+		if diff.Balance != nil || diff.Nonce != nil || diff.Code != nil || diff.Storage != nil {
+			diffs[addr] = diff
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,160 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that a bundle of calls and transactions is executed sequentially, each
+// entry seeing the state modifications of the previous ones.
+func TestCallBundle(t *testing.T) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.Address{0xc0}
+		receiver = common.Address{0xee}
+		funds    = big.NewInt(1000000000000000)
+
+		// slot[0]++; return slot[0]
+		code = common.FromHex("0x60005460010160005560005460005260206000f3")
+
+		db      = rawdb.NewMemoryDatabase()
+		config  = params.TestChainConfig
+		genesis = (&core.Genesis{
+			Config: config,
+			Alloc: core.GenesisAlloc{
+				sender:   {Balance: funds},
+				contract: {Code: code, Balance: new(big.Int)},
+			},
+		}).MustCommit(db)
+	)
+	blocks, _ := core.GenerateChain(config, genesis, ethash.NewFaker(), db, 1, func(i int, b *core.BlockGen) {})
+	chain, _ := core.NewBlockChain(db, nil, config, ethash.NewFaker(), vm.Config{}, nil)
+	defer chain.Stop()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	api := NewPrivateDebugAPI(&Ethereum{config: &Config{}, blockchain: chain, chainDb: db})
+
+	// Call messages bump the sender nonce just like transactions do
+	signer := types.MakeSigner(config, big.NewInt(1))
+	tx, _ := types.SignTx(types.NewTransaction(1, receiver, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+	raw, _ := rlp.EncodeToBytes(tx)
+
+	calls := []BundleCall{
+		{CallArgs: ethapi.CallArgs{From: &sender, To: &contract}},
+		{Raw: (*hexutil.Bytes)(&raw)},
+		{CallArgs: ethapi.CallArgs{From: &sender, To: &contract}},
+	}
+	result, err := api.CallBundle(context.Background(), calls, rpc.LatestBlockNumber, nil)
+	if err != nil {
+		t.Fatalf("failed to call bundle: %v", err)
+	}
+	if len(result.Results) != len(calls) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(result.Results), len(calls))
+	}
+	if have := common.BytesToHash(result.Results[2].ReturnData); have != common.BigToHash(big.NewInt(2)) {
+		t.Errorf("second call return mismatch: have %x, want 2", have)
+	}
+	if have := result.Results[1].TxHash; have == nil || *have != tx.Hash() {
+		t.Errorf("transaction hash mismatch: have %v, want %x", have, tx.Hash())
+	}
+	diff, ok := result.StateDiff[contract]
+	if !ok {
+		t.Fatalf("contract missing from state diff")
+	}
+	if slot := diff.Storage[common.Hash{}]; slot == nil || slot.From != (common.Hash{}) || slot.To != common.BigToHash(big.NewInt(2)) {
+		t.Errorf("contract storage diff mismatch: have %+v", slot)
+	}
+	if diff, ok := result.StateDiff[receiver]; !ok || diff.Balance == nil {
+		t.Errorf("receiver balance missing from state diff")
+	}
+	// Ensure nothing was persisted
+	statedb, _ := chain.State()
+	if have := statedb.GetState(contract, common.Hash{}); have != (common.Hash{}) {
+		t.Errorf("bundle modified chain state: slot 0 = %x", have)
+	}
+}
+
+// Tests that reverted bundle entries report both the raw revert data and the
+// decoded revert reason, without aborting the rest of the bundle.
+func TestCallBundleRevert(t *testing.T) {
+	var (
+		sender   = common.Address{0x01}
+		contract = common.Address{0xc0}
+		// Error("revert reason") abi-encoded
+		reason = common.FromHex("0x08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000d72657665727420726561736f6e00000000000000000000000000000000000000")
+		// PUSH1 100 PUSH1 12 PUSH1 0 CODECOPY PUSH1 100 PUSH1 0 REVERT
+		code = append(common.FromHex("0x6064600c60003960646000fd"), reason...)
+
+		db      = rawdb.NewMemoryDatabase()
+		config  = params.TestChainConfig
+		genesis = (&core.Genesis{
+			Config: config,
+			Alloc:  core.GenesisAlloc{contract: {Code: code, Balance: new(big.Int)}},
+		}).MustCommit(db)
+	)
+	blocks, _ := core.GenerateChain(config, genesis, ethash.NewFaker(), db, 1, func(i int, b *core.BlockGen) {})
+	chain, _ := core.NewBlockChain(db, nil, config, ethash.NewFaker(), vm.Config{}, nil)
+	defer chain.Stop()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	api := NewPrivateDebugAPI(&Ethereum{config: &Config{}, blockchain: chain, chainDb: db})
+
+	calls := []BundleCall{
+		{CallArgs: ethapi.CallArgs{From: &sender, To: &contract}},
+		{CallArgs: ethapi.CallArgs{From: &sender, To: &sender}},
+	}
+	result, err := api.CallBundle(context.Background(), calls, rpc.LatestBlockNumber, nil)
+	if err != nil {
+		t.Fatalf("failed to call bundle: %v", err)
+	}
+	if len(result.Results) != len(calls) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(result.Results), len(calls))
+	}
+	reverted := result.Results[0]
+	if !reverted.Failed {
+		t.Errorf("reverted entry not marked failed")
+	}
+	if !bytes.Equal(reverted.Revert, reason) {
+		t.Errorf("revert data mismatch: have %x, want %x", reverted.Revert, reason)
+	}
+	if reverted.Reason != "revert reason" {
+		t.Errorf("revert reason mismatch: have %q, want %q", reverted.Reason, "revert reason")
+	}
+	if ok := result.Results[1]; ok.Failed || len(ok.Revert) != 0 || ok.Reason != "" {
+		t.Errorf("successful entry reported as reverted: %+v", ok)
+	}
+}
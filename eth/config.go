@@ -111,14 +111,16 @@ type Config struct {
 	ULC *ULCConfig `toml:",omitempty"`
 
 	// Database options
-	SkipBcVersionCheck bool `toml:"-"`
-	DatabaseHandles    int  `toml:"-"`
-	DatabaseCache      int
-	DatabaseFreezer    string
+	SkipBcVersionCheck      bool `toml:"-"`
+	DatabaseHandles         int  `toml:"-"`
+	DatabaseCache           int
+	DatabaseFreezer         string
+	DatabaseFreezerCompress bool `toml:",omitempty"` // Compress all newly created freezer tables
 
 	TrieCleanCache int
 	TrieDirtyCache int
 	TrieTimeout    time.Duration
+	SnapshotCache  int // Memory allowance (MB) for the state snapshot, 0 disables it
 
 	// Mining options
 	Miner miner.Config
@@ -149,4 +151,10 @@ type Config struct {
 
 	// RPCGasCap is the global gas cap for eth-call variants.
 	RPCGasCap *big.Int `toml:",omitempty"`
+
+	// RPCLogsRange is the maximum number of blocks a single log query may span.
+	RPCLogsRange uint64 `toml:",omitempty"`
+
+	// RPCLogsCap is the maximum number of logs returned by a single log query.
+	RPCLogsCap int `toml:",omitempty"`
 }
@@ -57,6 +57,7 @@ type Filter struct {
 
 	block      common.Hash // Block hash if filtering a single block
 	begin, end int64       // Range interval if filtering multiple blocks
+	limit      int         // Number of logs after which to stop searching (0 = unlimited)
 
 	matcher *bloombits.Matcher
 }
@@ -114,6 +115,19 @@ func newFilter(backend Backend, addresses []common.Address, topics [][]common.Ha
 	}
 }
 
+// SetLimit instructs the filter to stop searching once at least the given number
+// of logs were found. Blocks are always processed as a whole, so the results may
+// exceed the limit by the remaining matches of the last block. The start of the
+// filter is left pointing to the block after it, similarly to context errors.
+func (f *Filter) SetLimit(limit int) {
+	f.limit = limit
+}
+
+// limited checks whether the number of gathered logs reached the limit.
+func (f *Filter) limited(found int) bool {
+	return f.limit > 0 && found >= f.limit
+}
+
 // Logs searches the blockchain for matching log entries, returning all from the
 // first block that contains matches, updating the start of the filter accordingly.
 func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
@@ -154,11 +168,11 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 		} else {
 			logs, err = f.indexedLogs(ctx, indexed-1)
 		}
-		if err != nil {
+		if err != nil || f.limited(len(logs)) {
 			return logs, err
 		}
 	}
-	rest, err := f.unindexedLogs(ctx, end)
+	rest, err := f.unindexedLogs(ctx, end, len(logs))
 	logs = append(logs, rest...)
 	return logs, err
 }
@@ -203,6 +217,9 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 				return logs, err
 			}
 			logs = append(logs, found...)
+			if f.limited(len(logs)) {
+				return logs, nil
+			}
 
 		case <-ctx.Done():
 			return logs, ctx.Err()
@@ -211,8 +228,9 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 }
 
 // indexedLogs returns the logs matching the filter criteria based on raw block
-// iteration and bloom matching.
-func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+// iteration and bloom matching. The number of logs already found is needed to
+// enforce the limit of the filter.
+func (f *Filter) unindexedLogs(ctx context.Context, end uint64, found int) ([]*types.Log, error) {
 	var logs []*types.Log
 
 	for ; f.begin <= int64(end); f.begin++ {
@@ -220,11 +238,15 @@ func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, e
 		if header == nil || err != nil {
 			return logs, err
 		}
-		found, err := f.blockLogs(ctx, header)
+		matches, err := f.blockLogs(ctx, header)
 		if err != nil {
 			return logs, err
 		}
-		logs = append(logs, found...)
+		logs = append(logs, matches...)
+		if f.limited(found + len(logs)) {
+			f.begin++
+			return logs, nil
+		}
 	}
 	return logs, nil
 }
@@ -0,0 +1,264 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// DefaultPageSize is the number of logs returned in a page of a paginated log
+// query if no result limit is configured.
+const DefaultPageSize = 10000
+
+// logCursorLength is the length of an encoded log cursor.
+const logCursorLength = 8 + 4 + common.HashLength
+
+var (
+	errUnknownBlock  = errors.New("unknown block")
+	errInvalidCursor = errors.New("invalid log cursor")
+	errStaleCursor   = errors.New("log cursor invalidated by chain reorganisation")
+)
+
+// Config contains the limits enforced on the log queries served by the API.
+type Config struct {
+	MaxBlockRange uint64 // Maximum number of blocks a log query may span (0 = unlimited)
+	MaxResults    int    // Maximum number of logs returned by a log query (0 = unlimited)
+}
+
+// limitError is returned if a log query exceeds the configured limits.
+type limitError struct{ message string }
+
+func (e *limitError) ErrorCode() int { return -32005 }
+
+func (e *limitError) Error() string { return e.message }
+
+// LogPage is a page of the results of a log query, along with the cursor to
+// retrieve the next page with, if the query has more results.
+type LogPage struct {
+	Logs   []*types.Log   `json:"logs"`
+	Cursor *hexutil.Bytes `json:"cursor"`
+}
+
+// logCursor is the position in the results of a log query at which the next
+// page starts: the first block to search and the number of matching logs in it
+// to skip, since they were already returned by the previous page.
+type logCursor struct {
+	number uint64
+	skip   uint32
+	hash   common.Hash // Hash of the block to skip logs in, for reorg detection
+}
+
+// decodeLogCursor parses a cursor returned by a previous page.
+func decodeLogCursor(blob []byte) (*logCursor, error) {
+	if len(blob) != logCursorLength {
+		return nil, errInvalidCursor
+	}
+	return &logCursor{
+		number: binary.BigEndian.Uint64(blob),
+		skip:   binary.BigEndian.Uint32(blob[8:]),
+		hash:   common.BytesToHash(blob[12:]),
+	}, nil
+}
+
+// encode serializes the cursor into an opaque continuation token.
+func (c *logCursor) encode() *hexutil.Bytes {
+	blob := make(hexutil.Bytes, logCursorLength)
+	binary.BigEndian.PutUint64(blob, c.number)
+	binary.BigEndian.PutUint32(blob[8:], c.skip)
+	copy(blob[12:], c.hash[:])
+	return &blob
+}
+
+// resolveRange converts the bounds of a range query into absolute block numbers,
+// substituting the current head for symbolic ones.
+func (api *PublicFilterAPI) resolveRange(ctx context.Context, crit FilterCriteria) (int64, int64, error) {
+	begin := rpc.LatestBlockNumber.Int64()
+	if crit.FromBlock != nil {
+		begin = crit.FromBlock.Int64()
+	}
+	end := rpc.LatestBlockNumber.Int64()
+	if crit.ToBlock != nil {
+		end = crit.ToBlock.Int64()
+	}
+	if begin >= 0 && end >= 0 {
+		return begin, end, nil
+	}
+	header, err := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return 0, 0, err
+	}
+	if header == nil {
+		return 0, 0, errUnknownBlock
+	}
+	if begin < 0 {
+		begin = header.Number.Int64()
+	}
+	if end < 0 {
+		end = header.Number.Int64()
+	}
+	return begin, end, nil
+}
+
+// queryLogs runs a log query, failing if it spans more blocks or matches more
+// logs than permitted. The search is aborted as soon as the result limit is
+// exceeded, so oversized queries don't accumulate all their results.
+func (api *PublicFilterAPI) queryLogs(ctx context.Context, crit FilterCriteria) ([]*types.Log, error) {
+	var filter *Filter
+	if crit.BlockHash != nil {
+		// Block filter requested, construct a single-shot filter
+		filter = NewBlockFilter(api.backend, *crit.BlockHash, crit.Addresses, crit.Topics)
+	} else {
+		begin, end, err := api.resolveRange(ctx, crit)
+		if err != nil {
+			return nil, err
+		}
+		if limit := api.config.MaxBlockRange; limit > 0 && end >= begin && uint64(end-begin) >= limit {
+			return nil, &limitError{fmt.Sprintf("query spans %d blocks, exceeding the limit of %d", end-begin+1, limit)}
+		}
+		filter = NewRangeFilter(api.backend, begin, end, crit.Addresses, crit.Topics)
+	}
+	limit := api.config.MaxResults
+	if limit > 0 {
+		filter.SetLimit(limit + 1)
+	}
+	logs, err := filter.Logs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(logs) > limit {
+		return nil, &limitError{fmt.Sprintf("query returned more than %d results, use eth_getLogsPage to page through them", limit)}
+	}
+	return returnLogs(logs), nil
+}
+
+// GetLogsPage returns a page of the logs matching the given criteria. If there
+// are further results, the page contains a cursor which can be passed along with
+// the same criteria to retrieve the next page. Pages contain at most as many
+// logs and span at most as many blocks as permitted for eth_getLogs.
+func (api *PublicFilterAPI) GetLogsPage(ctx context.Context, crit FilterCriteria, cursor *hexutil.Bytes) (*LogPage, error) {
+	var start *logCursor
+	if cursor != nil {
+		var err error
+		if start, err = decodeLogCursor(*cursor); err != nil {
+			return nil, err
+		}
+	}
+	var (
+		filter *Filter
+		first  uint64 // First block searched for this page
+		last   uint64 // Last block searched for this page
+		end    uint64 // Last block of the query
+	)
+	if crit.BlockHash != nil {
+		header, err := api.backend.HeaderByHash(ctx, *crit.BlockHash)
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		first, last, end = header.Number.Uint64(), header.Number.Uint64(), header.Number.Uint64()
+		if start != nil && (start.number != first || start.hash != header.Hash()) {
+			return nil, errInvalidCursor
+		}
+		filter = NewBlockFilter(api.backend, *crit.BlockHash, crit.Addresses, crit.Topics)
+	} else {
+		begin, stop, err := api.resolveRange(ctx, crit)
+		if err != nil {
+			return nil, err
+		}
+		if start != nil {
+			if start.number < uint64(begin) {
+				return nil, errInvalidCursor
+			}
+			begin = int64(start.number)
+		}
+		if stop < begin {
+			return &LogPage{Logs: []*types.Log{}}, nil
+		}
+		first, last, end = uint64(begin), uint64(stop), uint64(stop)
+		if limit := api.config.MaxBlockRange; limit > 0 && last-first >= limit {
+			last = first + limit - 1
+		}
+		if start != nil && start.skip > 0 {
+			header, err := api.backend.HeaderByNumber(ctx, rpc.BlockNumber(first))
+			if err != nil {
+				return nil, err
+			}
+			if header == nil || header.Hash() != start.hash {
+				return nil, errStaleCursor
+			}
+		}
+		filter = NewRangeFilter(api.backend, int64(first), int64(last), crit.Addresses, crit.Topics)
+	}
+	// Gather the logs of the page, including the ones returned previously from
+	// the first block, and drop those
+	limit := api.config.MaxResults
+	if limit == 0 {
+		limit = DefaultPageSize
+	}
+	skip := 0
+	if start != nil {
+		skip = int(start.skip)
+	}
+	filter.SetLimit(limit + skip)
+
+	logs, err := filter.Logs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if skip > len(logs) {
+		skip = len(logs)
+	}
+	logs = logs[skip:]
+
+	// Truncate the page to the limit and assemble the cursor to continue from
+	page := &LogPage{Logs: returnLogs(logs)}
+	switch {
+	case len(logs) > limit:
+		// The page ended mid-block, resume at the first log not returned
+		next := logs[limit]
+		resume := uint32(0)
+		for _, log := range logs[:limit] {
+			if log.BlockNumber == next.BlockNumber {
+				resume++
+			}
+		}
+		if next.BlockNumber == first {
+			resume += uint32(skip)
+		}
+		page.Logs = logs[:limit]
+		page.Cursor = (&logCursor{number: next.BlockNumber, skip: resume, hash: next.BlockHash}).encode()
+
+	case len(logs) == limit && logs[limit-1].BlockNumber < end:
+		// The search stopped right after a block, resume with the next one
+		page.Cursor = (&logCursor{number: logs[limit-1].BlockNumber + 1}).encode()
+
+	case last < end:
+		// The page covers the maximum permitted range, resume after it
+		page.Cursor = (&logCursor{number: last + 1}).encode()
+	}
+	return page, nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var limitsTestAddr = common.BytesToAddress([]byte("limits"))
+
+// newLimitsTestBackend creates a backend with a chain of 30 blocks, every third
+// of which contains three logs and every fifth an additional one.
+func newLimitsTestBackend() *testBackend {
+	db := rawdb.NewMemoryDatabase()
+	backend := &testBackend{new(event.TypeMux), db, 0, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed)}
+
+	genesis := core.GenesisBlockForTesting(db, limitsTestAddr, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 30, func(i int, gen *core.BlockGen) {
+		var counts []int
+		if i%3 == 0 {
+			counts = append(counts, 3)
+		}
+		if i%5 == 0 {
+			counts = append(counts, 1)
+		}
+		for j, count := range counts {
+			receipt := types.NewReceipt(nil, false, 0)
+			for k := 0; k < count; k++ {
+				receipt.Logs = append(receipt.Logs, &types.Log{
+					Address: limitsTestAddr,
+					Topics:  []common.Hash{common.BigToHash(big.NewInt(int64(100*i + 10*j + k)))},
+				})
+			}
+			gen.AddUncheckedReceipt(receipt)
+			gen.AddUncheckedTx(types.NewTransaction(uint64(10*i+j), common.Address{}, big.NewInt(0), 0, big.NewInt(0), nil))
+		}
+	})
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	return backend
+}
+
+// Tests that log queries exceeding the block range or result limits are rejected.
+func TestLogQueryLimits(t *testing.T) {
+	backend := newLimitsTestBackend()
+	api := &PublicFilterAPI{backend: backend, config: Config{MaxBlockRange: 10, MaxResults: 4}}
+
+	tests := []struct {
+		from, to int64
+		logs     int
+		limited  bool
+	}{
+		{2, 5, 3, false},   // block 4 with 3 logs
+		{1, 1, 4, false},   // block 1 with 3+1 logs, exactly at the limit
+		{5, 6, 1, false},   // block 6 with 1 log
+		{29, -1, 0, false}, // no logs up to the head
+		{1, 4, 0, true},    // blocks 1 and 4 with 7 logs
+		{0, 10, 0, true},   // 11 blocks
+		{21, -1, 0, true},  // 10 blocks up to the head, but 11 logs
+	}
+	for i, tt := range tests {
+		crit := FilterCriteria{FromBlock: big.NewInt(tt.from), ToBlock: big.NewInt(tt.to), Addresses: []common.Address{limitsTestAddr}}
+		logs, err := api.GetLogs(context.Background(), crit)
+		if (err != nil) != tt.limited {
+			t.Errorf("test %d: error mismatch: have %v, want limited %v", i, err, tt.limited)
+			continue
+		}
+		if err != nil {
+			if code := err.(rpc.Error).ErrorCode(); code != -32005 {
+				t.Errorf("test %d: error code mismatch: have %d, want %d", i, code, -32005)
+			}
+		} else if len(logs) != tt.logs {
+			t.Errorf("test %d: log count mismatch: have %d, want %d", i, len(logs), tt.logs)
+		}
+	}
+}
+
+// Tests that paginated log queries return the same logs as an unlimited query,
+// split into pages within the configured limits.
+func TestLogPagination(t *testing.T) {
+	backend := newLimitsTestBackend()
+	crit := FilterCriteria{FromBlock: big.NewInt(0), ToBlock: big.NewInt(-1), Addresses: []common.Address{limitsTestAddr}}
+
+	want, err := (&PublicFilterAPI{backend: backend}).GetLogs(context.Background(), crit)
+	if err != nil {
+		t.Fatalf("failed to retrieve all logs: %v", err)
+	}
+	if len(want) != 36 {
+		t.Fatalf("log count mismatch: have %d, want %d", len(want), 36)
+	}
+	for _, config := range []Config{{}, {MaxResults: 2}, {MaxResults: 4, MaxBlockRange: 7}, {MaxBlockRange: 1}} {
+		api := &PublicFilterAPI{backend: backend, config: config}
+
+		var (
+			have   []*types.Log
+			cursor *hexutil.Bytes
+			pages  int
+		)
+		for {
+			page, err := api.GetLogsPage(context.Background(), crit, cursor)
+			if err != nil {
+				t.Fatalf("config %+v: page %d: failed to retrieve: %v", config, pages, err)
+			}
+			if config.MaxResults > 0 && len(page.Logs) > config.MaxResults {
+				t.Fatalf("config %+v: page %d: too many logs: have %d, want at most %d", config, pages, len(page.Logs), config.MaxResults)
+			}
+			have = append(have, page.Logs...)
+			if pages++; page.Cursor == nil || pages > 100 {
+				break
+			}
+			cursor = page.Cursor
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("config %+v: paginated logs mismatch: have %d logs, want %d", config, len(have), len(want))
+		}
+	}
+}
+
+// Tests that cursors pointing into blocks which were reorged are rejected.
+func TestLogCursorReorg(t *testing.T) {
+	backend := newLimitsTestBackend()
+	api := &PublicFilterAPI{backend: backend, config: Config{MaxResults: 2}}
+	crit := FilterCriteria{FromBlock: big.NewInt(0), ToBlock: big.NewInt(-1), Addresses: []common.Address{limitsTestAddr}}
+
+	page, err := api.GetLogsPage(context.Background(), crit, nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve first page: %v", err)
+	}
+	cursor, err := decodeLogCursor(*page.Cursor)
+	if err != nil {
+		t.Fatalf("failed to decode cursor: %v", err)
+	}
+	if cursor.skip == 0 {
+		t.Fatalf("first page didn't end mid-block")
+	}
+	cursor.hash = common.Hash{0x01}
+	if _, err := api.GetLogsPage(context.Background(), crit, cursor.encode()); err != errStaleCursor {
+		t.Fatalf("stale cursor error mismatch: have %v, want %v", err, errStaleCursor)
+	}
+	invalid := hexutil.Bytes{0x01, 0x02}
+	if _, err := api.GetLogsPage(context.Background(), crit, &invalid); err != errInvalidCursor {
+		t.Fatalf("invalid cursor error mismatch: have %v, want %v", err, errInvalidCursor)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+)
+
+// selectorLength is the length of the method selector prefixing contract call data.
+const selectorLength = 4
+
+// PendingTxOptions are the options of a pending transaction subscription. Each
+// non-empty address or selector list restricts the notifications to transactions
+// matching any of its entries.
+type PendingTxOptions struct {
+	FullTx    bool             `json:"fullTx"`    // Notify full transactions instead of hashes
+	From      []common.Address `json:"from"`      // Senders of the transactions to notify
+	To        []common.Address `json:"to"`        // Recipients of the transactions to notify (contract creations never match)
+	Selectors []hexutil.Bytes  `json:"selectors"` // Method selectors the call data of the transactions starts with
+}
+
+// validate checks that the subscription options are well formed.
+func (opts *PendingTxOptions) validate() error {
+	for _, selector := range opts.Selectors {
+		if len(selector) != selectorLength {
+			return fmt.Errorf("invalid method selector %s, want %d bytes", selector, selectorLength)
+		}
+	}
+	return nil
+}
+
+// filter matches a transaction against the options, returning the notification
+// to send for it or nil if it is filtered out.
+func (opts *PendingTxOptions) filter(tx *types.Transaction) interface{} {
+	if len(opts.To) > 0 {
+		to := tx.To()
+		if to == nil || !containsAddress(opts.To, *to) {
+			return nil
+		}
+	}
+	if len(opts.Selectors) > 0 {
+		data := tx.Data()
+		if len(data) < selectorLength {
+			return nil
+		}
+		var found bool
+		for _, selector := range opts.Selectors {
+			if bytes.Equal(data[:selectorLength], selector) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	// Recovering the sender is expensive, only do it if needed
+	if len(opts.From) == 0 && !opts.FullTx {
+		return tx.Hash()
+	}
+	rpcTx := ethapi.NewRPCPendingTransaction(tx)
+	if len(opts.From) > 0 && !containsAddress(opts.From, rpcTx.From) {
+		return nil
+	}
+	if opts.FullTx {
+		return rpcTx
+	}
+	return tx.Hash()
+}
+
+// containsAddress reports whether the address is in the list.
+func containsAddress(addresses []common.Address, addr common.Address) bool {
+	for _, a := range addresses {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
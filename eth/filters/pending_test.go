@@ -0,0 +1,105 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+)
+
+// Tests that pending transactions are matched against the subscription options
+// and notified either as hashes or as full transactions.
+func TestPendingTxOptionsFilter(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	signer := types.NewEIP155Signer(big.NewInt(1))
+
+	var (
+		target   = common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268")
+		selector = hexutil.Bytes{0xa9, 0x05, 0x9c, 0xbb}
+	)
+	sign := func(tx *types.Transaction) *types.Transaction {
+		signed, err := types.SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		return signed
+	}
+	var (
+		transfer = sign(types.NewTransaction(0, target, big.NewInt(1), 21000, big.NewInt(1), nil))
+		call     = sign(types.NewTransaction(1, target, big.NewInt(0), 50000, big.NewInt(1), append(common.CopyBytes(selector), 0x01)))
+		create   = sign(types.NewContractCreation(2, big.NewInt(0), 50000, big.NewInt(1), selector))
+	)
+	tests := []struct {
+		opts PendingTxOptions
+		want []*types.Transaction
+	}{
+		{PendingTxOptions{}, []*types.Transaction{transfer, call, create}},
+		{PendingTxOptions{From: []common.Address{sender}}, []*types.Transaction{transfer, call, create}},
+		{PendingTxOptions{From: []common.Address{target}}, nil},
+		{PendingTxOptions{To: []common.Address{target}}, []*types.Transaction{transfer, call}},
+		{PendingTxOptions{To: []common.Address{sender}}, nil},
+		{PendingTxOptions{Selectors: []hexutil.Bytes{selector}}, []*types.Transaction{call, create}},
+		{PendingTxOptions{To: []common.Address{target}, Selectors: []hexutil.Bytes{selector}}, []*types.Transaction{call}},
+		{PendingTxOptions{FullTx: true, To: []common.Address{target}}, []*types.Transaction{transfer, call}},
+	}
+	for i, tt := range tests {
+		var have []*types.Transaction
+		for _, tx := range []*types.Transaction{transfer, call, create} {
+			switch result := tt.opts.filter(tx).(type) {
+			case nil:
+			case common.Hash:
+				if tt.opts.FullTx {
+					t.Errorf("test %d: hash notified for full transaction subscription", i)
+				}
+				if result != tx.Hash() {
+					t.Errorf("test %d: hash mismatch: have %x, want %x", i, result, tx.Hash())
+				}
+				have = append(have, tx)
+			case *ethapi.RPCTransaction:
+				if !tt.opts.FullTx {
+					t.Errorf("test %d: full transaction notified for hash subscription", i)
+				}
+				if result.Hash != tx.Hash() || result.From != sender {
+					t.Errorf("test %d: transaction mismatch: have %x from %x, want %x from %x", i, result.Hash, result.From, tx.Hash(), sender)
+				}
+				have = append(have, tx)
+			default:
+				t.Fatalf("test %d: unexpected notification type %T", i, result)
+			}
+		}
+		if len(have) != len(tt.want) {
+			t.Errorf("test %d: match count mismatch: have %d, want %d", i, len(have), len(tt.want))
+			continue
+		}
+		for j := range have {
+			if have[j] != tt.want[j] {
+				t.Errorf("test %d: match %d mismatch: have %x, want %x", i, j, have[j].Hash(), tt.want[j].Hash())
+			}
+		}
+	}
+	invalid := PendingTxOptions{Selectors: []hexutil.Bytes{{0x01, 0x02}}}
+	if err := invalid.validate(); err == nil {
+		t.Errorf("short selector accepted")
+	}
+}
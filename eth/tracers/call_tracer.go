@@ -0,0 +1,324 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+func init() {
+	native["callTracer"] = newCallTracer
+}
+
+// callFrame is a single call of the transaction call tree. Unset fields are
+// omitted from the JSON output, mirroring the JavaScript callTracer.
+type callFrame struct {
+	Type    string          `json:"type"`
+	From    *common.Address `json:"from,omitempty"`
+	To      *common.Address `json:"to,omitempty"`
+	Value   *hexutil.Big    `json:"value,omitempty"`
+	Gas     *hexutil.Uint64 `json:"gas,omitempty"`
+	GasUsed *hexutil.Uint64 `json:"gasUsed,omitempty"`
+	Input   *hexutil.Bytes  `json:"input,omitempty"`
+	Output  *hexutil.Bytes  `json:"output,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Time    string          `json:"time,omitempty"`
+	Calls   []*callFrame    `json:"calls,omitempty"`
+
+	gasIn   uint64 // Gas available when the call opcode was executed
+	gasCost uint64 // Cost of the call opcode itself
+	outOff  int64  // Memory offset the call output is written to
+	outLen  int64  // Memory size the call output is written to
+}
+
+// callTracer is a native Go implementation of the JavaScript callTracer. It
+// extracts and reports all the internal calls made by a transaction, producing
+// the exact same output as its JavaScript counterpart.
+type callTracer struct {
+	callstack []*callFrame // Current recursive call stack of the EVM execution
+	descended bool         // Whether we've just descended into an inner call
+
+	root *callFrame // Top level call gathered from the start and end events
+
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+	err       error  // Error, if one has occurred
+}
+
+// newCallTracer creates a new native call tracer. The call tracer has no
+// configuration options.
+func newCallTracer(config json.RawMessage) (Tracer, error) {
+	return &callTracer{
+		callstack: []*callFrame{{}},
+		root:      new(callFrame),
+	}, nil
+}
+
+// CaptureTxStart implements the Tracer interface. The call tracer only reports
+// the execution itself.
+func (t *callTracer) CaptureTxStart(env *vm.EVM, msg core.Message) {}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *callTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.root.Type = "CALL"
+	if create {
+		t.root.Type = "CREATE"
+	}
+	t.root.From = &from
+	t.root.To = &to
+	t.root.Input = bytesPtr(input)
+	t.root.Gas = uint64Ptr(gas)
+	if value == nil {
+		value = new(big.Int)
+	}
+	t.root.Value = (*hexutil.Big)(new(big.Int).Set(value))
+	return nil
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *callTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.err != nil {
+		return nil
+	}
+	// If tracing was interrupted, set the error and stop
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		t.err = t.reason
+		return nil
+	}
+	// Capture any errors immediately
+	if err != nil {
+		t.fault(err)
+		return nil
+	}
+	switch op {
+	case vm.CREATE, vm.CREATE2:
+		// If a new contract is being created, add to the call stack
+		inOff, inLen := stackInt64(stack, 1), stackInt64(stack, 2)
+
+		from := contract.Address()
+		t.callstack = append(t.callstack, &callFrame{
+			Type:    op.String(),
+			From:    &from,
+			Input:   bytesPtr(memorySlice(memory, inOff, inOff+inLen)),
+			Value:   (*hexutil.Big)(new(big.Int).Set(stack.Back(0))),
+			gasIn:   gas,
+			gasCost: cost,
+		})
+		t.descended = true
+		return nil
+
+	case vm.SELFDESTRUCT:
+		// If a contract is being self destructed, gather that as a subcall too
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, &callFrame{Type: op.String()})
+		return nil
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		// Skip any pre-compile invocations, those are just fancy opcodes
+		to := common.BigToAddress(stack.Back(1))
+		if _, ok := vm.PrecompiledContractsByzantium[to]; ok {
+			return nil
+		}
+		off := 1
+		if op == vm.DELEGATECALL || op == vm.STATICCALL {
+			off = 0
+		}
+		inOff, inLen := stackInt64(stack, 2+off), stackInt64(stack, 3+off)
+
+		// Assemble the internal call report and store for completion
+		from := contract.Address()
+		call := &callFrame{
+			Type:    op.String(),
+			From:    &from,
+			To:      &to,
+			Input:   bytesPtr(memorySlice(memory, inOff, inOff+inLen)),
+			gasIn:   gas,
+			gasCost: cost,
+			outOff:  stackInt64(stack, 4+off),
+			outLen:  stackInt64(stack, 5+off),
+		}
+		if op != vm.DELEGATECALL && op != vm.STATICCALL {
+			call.Value = (*hexutil.Big)(new(big.Int).Set(stack.Back(2)))
+		}
+		t.callstack = append(t.callstack, call)
+		t.descended = true
+		return nil
+	}
+	// If we've just descended into an inner call, retrieve it's true allowance. We
+	// need to extract if from within the call as there may be funky gas dynamics
+	// with regard to requested and actually given gas (2300 stipend, 63/64 rule).
+	if t.descended {
+		if depth >= len(t.callstack) {
+			t.callstack[len(t.callstack)-1].Gas = uint64Ptr(gas)
+		}
+		// Otherwise the call was made to a plain account. We don't have access to
+		// the true gas amount inside the call, so leave it unset.
+		t.descended = false
+	}
+	// If an existing call is returning, pop off the call stack
+	if op == vm.REVERT {
+		t.callstack[len(t.callstack)-1].Error = "execution reverted"
+		return nil
+	}
+	if depth == len(t.callstack)-1 {
+		// Pop off the last call and get the execution results
+		call := t.callstack[len(t.callstack)-1]
+		t.callstack = t.callstack[:len(t.callstack)-1]
+
+		if call.Type == vm.CREATE.String() || call.Type == vm.CREATE2.String() {
+			// If the call was a CREATE, retrieve the contract address and output code
+			call.GasUsed = uint64Ptr(call.gasIn - call.gasCost - gas)
+
+			if ret := stack.Back(0); ret.Sign() != 0 {
+				to := common.BigToAddress(ret)
+				call.To = &to
+				call.Output = bytesPtr(env.StateDB.GetCode(to))
+			} else if call.Error == "" {
+				call.Error = "internal failure"
+			}
+		} else {
+			// If the call was a contract call, retrieve the gas usage and output.
+			// Calls to plain accounts have no known allowance, so like with the
+			// JavaScript tracer nothing is reported about their results.
+			if call.Gas != nil {
+				call.GasUsed = uint64Ptr(call.gasIn - call.gasCost + uint64(*call.Gas) - gas)
+
+				if ret := stack.Back(0); ret.Sign() != 0 {
+					call.Output = bytesPtr(memorySlice(memory, call.outOff, call.outOff+call.outLen))
+				} else if call.Error == "" {
+					call.Error = "internal failure"
+				}
+			}
+		}
+		// Inject the call into the previous one
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, call)
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *callTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.err == nil {
+		t.fault(err)
+	}
+	return nil
+}
+
+// fault handles the failure of the currently executing call, flattening it into
+// its parent.
+func (t *callTracer) fault(err error) {
+	// If the topmost call already reverted, don't handle the additional fault again
+	if t.callstack[len(t.callstack)-1].Error != "" {
+		return
+	}
+	// Pop off the just failed call
+	call := t.callstack[len(t.callstack)-1]
+	t.callstack = t.callstack[:len(t.callstack)-1]
+	call.Error = err.Error()
+
+	// Consume all available gas and clean any leftovers
+	if call.Gas != nil {
+		call.GasUsed = uint64Ptr(uint64(*call.Gas))
+	}
+	// Flatten the failed call into its parent
+	if len(t.callstack) > 0 {
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, call)
+		return
+	}
+	// Last call failed too, leave it in the stack
+	t.callstack = append(t.callstack, call)
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *callTracer) CaptureEnd(output []byte, gasUsed uint64, duration time.Duration, err error) error {
+	t.root.Output = bytesPtr(output)
+	t.root.GasUsed = uint64Ptr(gasUsed)
+	t.root.Time = duration.String()
+	if err != nil {
+		t.root.Error = err.Error()
+	}
+	return nil
+}
+
+// GetResult returns the call tree gathered during execution, or any error which
+// occurred while tracing.
+func (t *callTracer) GetResult() (json.RawMessage, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	result := *t.root
+	if len(t.callstack) > 0 {
+		result.Calls = t.callstack[0].Calls
+		if t.callstack[0].Error != "" {
+			result.Error = t.callstack[0].Error
+		}
+	}
+	if result.Error != "" {
+		result.Output = nil
+	}
+	return json.Marshal(&result)
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *callTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
+
+// stackInt64 returns the n-th item from the top of the stack as an int64, or
+// zero if the stack is too short.
+func stackInt64(stack *vm.Stack, n int) int64 {
+	if len(stack.Data()) <= n {
+		log.Warn("Tracer accessed out of bound stack", "size", len(stack.Data()), "index", n)
+		return 0
+	}
+	return stack.Back(n).Int64()
+}
+
+// memorySlice returns the requested range of memory as a byte slice, or nil if
+// the range is out of bounds.
+func memorySlice(memory *vm.Memory, begin, end int64) []byte {
+	if begin < 0 || end < begin || int64(memory.Len()) < end {
+		log.Warn("Tracer accessed out of bound memory", "available", memory.Len(), "offset", begin, "size", end-begin)
+		return nil
+	}
+	return memory.Get(begin, end-begin)
+}
+
+// bytesPtr copies a byte slice into a newly allocated hexutil.Bytes.
+func bytesPtr(b []byte) *hexutil.Bytes {
+	blob := make(hexutil.Bytes, len(b))
+	copy(blob, b)
+	return &blob
+}
+
+// uint64Ptr allocates a new hexutil.Uint64 with the given value.
+func uint64Ptr(n uint64) *hexutil.Uint64 {
+	return (*hexutil.Uint64)(&n)
+}
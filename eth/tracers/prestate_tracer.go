@@ -0,0 +1,285 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func init() {
+	native["prestateTracer"] = newPrestateTracer
+}
+
+// errNoTxStart is returned by the prestate tracer if it was not notified of the
+// start of the transaction, so the pre-state of its participants is unknown.
+var errNoTxStart = errors.New("prestate tracer requires CaptureTxStart")
+
+// prestateTracerConfig are the configuration options of the prestate tracer.
+type prestateTracerConfig struct {
+	DiffMode bool `json:"diffMode"` // Report both the pre- and post-state of modified accounts
+}
+
+// prestateAccount is the state of a single account as reported by the prestate
+// tracer. Fields not relevant for the account are omitted.
+type prestateAccount struct {
+	Balance *hexutil.Big                `json:"balance,omitempty"`
+	Nonce   *uint64                     `json:"nonce,omitempty"`
+	Code    *hexutil.Bytes              `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+
+	exists bool // Whether the account existed prior to the transaction
+}
+
+// prestateDiff is the result of the prestate tracer in diff mode.
+type prestateDiff struct {
+	Pre  map[common.Address]*prestateAccount `json:"pre"`
+	Post map[common.Address]*prestateAccount `json:"post"`
+}
+
+// prestateTracer implements the diff mode of the prestateTracer, reporting both
+// the pre- and post-state of every account and storage slot the transaction
+// modified. Without diff mode the JavaScript prestateTracer is used instead.
+//
+// The pre-state of the sender, the recipient and the coinbase is captured in
+// CaptureTxStart, before the transaction buys its gas. Tracing fails if that
+// hook was not called.
+type prestateTracer struct {
+	config prestateTracerConfig
+
+	env   *vm.EVM                                 // EVM environment to read the state from
+	pre   map[common.Address]*prestateAccount     // Pre-state of all accessed accounts
+	slots map[common.Address]map[common.Hash]bool // Storage slots accessed per account
+
+	from common.Address // Sender of the transaction
+	to   common.Address // Recipient (or created contract) of the transaction
+
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+	err       error  // Error, if one has occurred
+}
+
+// newPrestateTracer creates a new native prestate tracer if diff mode is
+// requested, or the JavaScript prestate tracer otherwise.
+func newPrestateTracer(config json.RawMessage) (Tracer, error) {
+	t := &prestateTracer{
+		pre:   make(map[common.Address]*prestateAccount),
+		slots: make(map[common.Address]map[common.Hash]bool),
+	}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &t.config); err != nil {
+			return nil, err
+		}
+	}
+	if !t.config.DiffMode {
+		code, _ := tracer("prestateTracer")
+		return newJsTracer(code)
+	}
+	return t, nil
+}
+
+// CaptureTxStart implements the Tracer interface to gather the pre-state of
+// the sender, the recipient and the coinbase before the transaction buys its gas
+// or transfers any value.
+func (t *prestateTracer) CaptureTxStart(env *vm.EVM, msg core.Message) {
+	t.env = env
+
+	t.from = msg.From()
+	if to := msg.To(); to != nil {
+		t.to = *to
+	} else {
+		t.to = crypto.CreateAddress(t.from, env.StateDB.GetNonce(t.from))
+	}
+	t.lookupAccount(t.from)
+	t.lookupAccount(t.to)
+	t.lookupAccount(env.Coinbase)
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *prestateTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *prestateTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.err != nil || err != nil {
+		return nil
+	}
+	// If tracing was interrupted, set the error and stop
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		t.err = t.reason
+		return nil
+	}
+	if t.env == nil {
+		t.err = errNoTxStart
+		return nil
+	}
+	// Whenever new state is accessed, add it to the prestate
+	size := len(stack.Data())
+	switch {
+	case (op == vm.EXTCODECOPY || op == vm.EXTCODESIZE || op == vm.EXTCODEHASH || op == vm.BALANCE) && size >= 1:
+		t.lookupAccount(common.BigToAddress(stack.Back(0)))
+
+	case (op == vm.CALL || op == vm.CALLCODE || op == vm.DELEGATECALL || op == vm.STATICCALL) && size >= 2:
+		t.lookupAccount(common.BigToAddress(stack.Back(1)))
+
+	case op == vm.SELFDESTRUCT && size >= 1:
+		t.lookupAccount(common.BigToAddress(stack.Back(0)))
+
+	case op == vm.CREATE:
+		from := contract.Address()
+		t.lookupAccount(crypto.CreateAddress(from, env.StateDB.GetNonce(from)))
+
+	case op == vm.CREATE2 && size >= 4:
+		offset, length := stackInt64(stack, 1), stackInt64(stack, 2)
+		salt := common.BigToHash(stack.Back(3))
+		t.lookupAccount(crypto.CreateAddress2(contract.Address(), salt, crypto.Keccak256(memorySlice(memory, offset, offset+length))))
+
+	case (op == vm.SLOAD || op == vm.SSTORE) && size >= 1:
+		t.lookupStorage(contract.Address(), common.BigToHash(stack.Back(0)))
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *prestateTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *prestateTracer) CaptureEnd(output []byte, gasUsed uint64, duration time.Duration, err error) error {
+	return nil
+}
+
+// GetResult returns both the pre- and post-state of all the modified accounts.
+// The state must already be finalised when this method is called.
+func (t *prestateTracer) GetResult() (json.RawMessage, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	if t.env == nil {
+		return nil, errNoTxStart
+	}
+	diff := &prestateDiff{
+		Pre:  make(map[common.Address]*prestateAccount),
+		Post: make(map[common.Address]*prestateAccount),
+	}
+	db := t.env.StateDB
+	for addr, pre := range t.pre {
+		var (
+			post     = new(prestateAccount)
+			modified bool
+		)
+		if db.Exist(addr) {
+			if balance := db.GetBalance(addr); !pre.exists || balance.Cmp((*big.Int)(pre.Balance)) != 0 {
+				post.Balance = (*hexutil.Big)(balance)
+			}
+			if nonce := db.GetNonce(addr); !pre.exists || nonce != *pre.Nonce {
+				post.Nonce = &nonce
+			}
+			if code := db.GetCode(addr); !pre.exists || !bytes.Equal(code, *pre.Code) {
+				post.Code = (*hexutil.Bytes)(&code)
+			}
+			modified = post.Balance != nil || post.Nonce != nil || post.Code != nil
+		} else {
+			modified = pre.exists
+		}
+		// Retain only the storage slots that were actually modified
+		var storage map[common.Hash]common.Hash
+		for slot := range t.slots[addr] {
+			if value := db.GetState(addr, slot); value != pre.Storage[slot] {
+				if storage == nil {
+					storage = make(map[common.Hash]common.Hash)
+				}
+				storage[slot] = pre.Storage[slot]
+				if db.Exist(addr) {
+					if post.Storage == nil {
+						post.Storage = make(map[common.Hash]common.Hash)
+					}
+					post.Storage[slot] = value
+				}
+				modified = true
+			}
+		}
+		if !modified {
+			continue
+		}
+		if pre.exists {
+			diff.Pre[addr] = &prestateAccount{
+				Balance: pre.Balance,
+				Nonce:   pre.Nonce,
+				Code:    pre.Code,
+				Storage: storage,
+			}
+		}
+		if db.Exist(addr) {
+			diff.Post[addr] = post
+		}
+	}
+	return json.Marshal(diff)
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *prestateTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
+
+// lookupAccount injects the specified account into the prestate if it was not
+// yet accessed.
+func (t *prestateTracer) lookupAccount(addr common.Address) {
+	if _, ok := t.pre[addr]; ok {
+		return
+	}
+	db := t.env.StateDB
+
+	nonce := db.GetNonce(addr)
+	code := db.GetCode(addr)
+	if code == nil {
+		code = []byte{}
+	}
+	t.pre[addr] = &prestateAccount{
+		Balance: (*hexutil.Big)(new(big.Int).Set(db.GetBalance(addr))),
+		Nonce:   &nonce,
+		Code:    (*hexutil.Bytes)(&code),
+		Storage: make(map[common.Hash]common.Hash),
+		exists:  db.Exist(addr),
+	}
+	t.slots[addr] = make(map[common.Hash]bool)
+}
+
+// lookupStorage injects the specified storage entry of the given account into
+// the prestate if it was not yet accessed.
+func (t *prestateTracer) lookupStorage(addr common.Address, key common.Hash) {
+	t.lookupAccount(addr)
+	if t.slots[addr][key] {
+		return
+	}
+	t.pre[addr].Storage[key] = t.env.StateDB.GetState(addr, key)
+	t.slots[addr][key] = true
+}
@@ -14,19 +14,44 @@
 // You should have received a copy of the GNU Lesser General Public License
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
-// Package tracers is a collection of JavaScript transaction tracers.
+// Package tracers is a collection of JavaScript and native Go transaction tracers.
 package tracers
 
 import (
+	"encoding/json"
 	"strings"
 	"unicode"
 
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/eth/tracers/internal/tracers"
 )
 
+// Tracer is a vm.Tracer which can be interrupted and which assembles a JSON
+// encoded result once the traced execution has finished.
+type Tracer interface {
+	vm.Tracer
+
+	// CaptureTxStart is called with the execution environment and the message
+	// right before the message is applied, so tracers can inspect the state
+	// before the gas is bought and the value transferred. The vm.Tracer hooks
+	// only fire afterwards.
+	CaptureTxStart(env *vm.EVM, msg core.Message)
+
+	// GetResult returns the result of the tracing, or any accumulated error.
+	GetResult() (json.RawMessage, error)
+
+	// Stop terminates execution of the tracer at the first opportune moment.
+	Stop(err error)
+}
+
 // all contains all the built in JavaScript tracers by name.
 var all = make(map[string]string)
 
+// native contains the constructors of all the built in Go tracers by name. A
+// native tracer takes precedence over a JavaScript one of the same name.
+var native = make(map[string]func(config json.RawMessage) (Tracer, error))
+
 // camel converts a snake cased input string into a camel cased output.
 func camel(str string) string {
 	pieces := strings.Split(str, "_")
@@ -44,6 +69,22 @@ func init() {
 	}
 }
 
+// New instantiates a new tracer instance. code is either the name of a built in
+// tracer, or a Javascript snippet which must evaluate to an expression returning
+// an object with 'step', 'fault' and 'result' functions. The optional config is
+// passed to native tracers and ignored by JavaScript ones.
+func New(code string, config json.RawMessage) (Tracer, error) {
+	// Resolve any native tracers by name
+	if constructor, ok := native[code]; ok {
+		return constructor(config)
+	}
+	// Resolve any JavaScript tracers by name and assemble the tracer object
+	if tracer, ok := tracer(code); ok {
+		code = tracer
+	}
+	return newJsTracer(code)
+}
+
 // tracer retrieves a specific JavaScript tracer by name.
 func tracer(name string) (string, bool) {
 	if tracer, ok := all[name]; ok {
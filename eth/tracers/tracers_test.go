@@ -171,10 +171,13 @@ func TestPrestateTracerCreate2(t *testing.T) {
 	statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), alloc)
 
 	// Create the tracer, the EVM environment and run it
-	tracer, err := New("prestateTracer")
+	tracer, err := New("prestateTracer", nil)
 	if err != nil {
 		t.Fatalf("failed to create call tracer: %v", err)
 	}
+	if _, ok := tracer.(*jsTracer); !ok {
+		t.Fatalf("prestateTracer resolved to %T, want the JavaScript tracer", tracer)
+	}
 	evm := vm.NewEVM(context, statedb, params.MainnetChainConfig, vm.Config{Debug: true, Tracer: tracer})
 
 	msg, err := tx.AsMessage(signer)
@@ -200,8 +203,21 @@ func TestPrestateTracerCreate2(t *testing.T) {
 }
 
 // Iterates over all the input-output datasets in the tracer test harness and
-// runs the JavaScript tracers against them.
+// runs the native call tracer against them.
 func TestCallTracer(t *testing.T) {
+	testCallTracer(t, func() (Tracer, error) { return New("callTracer", nil) })
+}
+
+// Iterates over all the input-output datasets in the tracer test harness and
+// runs the JavaScript call tracer against them.
+func TestCallTracerJs(t *testing.T) {
+	testCallTracer(t, func() (Tracer, error) {
+		code, _ := tracer("callTracer")
+		return newJsTracer(code)
+	})
+}
+
+func testCallTracer(t *testing.T, newTracer func() (Tracer, error)) {
 	files, err := ioutil.ReadDir("testdata")
 	if err != nil {
 		t.Fatalf("failed to retrieve tracer test suite: %v", err)
@@ -245,7 +261,7 @@ func TestCallTracer(t *testing.T) {
 			statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), test.Genesis.Alloc)
 
 			// Create the tracer, the EVM environment and run it
-			tracer, err := New("callTracer")
+			tracer, err := newTracer()
 			if err != nil {
 				t.Fatalf("failed to create call tracer: %v", err)
 			}
@@ -275,3 +291,187 @@ func TestCallTracer(t *testing.T) {
 		})
 	}
 }
+
+// tracerTestKey signs the transactions executed by runTracerOnTx.
+var tracerTestKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+
+// tracerTestCoinbase is the coinbase of the block runTracerOnTx executes in.
+var tracerTestCoinbase = common.HexToAddress("0x000000000000000000000000000000000000c0de")
+
+// runTracerOnTx signs the given transaction with tracerTestKey, executes it on
+// top of the given pre-state with the tracer attached and returns the result.
+func runTracerOnTx(t *testing.T, alloc core.GenesisAlloc, tx *types.Transaction, tracer Tracer) json.RawMessage {
+	t.Helper()
+
+	signer := types.NewEIP155Signer(big.NewInt(1))
+	tx, err := types.SignTx(tx, signer, tracerTestKey)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	context := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Origin:      crypto.PubkeyToAddress(tracerTestKey.PublicKey),
+		Coinbase:    tracerTestCoinbase,
+		BlockNumber: new(big.Int).SetUint64(8000000),
+		Time:        new(big.Int).SetUint64(5),
+		Difficulty:  big.NewInt(0x30000),
+		GasLimit:    uint64(6000000),
+		GasPrice:    big.NewInt(1),
+	}
+	statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), alloc)
+	evm := vm.NewEVM(context, statedb, params.MainnetChainConfig, vm.Config{Debug: true, Tracer: tracer})
+
+	msg, err := tx.AsMessage(signer)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	tracer.CaptureTxStart(evm, msg)
+
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	if _, _, _, err = st.TransitionDb(); err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	statedb.Finalise(true)
+
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	return res
+}
+
+// Tests that the prestate tracer in diff mode reports both the pre- and the
+// post-state of all the modified accounts and storage slots.
+func TestPrestateTracerDiffMode(t *testing.T) {
+	var (
+		origin    = crypto.PubkeyToAddress(tracerTestKey.PublicKey)
+		contract  = common.HexToAddress("0x00000000000000000000000000000000deadbeef")
+		recipient = common.HexToAddress("0x00000000000000000000000000000000deadbeee")
+		funds     = big.NewInt(500000000000000)
+	)
+	balance := func(diff map[common.Address]*prestateAccount, addr common.Address) *big.Int {
+		if account := diff[addr]; account != nil && account.Balance != nil {
+			return account.Balance.ToInt()
+		}
+		return nil
+	}
+	nonce := func(diff map[common.Address]*prestateAccount, addr common.Address) uint64 {
+		if account := diff[addr]; account != nil && account.Nonce != nil {
+			return *account.Nonce
+		}
+		return 0
+	}
+	cases := []struct {
+		name  string
+		alloc core.GenesisAlloc
+		tx    *types.Transaction
+		check func(t *testing.T, diff *prestateDiff)
+	}{
+		{
+			name: "storage",
+			alloc: core.GenesisAlloc{
+				// PUSH1 1 PUSH1 0 SSTORE STOP
+				contract: {Nonce: 1, Code: hexutil.MustDecode("0x600160005500"), Balance: big.NewInt(1)},
+				origin:   {Nonce: 1, Balance: funds},
+			},
+			tx: types.NewTransaction(1, contract, big.NewInt(1000), 5000000, big.NewInt(1), []byte{}),
+			check: func(t *testing.T, diff *prestateDiff) {
+				if have := balance(diff.Post, origin); have == nil || have.Cmp(funds) >= 0 || nonce(diff.Post, origin) != 2 {
+					t.Errorf("origin post-state mismatch: have balance %v nonce %d", have, nonce(diff.Post, origin))
+				}
+				if pre := diff.Pre[contract]; pre == nil || pre.Storage[common.Hash{}] != (common.Hash{}) {
+					t.Errorf("contract pre-state slot mismatch: have %+v, want 0", pre)
+				}
+				post := diff.Post[contract]
+				if post == nil || post.Storage[common.Hash{}] != common.BigToHash(big.NewInt(1)) {
+					t.Fatalf("contract post-state slot mismatch: have %+v, want 1", post)
+				}
+				if have := balance(diff.Post, contract); have == nil || have.Cmp(big.NewInt(1001)) != 0 {
+					t.Errorf("contract post-state balance mismatch: have %v, want 1001", have)
+				}
+				if post.Code != nil {
+					t.Errorf("unmodified contract code reported in post-state: %x", *post.Code)
+				}
+			},
+		},
+		{
+			name: "transfer",
+			alloc: core.GenesisAlloc{
+				origin: {Nonce: 1, Balance: funds},
+			},
+			tx: types.NewTransaction(1, recipient, big.NewInt(1000), 21000, big.NewInt(1), nil),
+			check: func(t *testing.T, diff *prestateDiff) {
+				want := new(big.Int).Sub(funds, big.NewInt(1000+21000))
+				if have := balance(diff.Post, origin); have == nil || have.Cmp(want) != 0 || nonce(diff.Post, origin) != 2 {
+					t.Errorf("origin post-state mismatch: have balance %v nonce %d, want %v nonce 2", have, nonce(diff.Post, origin), want)
+				}
+				if _, ok := diff.Pre[recipient]; ok {
+					t.Errorf("non-existent recipient reported in pre-state")
+				}
+				if have := balance(diff.Post, recipient); have == nil || have.Cmp(big.NewInt(1000)) != 0 {
+					t.Errorf("recipient post-state balance mismatch: have %v, want 1000", have)
+				}
+				if have := balance(diff.Post, tracerTestCoinbase); have == nil || have.Cmp(big.NewInt(21000)) != 0 {
+					t.Errorf("coinbase post-state balance mismatch: have %v, want 21000", have)
+				}
+			},
+		},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			tracer, err := New("prestateTracer", json.RawMessage(`{"diffMode": true}`))
+			if err != nil {
+				t.Fatalf("failed to create prestate tracer: %v", err)
+			}
+			diff := new(prestateDiff)
+			if err := json.Unmarshal(runTracerOnTx(t, test.alloc, test.tx, tracer), diff); err != nil {
+				t.Fatalf("failed to unmarshal trace result: %v", err)
+			}
+			// The sender is always captured before it pays for the gas
+			if have := balance(diff.Pre, origin); have == nil || have.Cmp(funds) != 0 || nonce(diff.Pre, origin) != 1 {
+				t.Errorf("origin pre-state mismatch: have balance %v nonce %d, want %v nonce 1", have, nonce(diff.Pre, origin), funds)
+			}
+			test.check(t, diff)
+		})
+	}
+}
+
+// Tests that a failed call to an account without code is reported identically
+// by the native and the JavaScript call tracers.
+func TestCallTracerFailedPlainCall(t *testing.T) {
+	var (
+		origin   = crypto.PubkeyToAddress(tracerTestKey.PublicKey)
+		contract = common.HexToAddress("0x00000000000000000000000000000000deadbeef")
+	)
+	// The contract has no funds, so transferring 0xff wei to a plain account fails
+	alloc := core.GenesisAlloc{
+		// PUSH1 0 PUSH1 0 PUSH1 0 PUSH1 0 PUSH1 0xff PUSH20 0xcafe.. GAS CALL STOP
+		contract: {Nonce: 1, Code: hexutil.MustDecode("0x600060006000600060ff73000000000000000000000000000000000000cafe5af100")},
+		origin:   {Nonce: 1, Balance: big.NewInt(500000000000000)},
+	}
+	tx := types.NewTransaction(1, contract, new(big.Int), 5000000, big.NewInt(1), []byte{})
+
+	native, err := New("callTracer", nil)
+	if err != nil {
+		t.Fatalf("failed to create native call tracer: %v", err)
+	}
+	code, _ := tracer("callTracer")
+	js, err := newJsTracer(code)
+	if err != nil {
+		t.Fatalf("failed to create js call tracer: %v", err)
+	}
+	have, want := new(callTrace), new(callTrace)
+	if err := json.Unmarshal(runTracerOnTx(t, alloc, tx, native), have); err != nil {
+		t.Fatalf("failed to unmarshal native trace result: %v", err)
+	}
+	if err := json.Unmarshal(runTracerOnTx(t, alloc, tx, js), want); err != nil {
+		t.Fatalf("failed to unmarshal js trace result: %v", err)
+	}
+	if len(have.Calls) != 1 || have.Calls[0].To != common.HexToAddress("0xcafe") {
+		t.Fatalf("inner call mismatch: have %+v, want a single call to %x", have.Calls, common.HexToAddress("0xcafe"))
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("trace mismatch: \nhave %+v\nwant %+v", have, want)
+	}
+}
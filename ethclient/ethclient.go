@@ -25,6 +25,7 @@ import (
 	"math/big"
 
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -267,6 +268,16 @@ func (ec *Client) TransactionReceipt(ctx context.Context, txHash common.Hash) (*
 	return r, err
 }
 
+// BlockReceipts returns the receipts of all the transactions in the given block.
+func (ec *Client) BlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]*types.Receipt, error) {
+	var r []*types.Receipt
+	err := ec.c.CallContext(ctx, &r, "eth_getBlockReceipts", blockNrOrHash)
+	if err == nil && r == nil {
+		return nil, ethereum.NotFound
+	}
+	return r, err
+}
+
 func toBlockNumArg(number *big.Int) string {
 	if number == nil {
 		return "latest"
@@ -336,6 +347,14 @@ func (ec *Client) BalanceAt(ctx context.Context, account common.Address, blockNu
 	return (*big.Int)(&result), err
 }
 
+// BalanceAtHash returns the wei balance of the given account in the state of the
+// block with the given hash.
+func (ec *Client) BalanceAtHash(ctx context.Context, account common.Address, blockHash common.Hash) (*big.Int, error) {
+	var result hexutil.Big
+	err := ec.c.CallContext(ctx, &result, "eth_getBalance", account, rpc.BlockNumberOrHashWithHash(blockHash, false))
+	return (*big.Int)(&result), err
+}
+
 // StorageAt returns the value of key in the contract storage of the given account.
 // The block number can be nil, in which case the value is taken from the latest known block.
 func (ec *Client) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
@@ -344,6 +363,14 @@ func (ec *Client) StorageAt(ctx context.Context, account common.Address, key com
 	return result, err
 }
 
+// StorageAtHash returns the value of key in the contract storage of the given
+// account in the state of the block with the given hash.
+func (ec *Client) StorageAtHash(ctx context.Context, account common.Address, key common.Hash, blockHash common.Hash) ([]byte, error) {
+	var result hexutil.Bytes
+	err := ec.c.CallContext(ctx, &result, "eth_getStorageAt", account, key, rpc.BlockNumberOrHashWithHash(blockHash, false))
+	return result, err
+}
+
 // CodeAt returns the contract code of the given account.
 // The block number can be nil, in which case the code is taken from the latest known block.
 func (ec *Client) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
@@ -352,6 +379,14 @@ func (ec *Client) CodeAt(ctx context.Context, account common.Address, blockNumbe
 	return result, err
 }
 
+// CodeAtHash returns the contract code of the given account in the state of the
+// block with the given hash.
+func (ec *Client) CodeAtHash(ctx context.Context, account common.Address, blockHash common.Hash) ([]byte, error) {
+	var result hexutil.Bytes
+	err := ec.c.CallContext(ctx, &result, "eth_getCode", account, rpc.BlockNumberOrHashWithHash(blockHash, false))
+	return result, err
+}
+
 // NonceAt returns the account nonce of the given account.
 // The block number can be nil, in which case the nonce is taken from the latest known block.
 func (ec *Client) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
@@ -360,6 +395,14 @@ func (ec *Client) NonceAt(ctx context.Context, account common.Address, blockNumb
 	return uint64(result), err
 }
 
+// NonceAtHash returns the account nonce of the given account in the state of the
+// block with the given hash.
+func (ec *Client) NonceAtHash(ctx context.Context, account common.Address, blockHash common.Hash) (uint64, error) {
+	var result hexutil.Uint64
+	err := ec.c.CallContext(ctx, &result, "eth_getTransactionCount", account, rpc.BlockNumberOrHashWithHash(blockHash, false))
+	return uint64(result), err
+}
+
 // Filters
 
 // FilterLogs executes a filter query.
@@ -455,7 +498,64 @@ func (ec *Client) CallContract(ctx context.Context, msg ethereum.CallMsg, blockN
 	var hex hexutil.Bytes
 	err := ec.c.CallContext(ctx, &hex, "eth_call", toCallArg(msg), toBlockNumArg(blockNumber))
 	if err != nil {
-		return nil, err
+		return nil, toRevertError(err)
+	}
+	return hex, nil
+}
+
+// CallContractAtHash is almost the same as CallContract except that it selects
+// the block by block hash instead of block height.
+func (ec *Client) CallContractAtHash(ctx context.Context, msg ethereum.CallMsg, blockHash common.Hash) ([]byte, error) {
+	var hex hexutil.Bytes
+	err := ec.c.CallContext(ctx, &hex, "eth_call", toCallArg(msg), rpc.BlockNumberOrHashWithHash(blockHash, false))
+	if err != nil {
+		return nil, toRevertError(err)
+	}
+	return hex, nil
+}
+
+// OverrideAccount specifies the state of an account to be overridden during a
+// message call. Nil fields are left untouched, while non-nil ones are applied
+// even if empty: an empty Code removes the contract code and a pointer to an
+// empty State map clears the entire account storage.
+type OverrideAccount struct {
+	Nonce     *uint64                      // Nonce to set for the account, if non-nil
+	Code      []byte                       // Contract code to set for the account, if non-nil
+	Balance   *big.Int                     // Balance to set for the account, if non-nil
+	State     *map[common.Hash]common.Hash // Full replacement of the account storage, if non-nil
+	StateDiff map[common.Hash]common.Hash  // Individual storage slots to override
+}
+
+// MarshalJSON implements json.Marshaler, encoding the override in the format
+// expected by eth_call and eth_estimateGas.
+func (a OverrideAccount) MarshalJSON() ([]byte, error) {
+	type override struct {
+		Nonce     *hexutil.Uint64              `json:"nonce,omitempty"`
+		Code      *hexutil.Bytes               `json:"code,omitempty"`
+		Balance   *hexutil.Big                 `json:"balance,omitempty"`
+		State     *map[common.Hash]common.Hash `json:"state,omitempty"`
+		StateDiff map[common.Hash]common.Hash  `json:"stateDiff,omitempty"`
+	}
+	enc := override{
+		Nonce:     (*hexutil.Uint64)(a.Nonce),
+		Balance:   (*hexutil.Big)(a.Balance),
+		State:     a.State,
+		StateDiff: a.StateDiff,
+	}
+	if a.Code != nil {
+		code := hexutil.Bytes(a.Code)
+		enc.Code = &code
+	}
+	return json.Marshal(enc)
+}
+
+// CallContractWithOverrides executes a message call transaction like CallContract,
+// but with the state of the given accounts overridden for the duration of the call.
+func (ec *Client) CallContractWithOverrides(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int, overrides map[common.Address]OverrideAccount) ([]byte, error) {
+	var hex hexutil.Bytes
+	err := ec.c.CallContext(ctx, &hex, "eth_call", toCallArg(msg), toBlockNumArg(blockNumber), overrides)
+	if err != nil {
+		return nil, toRevertError(err)
 	}
 	return hex, nil
 }
@@ -466,7 +566,7 @@ func (ec *Client) PendingCallContract(ctx context.Context, msg ethereum.CallMsg)
 	var hex hexutil.Bytes
 	err := ec.c.CallContext(ctx, &hex, "eth_call", toCallArg(msg), "pending")
 	if err != nil {
-		return nil, err
+		return nil, toRevertError(err)
 	}
 	return hex, nil
 }
@@ -489,7 +589,19 @@ func (ec *Client) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64
 	var hex hexutil.Uint64
 	err := ec.c.CallContext(ctx, &hex, "eth_estimateGas", toCallArg(msg))
 	if err != nil {
-		return 0, err
+		return 0, toRevertError(err)
+	}
+	return uint64(hex), nil
+}
+
+// EstimateGasWithOverrides estimates the gas needed to execute a specific
+// transaction like EstimateGas, but with the state of the given accounts
+// overridden during the estimation.
+func (ec *Client) EstimateGasWithOverrides(ctx context.Context, msg ethereum.CallMsg, overrides map[common.Address]OverrideAccount) (uint64, error) {
+	var hex hexutil.Uint64
+	err := ec.c.CallContext(ctx, &hex, "eth_estimateGas", toCallArg(msg), overrides)
+	if err != nil {
+		return 0, toRevertError(err)
 	}
 	return uint64(hex), nil
 }
@@ -525,3 +637,26 @@ func toCallArg(msg ethereum.CallMsg) interface{} {
 	}
 	return arg
 }
+
+// toRevertError converts a JSON-RPC error reporting an EVM revert into a typed
+// abi.RevertError carrying both the raw revert data and the decoded reason. Any
+// other error is returned unchanged.
+func toRevertError(err error) error {
+	rpcErr, ok := err.(rpc.Error)
+	if !ok || rpcErr.ErrorCode() != 3 {
+		return err
+	}
+	dataErr, ok := err.(rpc.DataError)
+	if !ok {
+		return err
+	}
+	hex, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return err
+	}
+	data, decodeErr := hexutil.Decode(hex)
+	if decodeErr != nil {
+		return err
+	}
+	return abi.NewRevertError(data)
+}
@@ -17,7 +17,9 @@
 package ethclient
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
@@ -26,7 +28,9 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
@@ -35,6 +39,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 // Verify that Client implements the ethereum interfaces.
@@ -301,3 +306,271 @@ func TestBalanceAt(t *testing.T) {
 		})
 	}
 }
+
+func TestCallContractWithOverrides(t *testing.T) {
+	backend, _ := newTestBackend(t)
+	client, _ := backend.Attach()
+	defer backend.Stop()
+	defer client.Close()
+
+	var (
+		contract = common.Address{0xc0}
+		slot     = common.Hash{}
+		// PUSH1 0 SLOAD PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+		code  = common.FromHex("0x60005460005260206000f3")
+		value = common.HexToHash("0x2a")
+	)
+	tests := map[string]struct {
+		override OverrideAccount
+		want     common.Hash
+	}{
+		"code_only": {
+			override: OverrideAccount{Code: code},
+			want:     common.Hash{},
+		},
+		"state": {
+			override: OverrideAccount{Code: code, State: &map[common.Hash]common.Hash{slot: value}},
+			want:     value,
+		},
+		"state_cleared": {
+			override: OverrideAccount{Code: code, State: &map[common.Hash]common.Hash{}},
+			want:     common.Hash{},
+		},
+		"state_diff": {
+			override: OverrideAccount{Code: code, StateDiff: map[common.Hash]common.Hash{slot: value}},
+			want:     value,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ec := NewClient(client)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			msg := ethereum.CallMsg{From: testAddr, To: &contract}
+			got, err := ec.CallContractWithOverrides(ctx, msg, big.NewInt(1), map[common.Address]OverrideAccount{contract: tt.override})
+			if err != nil {
+				t.Fatalf("CallContractWithOverrides error: %v", err)
+			}
+			if common.BytesToHash(got) != tt.want {
+				t.Fatalf("CallContractWithOverrides = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverrideAccountMarshal(t *testing.T) {
+	zero, one := uint64(0), uint64(1)
+
+	tests := []struct {
+		override OverrideAccount
+		want     string
+	}{
+		{OverrideAccount{}, `{}`},
+		{OverrideAccount{Nonce: &zero}, `{"nonce":"0x0"}`},
+		{OverrideAccount{Nonce: &one, Balance: big.NewInt(0)}, `{"nonce":"0x1","balance":"0x0"}`},
+		{OverrideAccount{Code: []byte{}}, `{"code":"0x"}`},
+		{OverrideAccount{State: &map[common.Hash]common.Hash{}}, `{"state":{}}`},
+	}
+	for i, tt := range tests {
+		blob, err := json.Marshal(tt.override)
+		if err != nil {
+			t.Fatalf("test %d: failed to marshal: %v", i, err)
+		}
+		if string(blob) != tt.want {
+			t.Errorf("test %d: encoding mismatch: have %s, want %s", i, blob, tt.want)
+		}
+	}
+}
+
+func TestCallContractRevert(t *testing.T) {
+	backend, _ := newTestBackend(t)
+	client, _ := backend.Attach()
+	defer backend.Stop()
+	defer client.Close()
+
+	var (
+		contract = common.Address{0xc0}
+		// Error("revert reason") abi-encoded
+		reason = common.FromHex("0x08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000d72657665727420726561736f6e00000000000000000000000000000000000000")
+		// PUSH1 100 PUSH1 12 PUSH1 0 CODECOPY PUSH1 100 PUSH1 0 REVERT
+		code      = append(common.FromHex("0x6064600c60003960646000fd"), reason...)
+		overrides = map[common.Address]OverrideAccount{contract: {Code: code}}
+		msg       = ethereum.CallMsg{From: testAddr, To: &contract}
+	)
+	ec := NewClient(client)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	check := func(method string, err error) {
+		revert, ok := err.(*abi.RevertError)
+		if !ok {
+			t.Fatalf("%s: error type mismatch: have %T (%v), want *abi.RevertError", method, err, err)
+		}
+		if revert.Reason != "revert reason" {
+			t.Errorf("%s: revert reason mismatch: have %q, want %q", method, revert.Reason, "revert reason")
+		}
+		if !bytes.Equal(revert.Data, reason) {
+			t.Errorf("%s: revert data mismatch: have %x, want %x", method, revert.Data, reason)
+		}
+	}
+	_, err := ec.CallContractWithOverrides(ctx, msg, nil, overrides)
+	check("CallContract", err)
+
+	_, err = ec.EstimateGasWithOverrides(ctx, msg, overrides)
+	check("EstimateGas", err)
+}
+
+// newTransferTestBackend starts a node on top of a chain whose blocks each contain
+// a free self-transfer of the test account, so every block has a receipt.
+func newTransferTestBackend(t *testing.T) (*node.Node, []*types.Block) {
+	genesis, blocks := generateTransferTestChain()
+
+	var ethservice *eth.Ethereum
+	n, err := node.New(&node.Config{})
+	n.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		config := &eth.Config{Genesis: genesis}
+		config.Ethash.PowMode = ethash.ModeFake
+		ethservice, err = eth.New(ctx, config)
+		return ethservice, err
+	})
+	if err := n.Start(); err != nil {
+		t.Fatalf("can't start test node: %v", err)
+	}
+	if _, err := ethservice.BlockChain().InsertChain(blocks[1:]); err != nil {
+		t.Fatalf("can't import test blocks: %v", err)
+	}
+	return n, blocks
+}
+
+func generateTransferTestChain() (*core.Genesis, []*types.Block) {
+	db := rawdb.NewMemoryDatabase()
+	config := params.AllEthashProtocolChanges
+	genesis := &core.Genesis{
+		Config:    config,
+		Alloc:     core.GenesisAlloc{testAddr: {Balance: testBalance}},
+		ExtraData: []byte("test genesis"),
+		Timestamp: 9000,
+	}
+	generate := func(i int, g *core.BlockGen) {
+		g.OffsetTime(5)
+		g.SetExtra([]byte("test"))
+
+		// The transfer is free, so the test account's balance is unaffected
+		signer := types.MakeSigner(config, g.Number())
+		tx, _ := types.SignTx(types.NewTransaction(g.TxNonce(testAddr), testAddr, new(big.Int), params.TxGas, new(big.Int), nil), signer, testKey)
+		g.AddTx(tx)
+	}
+	gblock := genesis.ToBlock(db)
+	engine := ethash.NewFaker()
+	blocks, _ := core.GenerateChain(config, gblock, engine, db, 1, generate)
+	blocks = append([]*types.Block{gblock}, blocks...)
+	return genesis, blocks
+}
+
+func TestBlockReceipts(t *testing.T) {
+	backend, chain := newTransferTestBackend(t)
+	client, _ := backend.Attach()
+	defer backend.Stop()
+	defer client.Close()
+
+	tests := map[string]struct {
+		block   rpc.BlockNumberOrHash
+		want    types.Transactions
+		wantErr error
+	}{
+		"genesis": {
+			block: rpc.BlockNumberOrHashWithNumber(0),
+			want:  types.Transactions{},
+		},
+		"by_number": {
+			block: rpc.BlockNumberOrHashWithNumber(1),
+			want:  chain[1].Transactions(),
+		},
+		"by_hash": {
+			block: rpc.BlockNumberOrHashWithHash(chain[1].Hash(), true),
+			want:  chain[1].Transactions(),
+		},
+		"future_block": {
+			block:   rpc.BlockNumberOrHashWithNumber(1000000000),
+			wantErr: ethereum.NotFound,
+		},
+		"unknown_hash": {
+			block:   rpc.BlockNumberOrHashWithHash(common.Hash{1}, false),
+			wantErr: errors.New("header for hash not found"),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ec := NewClient(client)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			got, err := ec.BlockReceipts(ctx, tt.block)
+			if tt.wantErr != nil {
+				if err == nil || err.Error() != tt.wantErr.Error() {
+					t.Fatalf("BlockReceipts(%v) error = %q, want %q", tt.block.String(), err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BlockReceipts(%v) error: %v", tt.block.String(), err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("BlockReceipts(%v) returned %d receipts, want %d", tt.block.String(), len(got), len(tt.want))
+			}
+			for i, receipt := range got {
+				if receipt.TxHash != tt.want[i].Hash() {
+					t.Errorf("receipt %d: tx hash mismatch: have %x, want %x", i, receipt.TxHash, tt.want[i].Hash())
+				}
+				if receipt.Status != types.ReceiptStatusSuccessful {
+					t.Errorf("receipt %d: status mismatch: have %d, want %d", i, receipt.Status, types.ReceiptStatusSuccessful)
+				}
+			}
+		})
+	}
+}
+
+func TestStateAccessByHash(t *testing.T) {
+	backend, chain := newTransferTestBackend(t)
+	client, _ := backend.Attach()
+	defer backend.Stop()
+	defer client.Close()
+
+	ec := NewClient(client)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// The balance is unaffected by the free transfer, but the nonce is bumped
+	balance, err := ec.BalanceAtHash(ctx, testAddr, chain[1].Hash())
+	if err != nil {
+		t.Fatalf("BalanceAtHash error: %v", err)
+	}
+	if balance.Cmp(testBalance) != 0 {
+		t.Errorf("BalanceAtHash = %v, want %v", balance, testBalance)
+	}
+	for i, want := range []uint64{0, 1} {
+		nonce, err := ec.NonceAtHash(ctx, testAddr, chain[i].Hash())
+		if err != nil {
+			t.Fatalf("NonceAtHash(block %d) error: %v", i, err)
+		}
+		if nonce != want {
+			t.Errorf("NonceAtHash(block %d) = %d, want %d", i, nonce, want)
+		}
+	}
+	code, err := ec.CodeAtHash(ctx, testAddr, chain[1].Hash())
+	if err != nil {
+		t.Fatalf("CodeAtHash error: %v", err)
+	}
+	if len(code) != 0 {
+		t.Errorf("CodeAtHash = %x, want empty", code)
+	}
+	if _, err := ec.BalanceAtHash(ctx, testAddr, common.Hash{1}); err == nil || err.Error() != "header for hash not found" {
+		t.Errorf("BalanceAtHash(unknown) error = %v, want %q", err, "header for hash not found")
+	}
+	// Requiring the block to be canonical succeeds for blocks on the main chain
+	var result hexutil.Big
+	if err := client.CallContext(ctx, &result, "eth_getBalance", testAddr, rpc.BlockNumberOrHashWithHash(chain[1].Hash(), true)); err != nil {
+		t.Errorf("eth_getBalance(canonical) error: %v", err)
+	}
+}
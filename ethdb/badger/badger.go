@@ -0,0 +1,474 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !js
+
+// Package badger implements the key-value database layer based on Badger.
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/dgraph-io/badger/y"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// gcInterval specifies how often the value log is garbage collected to reclaim
+	// the space of deleted and overwritten values.
+	gcInterval = 5 * time.Minute
+
+	// gcDiscardRatio is the fraction of stale data a value log file needs to
+	// contain for garbage collection to rewrite it.
+	gcDiscardRatio = 0.5
+
+	// metricsGatheringInterval specifies the interval to retrieve badger database
+	// io stats to report to the user.
+	metricsGatheringInterval = 3 * time.Second
+)
+
+// errUnknownProperty is returned if a database stat is requested which is not
+// supported by badger.
+var errUnknownProperty = errors.New("unknown property")
+
+// Database is a persistent key-value store. Apart from basic data storage
+// functionality it also supports batch writes and iterating over the keyspace in
+// binary-alphabetical order.
+type Database struct {
+	fn string     // filename for reporting
+	db *badger.DB // Badger instance
+
+	diskReadMeter  metrics.Meter // Meter for measuring the effective amount of data read
+	diskWriteMeter metrics.Meter // Meter for measuring the effective amount of data written
+
+	quitLock sync.Mutex      // Mutex protecting the quit channel access
+	quitChan chan chan error // Quit channel to stop the maintenance before closing the database
+
+	log log.Logger // Contextual logger tracking the database path
+}
+
+// New returns a wrapped Badger object. The namespace is the prefix that the
+// metrics reporting should use for surfacing internal stats.
+//
+// Badger memory maps its tables and value logs and doesn't keep file handles per
+// table, so the cache and handle allowances of leveldb are not applicable.
+func New(file string, namespace string) (*Database, error) {
+	logger := log.New("database", file)
+
+	// Badger doesn't create missing parent directories, unlike leveldb
+	if err := os.MkdirAll(file, 0700); err != nil {
+		return nil, err
+	}
+	opts := badger.DefaultOptions(file).
+		WithSyncWrites(false).
+		WithTruncate(true).
+		WithLogger(&badgerLogger{logger})
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	bdb := &Database{
+		fn:       file,
+		db:       db,
+		log:      logger,
+		quitChan: make(chan chan error),
+	}
+	bdb.diskReadMeter = metrics.NewRegisteredMeter(namespace+"disk/read", nil)
+	bdb.diskWriteMeter = metrics.NewRegisteredMeter(namespace+"disk/write", nil)
+
+	// Start up the metrics gathering and garbage collection and return
+	go bdb.maintain(metricsGatheringInterval, gcInterval)
+	return bdb, nil
+}
+
+// Close stops the maintenance, flushes any pending data to disk and closes all
+// io accesses to the underlying key-value store.
+func (db *Database) Close() error {
+	db.quitLock.Lock()
+	defer db.quitLock.Unlock()
+
+	if db.quitChan != nil {
+		errc := make(chan error)
+		db.quitChan <- errc
+		if err := <-errc; err != nil {
+			db.log.Error("Value log garbage collection failed", "err", err)
+		}
+		db.quitChan = nil
+	}
+	return db.db.Close()
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	err := db.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(key)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	var dat []byte
+	err := db.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		dat, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dat, nil
+}
+
+// Put inserts the given value into the key-value store.
+func (db *Database) Put(key []byte, value []byte) error {
+	return db.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, value)
+	})
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	return db.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	})
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() ethdb.Batch {
+	return &batch{db: db.db}
+}
+
+// NewIterator creates a binary-alphabetical iterator over the entire keyspace
+// contained within the badger database.
+func (db *Database) NewIterator() ethdb.Iterator {
+	return newIterator(db.db, nil, nil)
+}
+
+// NewIteratorWithStart creates a binary-alphabetical iterator over a subset of
+// database content starting at a particular initial key (or after, if it does
+// not exist).
+func (db *Database) NewIteratorWithStart(start []byte) ethdb.Iterator {
+	return newIterator(db.db, nil, start)
+}
+
+// NewIteratorWithPrefix creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix.
+func (db *Database) NewIteratorWithPrefix(prefix []byte) ethdb.Iterator {
+	return newIterator(db.db, prefix, prefix)
+}
+
+// Stat returns a particular internal stat of the database. The supported
+// properties are "badger.size" for the size of the LSM tree and value log, and
+// "badger.tables" for the number of tables and keys on each level.
+func (db *Database) Stat(property string) (string, error) {
+	switch property {
+	case "badger.size":
+		lsm, vlog := db.db.Size()
+		return fmt.Sprintf("LSM tree: %v, value log: %v", common.StorageSize(lsm), common.StorageSize(vlog)), nil
+
+	case "badger.tables":
+		var (
+			tables []int
+			keys   []uint64
+		)
+		for _, table := range db.db.Tables(true) {
+			for len(tables) <= table.Level {
+				tables, keys = append(tables, 0), append(keys, 0)
+			}
+			tables[table.Level]++
+			keys[table.Level] += table.KeyCount
+		}
+		var out strings.Builder
+		out.WriteString(" Level | Tables |       Keys\n-------+--------+-----------\n")
+		for level := range tables {
+			fmt.Fprintf(&out, " %5d | %6d | %10d\n", level, tables[level], keys[level])
+		}
+		return out.String(), nil
+	}
+	return "", errUnknownProperty
+}
+
+// Compact flattens the underlying data store and garbage collects its value log.
+// In essence, deleted and overwritten versions are discarded, and the data is
+// rearranged to reduce the cost of operations needed to access them.
+//
+// Badger can't compact a key range, so the entire data store is compacted
+// regardless of the range requested.
+func (db *Database) Compact(start []byte, limit []byte) error {
+	if err := db.db.Flatten(1); err != nil {
+		return err
+	}
+	return db.collectGarbage()
+}
+
+// Path returns the path to the database directory.
+func (db *Database) Path() string {
+	return db.fn
+}
+
+// collectGarbage rewrites value log files until there are none left which are
+// worth rewriting.
+func (db *Database) collectGarbage() error {
+	for {
+		switch err := db.db.RunValueLogGC(gcDiscardRatio); err {
+		case nil:
+		case badger.ErrNoRewrite, badger.ErrRejected:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// maintain periodically retrieves the badger io counters, reporting them to the
+// metrics subsystem, and garbage collects the value log.
+//
+// Badger only exposes process wide io counters, so the meters of multiple badger
+// databases all report the total io of the process.
+func (db *Database) maintain(refresh time.Duration, gc time.Duration) {
+	var (
+		iostats [2]int64
+		errc    chan error
+		merr    error
+		gcTimer = time.NewTimer(gc)
+	)
+	defer gcTimer.Stop()
+
+	for errc == nil && merr == nil {
+		// Update all the requested meters
+		nRead, nWrite := y.NumBytesRead.Value(), y.NumBytesWritten.Value()
+		if db.diskReadMeter != nil {
+			db.diskReadMeter.Mark(nRead - iostats[0])
+		}
+		if db.diskWriteMeter != nil {
+			db.diskWriteMeter.Mark(nWrite - iostats[1])
+		}
+		iostats[0], iostats[1] = nRead, nWrite
+
+		// Sleep a bit, garbage collecting the value log if it's due
+		select {
+		case errc = <-db.quitChan:
+			// Quit requesting, stop hammering the database
+		case <-gcTimer.C:
+			start := time.Now()
+			merr = db.collectGarbage()
+			db.log.Debug("Collected value log garbage", "elapsed", common.PrettyDuration(time.Since(start)))
+			gcTimer.Reset(gc)
+		case <-time.After(refresh):
+			// Timeout, gather a new set of stats
+		}
+	}
+	if errc == nil {
+		errc = <-db.quitChan
+	}
+	errc <- merr
+}
+
+// badgerLogger forwards the log messages of badger to the contextual logger of
+// the database, demoting its informational messages to debug level.
+type badgerLogger struct {
+	log log.Logger
+}
+
+func (l *badgerLogger) Errorf(format string, args ...interface{}) {
+	l.log.Error(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (l *badgerLogger) Warningf(format string, args ...interface{}) {
+	l.log.Warn(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (l *badgerLogger) Infof(format string, args ...interface{}) {
+	l.log.Debug(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (l *badgerLogger) Debugf(format string, args ...interface{}) {
+	l.log.Trace(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+// keyvalue is a key-value tuple tagged with a deletion field to allow creating
+// badger write batches.
+type keyvalue struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// batch is a write-only badger batch that commits changes to its host database
+// when Write is called. A batch cannot be used concurrently.
+//
+// Badger transactions are limited in size, so batches exceeding the limit are
+// written in multiple transactions and are not atomic.
+type batch struct {
+	db     *badger.DB
+	writes []keyvalue
+	size   int
+}
+
+// Put inserts the given value into the batch for later committing.
+func (b *batch) Put(key, value []byte) error {
+	b.writes = append(b.writes, keyvalue{common.CopyBytes(key), common.CopyBytes(value), false})
+	b.size += len(value)
+	return nil
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	b.writes = append(b.writes, keyvalue{common.CopyBytes(key), nil, true})
+	b.size++
+	return nil
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.size
+}
+
+// Write flushes any accumulated data to disk.
+func (b *batch) Write() error {
+	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, keyvalue := range b.writes {
+		var err error
+		if keyvalue.delete {
+			err = wb.Delete(keyvalue.key)
+		} else {
+			err = wb.Set(keyvalue.key, keyvalue.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
+
+// Replay replays the batch contents.
+func (b *batch) Replay(w ethdb.KeyValueWriter) error {
+	for _, keyvalue := range b.writes {
+		if keyvalue.delete {
+			if err := w.Delete(keyvalue.key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.Put(keyvalue.key, keyvalue.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iterator is a binary-alphabetical iterator over the keys of a badger read-only
+// transaction, so it iterates over a consistent snapshot of the database.
+type iterator struct {
+	txn    *badger.Txn
+	it     *badger.Iterator
+	prefix []byte
+	moved  bool   // Whether the iterator was positioned onto its first item
+	value  []byte // Value of the current item, reused across items
+	err    error
+}
+
+// newIterator creates an iterator over the keys with the given prefix, starting
+// at the given key.
+func newIterator(db *badger.DB, prefix []byte, start []byte) *iterator {
+	txn := db.NewTransaction(false)
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+
+	it := txn.NewIterator(opts)
+	it.Seek(start)
+
+	return &iterator{txn: txn, it: it, prefix: prefix}
+}
+
+// Next moves the iterator to the next key/value pair. It returns whether the
+// iterator is exhausted.
+func (it *iterator) Next() bool {
+	if it.it == nil || it.err != nil {
+		return false
+	}
+	if it.moved {
+		it.it.Next()
+	}
+	it.moved = true
+
+	if !it.it.ValidForPrefix(it.prefix) {
+		return false
+	}
+	it.value, it.err = it.it.Item().ValueCopy(it.value[:0])
+	return it.err == nil
+}
+
+// Error returns any accumulated error. Exhausting all the key/value pairs is not
+// considered to be an error.
+func (it *iterator) Error() error {
+	return it.err
+}
+
+// Key returns the key of the current key/value pair, or nil if done.
+func (it *iterator) Key() []byte {
+	if it.it == nil || !it.moved || !it.it.ValidForPrefix(it.prefix) {
+		return nil
+	}
+	return it.it.Item().Key()
+}
+
+// Value returns the value of the current key/value pair, or nil if done.
+func (it *iterator) Value() []byte {
+	if it.it == nil || !it.moved || !it.it.ValidForPrefix(it.prefix) {
+		return nil
+	}
+	return it.value
+}
+
+// Release releases associated resources. Release should always succeed and can
+// be called multiple times without causing error.
+func (it *iterator) Release() {
+	if it.it != nil {
+		it.it.Close()
+		it.txn.Discard()
+		it.it = nil
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dbtest contains a test suite shared by all key-value store
+// implementations.
+package dbtest
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// TestDatabaseSuite runs a suite of tests against a KeyValueStore database
+// implementation. The constructor must return a new, empty database on every
+// invocation, which is closed by the suite.
+func TestDatabaseSuite(t *testing.T, New func() ethdb.KeyValueStore) {
+	t.Run("Iterator", func(t *testing.T) {
+		tests := []struct {
+			content map[string]string
+			prefix  string
+			order   []string
+		}{
+			// Empty databases should be iterable
+			{map[string]string{}, "", nil},
+			{map[string]string{}, "non-existent-prefix", nil},
+
+			// Single-item databases should be iterable
+			{map[string]string{"key": "val"}, "", []string{"key"}},
+			{map[string]string{"key": "val"}, "k", []string{"key"}},
+			{map[string]string{"key": "val"}, "l", nil},
+
+			// Multi-item databases should be fully iterable
+			{
+				map[string]string{"k1": "v1", "k5": "v5", "k2": "v2", "k4": "v4", "k3": "v3"},
+				"",
+				[]string{"k1", "k2", "k3", "k4", "k5"},
+			},
+			{
+				map[string]string{"k1": "v1", "k5": "v5", "k2": "v2", "k4": "v4", "k3": "v3"},
+				"k",
+				[]string{"k1", "k2", "k3", "k4", "k5"},
+			},
+			{
+				map[string]string{"k1": "v1", "k5": "v5", "k2": "v2", "k4": "v4", "k3": "v3"},
+				"l",
+				nil,
+			},
+			// Multi-item databases should be prefix-iterable
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"ka",
+				[]string{"ka1", "ka2", "ka3", "ka4", "ka5"},
+			},
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"kc",
+				nil,
+			},
+		}
+		for i, tt := range tests {
+			// Create the key-value data store
+			db := New()
+			for key, val := range tt.content {
+				if err := db.Put([]byte(key), []byte(val)); err != nil {
+					t.Fatalf("test %d: failed to insert item %s:%s into database: %v", i, key, val, err)
+				}
+			}
+			// Iterate over the database with the given configs and verify the results
+			it, idx := db.NewIteratorWithPrefix([]byte(tt.prefix)), 0
+			for it.Next() {
+				if len(tt.order) <= idx {
+					t.Errorf("test %d: prefix=%q more items than expected: checking idx=%d (key %q), expecting len=%d", i, tt.prefix, idx, it.Key(), len(tt.order))
+					break
+				}
+				if !bytes.Equal(it.Key(), []byte(tt.order[idx])) {
+					t.Errorf("test %d: item %d: key mismatch: have %s, want %s", i, idx, string(it.Key()), tt.order[idx])
+				}
+				if !bytes.Equal(it.Value(), []byte(tt.content[tt.order[idx]])) {
+					t.Errorf("test %d: item %d: value mismatch: have %s, want %s", i, idx, string(it.Value()), tt.content[tt.order[idx]])
+				}
+				idx++
+			}
+			if err := it.Error(); err != nil {
+				t.Errorf("test %d: iteration failed: %v", i, err)
+			}
+			if idx != len(tt.order) {
+				t.Errorf("test %d: iteration terminated prematurely: have %d, want %d", i, idx, len(tt.order))
+			}
+			it.Release()
+			db.Close()
+		}
+	})
+
+	t.Run("IteratorWithStart", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		keys := []string{"1", "2", "3", "4", "6", "10", "11", "12", "20", "21", "22"}
+		sort.Strings(keys) // 1, 10, 11, etc
+
+		for _, k := range keys {
+			if err := db.Put([]byte(k), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tests := []struct {
+			start string
+			order []string
+		}{
+			{"", keys},
+			{"1", keys},
+			{"10", []string{"10", "11", "12", "2", "20", "21", "22", "3", "4", "6"}},
+			{"13", []string{"2", "20", "21", "22", "3", "4", "6"}},
+			{"5", []string{"6"}},
+			{"7", nil},
+		}
+		for i, tt := range tests {
+			have := iterateKeys(db.NewIteratorWithStart([]byte(tt.start)))
+			if !reflect.DeepEqual(have, tt.order) {
+				t.Errorf("test %d: start %q: keys mismatch: have %v, want %v", i, tt.start, have, tt.order)
+			}
+		}
+	})
+
+	t.Run("KeyValueOperations", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		key := []byte("foo")
+
+		if got, err := db.Has(key); err != nil {
+			t.Error(err)
+		} else if got {
+			t.Errorf("wrong value: %t", got)
+		}
+		value := []byte("hello world")
+		if err := db.Put(key, value); err != nil {
+			t.Error(err)
+		}
+		if got, err := db.Has(key); err != nil {
+			t.Error(err)
+		} else if !got {
+			t.Errorf("wrong value: %t", got)
+		}
+		if got, err := db.Get(key); err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(got, value) {
+			t.Errorf("wrong value: %q", got)
+		}
+		// Modifying the inserted value should not affect the stored one
+		value[0] = 'H'
+		if got, err := db.Get(key); err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(got, []byte("hello world")) {
+			t.Errorf("stored value modified: %q", got)
+		}
+		if err := db.Put(key, []byte("overwritten")); err != nil {
+			t.Error(err)
+		}
+		if got, err := db.Get(key); err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(got, []byte("overwritten")) {
+			t.Errorf("wrong value after overwrite: %q", got)
+		}
+		if err := db.Delete(key); err != nil {
+			t.Error(err)
+		}
+		if got, err := db.Has(key); err != nil {
+			t.Error(err)
+		} else if got {
+			t.Errorf("wrong value: %t", got)
+		}
+		if _, err := db.Get(key); err == nil {
+			t.Errorf("deleted key retrieved")
+		}
+		// Deleting a missing key should not fail
+		if err := db.Delete([]byte("missing")); err != nil {
+			t.Errorf("failed to delete missing key: %v", err)
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		b := db.NewBatch()
+		for _, k := range []string{"1", "2", "3", "4"} {
+			if err := b.Put([]byte(k), []byte(k)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if has, err := db.Has([]byte("1")); err != nil {
+			t.Fatal(err)
+		} else if has {
+			t.Error("db contains element before batch write")
+		}
+		if size := b.ValueSize(); size != 4 {
+			t.Errorf("batch value size mismatch: have %d, want %d", size, 4)
+		}
+		if err := b.Write(); err != nil {
+			t.Fatal(err)
+		}
+		if have := iterateKeys(db.NewIterator()); !reflect.DeepEqual(have, []string{"1", "2", "3", "4"}) {
+			t.Errorf("keys mismatch after write: have %v", have)
+		}
+		// Deletions should be applied after the preceding insertions
+		b.Reset()
+		if size := b.ValueSize(); size != 0 {
+			t.Errorf("batch value size mismatch after reset: have %d, want %d", size, 0)
+		}
+		b.Put([]byte("5"), []byte("5"))
+		b.Delete([]byte("5"))
+		b.Delete([]byte("2"))
+		b.Delete([]byte("4"))
+		if err := b.Write(); err != nil {
+			t.Fatal(err)
+		}
+		if have := iterateKeys(db.NewIterator()); !reflect.DeepEqual(have, []string{"1", "3"}) {
+			t.Errorf("keys mismatch after deletion: have %v", have)
+		}
+		// Replaying the batch should apply the same operations to another writer
+		b.Reset()
+		b.Put([]byte("7"), []byte("7"))
+		b.Delete([]byte("1"))
+
+		other := New()
+		defer other.Close()
+		other.Put([]byte("1"), []byte("1"))
+		if err := b.Replay(other); err != nil {
+			t.Fatal(err)
+		}
+		if have := iterateKeys(other.NewIterator()); !reflect.DeepEqual(have, []string{"7"}) {
+			t.Errorf("keys mismatch after replay: have %v", have)
+		}
+	})
+
+	t.Run("BatchReplay", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		want := []string{"1", "2", "3", "4"}
+		b := db.NewBatch()
+		for _, k := range want {
+			if err := b.Put([]byte(k), []byte(k)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		b2 := db.NewBatch()
+		if err := b.Replay(b2); err != nil {
+			t.Fatal(err)
+		}
+		if err := b2.Write(); err != nil {
+			t.Fatal(err)
+		}
+		if have := iterateKeys(db.NewIterator()); !reflect.DeepEqual(have, want) {
+			t.Errorf("keys mismatch: have %v, want %v", have, want)
+		}
+	})
+
+	t.Run("Snapshot", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		// Writes during an iteration must not invalidate the iterator
+		for _, k := range []string{"1", "2", "3"} {
+			db.Put([]byte(k), []byte(k))
+		}
+		it := db.NewIterator()
+		defer it.Release()
+
+		var keys []string
+		for it.Next() {
+			keys = append(keys, string(it.Key()))
+			db.Delete(it.Key())
+		}
+		if err := it.Error(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(keys, []string{"1", "2", "3"}) {
+			t.Errorf("keys mismatch: have %v", keys)
+		}
+		if have := iterateKeys(db.NewIterator()); len(have) != 0 {
+			t.Errorf("keys not deleted: %v", have)
+		}
+	})
+}
+
+// iterateKeys drains an iterator, returning the keys it yielded.
+func iterateKeys(it ethdb.Iterator) []string {
+	defer it.Release()
+
+	var keys []string
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	return keys
+}
@@ -47,6 +47,10 @@ import (
 var OnlyOnMainChainError = errors.New("This operation is only available for blocks on the canonical chain.")
 var BlockInvariantError = errors.New("Block objects must be instantiated with at least one of num or hash.")
 
+// errMultiplexNoHTTP is returned if GraphQL should be multiplexed onto the HTTP
+// RPC endpoint, but that is not enabled.
+var errMultiplexNoHTTP = errors.New("GraphQL multiplexing requires the HTTP RPC endpoint to be enabled")
+
 // Account represents an Ethereum account at a particular block.
 type Account struct {
 	backend     *eth.EthAPIBackend
@@ -337,6 +341,55 @@ func (t *Transaction) Logs(ctx context.Context) (*[]*Log, error) {
 	return &ret, nil
 }
 
+// Receipt represents the receipt of a transaction included in a block.
+type Receipt struct {
+	transaction *Transaction
+	receipt     *types.Receipt
+}
+
+func (r *Receipt) Transaction(ctx context.Context) *Transaction {
+	return r.transaction
+}
+
+func (r *Receipt) Status(ctx context.Context) hexutil.Uint64 {
+	return hexutil.Uint64(r.receipt.Status)
+}
+
+func (r *Receipt) GasUsed(ctx context.Context) hexutil.Uint64 {
+	return hexutil.Uint64(r.receipt.GasUsed)
+}
+
+func (r *Receipt) CumulativeGasUsed(ctx context.Context) hexutil.Uint64 {
+	return hexutil.Uint64(r.receipt.CumulativeGasUsed)
+}
+
+func (r *Receipt) CreatedContract(ctx context.Context, args BlockNumberArgs) *Account {
+	if r.receipt.ContractAddress == (common.Address{}) {
+		return nil
+	}
+	return &Account{
+		backend:     r.transaction.backend,
+		address:     r.receipt.ContractAddress,
+		blockNumber: args.Number(),
+	}
+}
+
+func (r *Receipt) LogsBloom(ctx context.Context) hexutil.Bytes {
+	return hexutil.Bytes(r.receipt.Bloom.Bytes())
+}
+
+func (r *Receipt) Logs(ctx context.Context) []*Log {
+	ret := make([]*Log, 0, len(r.receipt.Logs))
+	for _, log := range r.receipt.Logs {
+		ret = append(ret, &Log{
+			backend:     r.transaction.backend,
+			transaction: r.transaction,
+			log:         log,
+		})
+	}
+	return ret
+}
+
 type BlockType int
 
 const (
@@ -681,6 +734,35 @@ func (b *Block) Transactions(ctx context.Context) (*[]*Transaction, error) {
 	return &ret, nil
 }
 
+func (b *Block) Receipts(ctx context.Context) (*[]*Receipt, error) {
+	block, err := b.resolve(ctx)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	receipts, err := b.resolveReceipts(ctx)
+	if err != nil || receipts == nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	if len(txs) != len(receipts) {
+		return nil, fmt.Errorf("receipts length mismatch: %d vs %d", len(txs), len(receipts))
+	}
+	ret := make([]*Receipt, 0, len(receipts))
+	for i, receipt := range receipts {
+		ret = append(ret, &Receipt{
+			transaction: &Transaction{
+				backend: b.backend,
+				hash:    txs[i].Hash(),
+				tx:      txs[i],
+				block:   b,
+				index:   uint64(i),
+			},
+			receipt: receipt,
+		})
+	}
+	return &ret, nil
+}
+
 func (b *Block) TransactionAt(ctx context.Context, args struct{ Index int32 }) (*Transaction, error) {
 	block, err := b.resolve(ctx)
 	if err != nil || block == nil {
@@ -841,8 +923,58 @@ func (c *CallResult) Status() hexutil.Uint64 {
 	return c.status
 }
 
+// AccountOverride is the GraphQL input for overriding an account's fields during
+// a local call operation.
+type AccountOverride struct {
+	Address   common.Address
+	Nonce     *hexutil.Uint64
+	Code      *hexutil.Bytes
+	Balance   *hexutil.Big
+	State     *[]StorageSlot
+	StateDiff *[]StorageSlot
+}
+
+// StorageSlot is the GraphQL input for a single storage key-value pair.
+type StorageSlot struct {
+	Key   common.Hash
+	Value common.Hash
+}
+
+// toStateOverride converts the GraphQL account overrides into the format
+// accepted by the ethapi call helpers.
+func toStateOverride(overrides *[]AccountOverride) *ethapi.StateOverride {
+	if overrides == nil {
+		return nil
+	}
+	slots := func(list *[]StorageSlot) *map[common.Hash]common.Hash {
+		if list == nil {
+			return nil
+		}
+		storage := make(map[common.Hash]common.Hash, len(*list))
+		for _, slot := range *list {
+			storage[slot.Key] = slot.Value
+		}
+		return &storage
+	}
+	diff := make(ethapi.StateOverride, len(*overrides))
+	for _, override := range *overrides {
+		account := ethapi.OverrideAccount{
+			Nonce:     override.Nonce,
+			Code:      override.Code,
+			State:     slots(override.State),
+			StateDiff: slots(override.StateDiff),
+		}
+		if override.Balance != nil {
+			account.Balance = &override.Balance
+		}
+		diff[override.Address] = account
+	}
+	return &diff
+}
+
 func (b *Block) Call(ctx context.Context, args struct {
-	Data ethapi.CallArgs
+	Data      ethapi.CallArgs
+	Overrides *[]AccountOverride
 }) (*CallResult, error) {
 	err := b.onMainChain(ctx)
 	if err != nil {
@@ -856,20 +988,24 @@ func (b *Block) Call(ctx context.Context, args struct {
 		}
 	}
 
-	result, gas, failed, err := ethapi.DoCall(ctx, b.backend, args.Data, *b.num, vm.Config{}, 5*time.Second, b.backend.RPCGasCap())
+	result, err := ethapi.DoCall(ctx, b.backend, args.Data, rpc.BlockNumberOrHashWithNumber(*b.num), toStateOverride(args.Overrides), vm.Config{}, 5*time.Second, b.backend.RPCGasCap())
+	if err != nil {
+		return nil, err
+	}
 	status := hexutil.Uint64(1)
-	if failed {
+	if result.Failed() {
 		status = 0
 	}
 	return &CallResult{
-		data:    hexutil.Bytes(result),
-		gasUsed: hexutil.Uint64(gas),
+		data:    hexutil.Bytes(result.ReturnData),
+		gasUsed: hexutil.Uint64(result.UsedGas),
 		status:  status,
-	}, err
+	}, nil
 }
 
 func (b *Block) EstimateGas(ctx context.Context, args struct {
-	Data ethapi.CallArgs
+	Data      ethapi.CallArgs
+	Overrides *[]AccountOverride
 }) (hexutil.Uint64, error) {
 	err := b.onMainChain(ctx)
 	if err != nil {
@@ -883,7 +1019,7 @@ func (b *Block) EstimateGas(ctx context.Context, args struct {
 		}
 	}
 
-	gas, err := ethapi.DoEstimateGas(ctx, b.backend, args.Data, *b.num, b.backend.RPCGasCap())
+	gas, err := ethapi.DoEstimateGas(ctx, b.backend, args.Data, *b.num, toStateOverride(args.Overrides), b.backend.RPCGasCap())
 	return gas, err
 }
 
@@ -925,24 +1061,29 @@ func (p *Pending) Account(ctx context.Context, args struct {
 }
 
 func (p *Pending) Call(ctx context.Context, args struct {
-	Data ethapi.CallArgs
+	Data      ethapi.CallArgs
+	Overrides *[]AccountOverride
 }) (*CallResult, error) {
-	result, gas, failed, err := ethapi.DoCall(ctx, p.backend, args.Data, rpc.PendingBlockNumber, vm.Config{}, 5*time.Second, p.backend.RPCGasCap())
+	result, err := ethapi.DoCall(ctx, p.backend, args.Data, rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber), toStateOverride(args.Overrides), vm.Config{}, 5*time.Second, p.backend.RPCGasCap())
+	if err != nil {
+		return nil, err
+	}
 	status := hexutil.Uint64(1)
-	if failed {
+	if result.Failed() {
 		status = 0
 	}
 	return &CallResult{
-		data:    hexutil.Bytes(result),
-		gasUsed: hexutil.Uint64(gas),
+		data:    hexutil.Bytes(result.ReturnData),
+		gasUsed: hexutil.Uint64(result.UsedGas),
 		status:  status,
-	}, err
+	}, nil
 }
 
 func (p *Pending) EstimateGas(ctx context.Context, args struct {
-	Data ethapi.CallArgs
+	Data      ethapi.CallArgs
+	Overrides *[]AccountOverride
 }) (hexutil.Uint64, error) {
-	return ethapi.DoEstimateGas(ctx, p.backend, args.Data, rpc.PendingBlockNumber, p.backend.RPCGasCap())
+	return ethapi.DoEstimateGas(ctx, p.backend, args.Data, rpc.PendingBlockNumber, toStateOverride(args.Overrides), p.backend.RPCGasCap())
 }
 
 // Resolver is the top-level object in the GraphQL hierarchy.
@@ -1173,6 +1314,7 @@ type Service struct {
 	backend  *eth.EthAPIBackend // The backend that queries will operate onn.
 	handler  http.Handler       // The `http.Handler` used to answer queries.
 	listener net.Listener       // The listening socket.
+	stack    *node.Node         // Node multiplexing the service onto its HTTP endpoint (nil = own listener)
 }
 
 // Protocols returns the list of protocols exported by this service.
@@ -1189,7 +1331,12 @@ func (s *Service) Start(server *p2p.Server) error {
 	if err != nil {
 		return err
 	}
-
+	if s.stack != nil {
+		s.stack.RegisterHTTPHandler("/graphql", s.handler)
+		s.stack.RegisterHTTPHandler("/graphql/", s.handler)
+		log.Info("GraphQL endpoint multiplexed onto HTTP RPC", "path", "/graphql")
+		return nil
+	}
 	if s.listener, err = net.Listen("tcp", s.endpoint); err != nil {
 		return err
 	}
@@ -1223,11 +1370,23 @@ func NewService(backend *eth.EthAPIBackend, endpoint string, cors, vhosts []stri
 
 // RegisterGraphQLService is a utility function to construct a new service and register it against a node.
 func RegisterGraphQLService(stack *node.Node, endpoint string, cors, vhosts []string, timeouts rpc.HTTPTimeouts) error {
+	// Multiplexing onto the HTTP RPC endpoint is impossible if that isn't served
+	if stack.Config().HTTPMultiplex && stack.Config().HTTPEndpoint() == "" {
+		return errMultiplexNoHTTP
+	}
 	return stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
 		var ethereum *eth.Ethereum
 		if err := ctx.Service(&ethereum); err != nil {
 			return nil, err
 		}
-		return NewService(ethereum.APIBackend, endpoint, cors, vhosts, timeouts)
+		service, err := NewService(ethereum.APIBackend, endpoint, cors, vhosts, timeouts)
+		if err != nil {
+			return nil, err
+		}
+		// If the node serves everything on its HTTP endpoint, don't open a new port
+		if stack.Config().HTTPMultiplex {
+			service.stack = stack
+		}
+		return service, nil
 	})
 }
@@ -18,6 +18,9 @@ package graphql
 
 import (
 	"testing"
+
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 func TestBuildSchema(t *testing.T) {
@@ -27,3 +30,14 @@ func TestBuildSchema(t *testing.T) {
 		t.Errorf("Could not construct GraphQL handler: %v", err)
 	}
 }
+
+// Tests that GraphQL can't be multiplexed onto a disabled HTTP RPC endpoint.
+func TestMultiplexWithoutHTTP(t *testing.T) {
+	stack, err := node.New(&node.Config{HTTPMultiplex: true})
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	if err := RegisterGraphQLService(stack, "127.0.0.1:0", nil, nil, rpc.DefaultHTTPTimeouts); err != errMultiplexNoHTTP {
+		t.Fatalf("registration error mismatch: have %v, want %v", err, errMultiplexNoHTTP)
+	}
+}
@@ -117,6 +117,29 @@ const schema string = `
         logs: [Log!]
     }
 
+    # Receipt is the result of executing a transaction included in a block.
+    type Receipt {
+        # Transaction is the transaction this receipt belongs to.
+        transaction: Transaction!
+        # Status is the return status of the transaction. This will be 1 if the
+        # transaction succeeded, or 0 if it failed.
+        status: Long!
+        # GasUsed is the amount of gas that was used processing the transaction.
+        gasUsed: Long!
+        # CumulativeGasUsed is the total gas used in the block up to and including
+        # the transaction.
+        cumulativeGasUsed: Long!
+        # CreatedContract is the account that was created by a contract creation
+        # transaction. If the transaction was not a contract creation transaction,
+        # this field will be null.
+        createdContract(block: Long): Account
+        # LogsBloom is a bloom filter that can be used to check if the transaction
+        # may contain log entries matching a filter.
+        logsBloom: Bytes!
+        # Logs is a list of log entries emitted by the transaction.
+        logs: [Log!]!
+    }
+
     # BlockFilterCriteria encapsulates log filter criteria for a filter applied
     # to a single block.
     input BlockFilterCriteria {
@@ -197,15 +220,20 @@ const schema string = `
         # transactions are unavailable for this block, or if the index is out of
         # bounds, this field will be null.
         transactionAt(index: Int!): Transaction
+        # Receipts is a list of the receipts of all the transactions in this
+        # block, retrieved at once. If receipts are unavailable for this block,
+        # this field will be null.
+        receipts: [Receipt!]
         # Logs returns a filtered set of logs from this block.
         logs(filter: BlockFilterCriteria!): [Log!]!
         # Account fetches an Ethereum account at the current block's state.
         account(address: Address!): Account!
-        # Call executes a local call operation at the current block's state.
-        call(data: CallData!): CallResult
+        # Call executes a local call operation at the current block's state,
+        # optionally with the given accounts overridden.
+        call(data: CallData!, overrides: [AccountOverride!]): CallResult
         # EstimateGas estimates the amount of gas that will be required for
         # successful execution of a transaction at the current block's state.
-        estimateGas(data: CallData!): Long!
+        estimateGas(data: CallData!, overrides: [AccountOverride!]): Long!
     }
 
     # CallData represents the data associated with a local contract call.
@@ -225,6 +253,31 @@ const schema string = `
         data: Bytes
     }
 
+    # AccountOverride replaces fields of an account for the duration of a local
+    # call operation. State and stateDiff are mutually exclusive.
+    input AccountOverride {
+        # Address is the account to override.
+        address: Address!
+        # Nonce replaces the nonce of the account.
+        nonce: Long
+        # Code replaces the contract code of the account.
+        code: Bytes
+        # Balance replaces the balance, in wei, of the account.
+        balance: BigInt
+        # State replaces the entire storage of the account.
+        state: [StorageSlot!]
+        # StateDiff replaces individual storage slots of the account.
+        stateDiff: [StorageSlot!]
+    }
+
+    # StorageSlot is a single key-value pair in a contract's storage.
+    input StorageSlot {
+        # Key is the storage slot.
+        key: Bytes32!
+        # Value is the value stored in the slot.
+        value: Bytes32!
+    }
+
     # CallResult is the result of a local call operation.
     type CallResult {
         # Data is the return data of the called contract.
@@ -284,11 +337,12 @@ const schema string = `
       transactions: [Transaction!]
       # Account fetches an Ethereum account for the pending state.
       account(address: Address!): Account!
-      # Call executes a local call operation for the pending state.
-      call(data: CallData!): CallResult
+      # Call executes a local call operation for the pending state, optionally
+      # with the given accounts overridden.
+      call(data: CallData!, overrides: [AccountOverride!]): CallResult
       # EstimateGas estimates the amount of gas that will be required for
       # successful execution of a transaction for the pending state.
-      estimateGas(data: CallData!): Long!
+      estimateGas(data: CallData!, overrides: [AccountOverride!]): Long!
     }
 
     type Query {
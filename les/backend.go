@@ -227,7 +227,7 @@ func (s *LightEthereum) APIs() []rpc.API {
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(s.ApiBackend, true),
+			Service:   filters.NewPublicFilterAPI(s.ApiBackend, true, filters.Config{MaxBlockRange: s.config.RPCLogsRange, MaxResults: s.config.RPCLogsCap}),
 			Public:    true,
 		}, {
 			Namespace: "net",
@@ -18,6 +18,8 @@ package node
 
 import (
 	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -25,6 +27,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/external"
@@ -32,6 +35,7 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/scwallet"
 	"github.com/ethereum/go-ethereum/accounts/usbwallet"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -70,6 +74,11 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// DBEngine is the key-value store engine ("leveldb" or "badger") used by the
+	// databases of the node. If empty, the engine of an existing database is used,
+	// defaulting to leveldb for new ones.
+	DBEngine string `toml:",omitempty"`
+
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
@@ -162,6 +171,18 @@ type Config struct {
 	// private APIs to untrusted users is a major security risk.
 	WSExposeAll bool `toml:",omitempty"`
 
+	// WSConfig contains the transport settings of the websocket connections, such
+	// as the maximum message size, compression and the keepalive ping interval.
+	WSConfig rpc.WebsocketConfig
+
+	// HTTPMultiplex serves the websocket RPC and GraphQL endpoints on the HTTP RPC
+	// endpoint instead of their own ports. Websocket upgrade requests are handed
+	// to the websocket server (if enabled via WSHost) and requests to /graphql to
+	// the GraphQL server (if enabled), all other requests are served as HTTP RPC.
+	// The WSHost, WSPort, GraphQLHost and GraphQLPort endpoints are not opened.
+	// Multiplexing requires the HTTP RPC endpoint to be enabled via HTTPHost.
+	HTTPMultiplex bool `toml:",omitempty"`
+
 	// GraphQLHost is the host interface on which to start the GraphQL server. If this
 	// field is empty, no GraphQL API endpoint will be started.
 	GraphQLHost string `toml:",omitempty"`
@@ -185,6 +206,47 @@ type Config struct {
 	// Requests using ip address directly are not affected
 	GraphQLVirtualHosts []string `toml:",omitempty"`
 
+	// AuthSecretFile is the path of the file containing the hex encoded secret used
+	// to authenticate HTTP and WebSocket RPC requests. If the file doesn't exist, a
+	// random secret is generated into it. If this field is empty, authentication
+	// is disabled and anyone reaching the endpoints may call all exposed modules.
+	AuthSecretFile string `toml:",omitempty"`
+
+	// AuthStaticToken makes the RPC endpoints accept the content of the secret file
+	// as a static bearer token, instead of requiring HS256 JWT tokens signed with
+	// the secret.
+	AuthStaticToken bool `toml:",omitempty"`
+
+	// RPCAccessPolicy is the path of a JSON file containing the access rules which
+	// restrict the methods callable over the IPC, HTTP and WebSocket endpoints,
+	// per transport and authenticated identity. The policy can be reloaded at
+	// runtime through the admin API. If this field is empty, all exposed methods
+	// are callable.
+	RPCAccessPolicy string `toml:",omitempty"`
+
+	// RPCLimits are the request budgets enforced on the IPC, HTTP and WebSocket
+	// endpoints: batch size, concurrent requests per connection and a per remote
+	// host rate limit weighted by method cost. Every HTTP request is served on a
+	// connection of its own, so the concurrency limit only restricts IPC and
+	// WebSocket clients, and setting it without either endpoint is an error.
+	// Requests over budget are rejected with error code -32005. The zero value
+	// disables all limits.
+	RPCLimits rpc.RateLimitConfig
+
+	// RPCAccessLog is the path of a file to append a JSON record of every call
+	// served over the IPC, HTTP and WebSocket endpoints to. If this field is empty,
+	// no access log is written.
+	RPCAccessLog string `toml:",omitempty"`
+
+	// RPCAccessLogRedact is a list of method names or module wildcards whose call
+	// parameters are not recorded in the access log. The parameters of personal_*
+	// calls, which carry passphrases and private keys, are never recorded.
+	RPCAccessLogRedact []string `toml:",omitempty"`
+
+	// RPCSlowThreshold is the duration above which served calls are reported as a
+	// warning along with a hash of their parameters. Zero disables the reports.
+	RPCSlowThreshold time.Duration `toml:",omitempty"`
+
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 
@@ -391,6 +453,51 @@ func (c *Config) NodeKey() *ecdsa.PrivateKey {
 	return key
 }
 
+// RPCAuthenticator returns the authenticator to guard the HTTP and WebSocket RPC
+// endpoints with, or nil if authentication is disabled. If the configured secret
+// file does not exist yet, a new random secret is generated and persisted.
+func (c *Config) RPCAuthenticator() (rpc.Authenticator, error) {
+	if c.AuthSecretFile == "" {
+		return nil, nil
+	}
+	path := c.AuthSecretFile
+
+	blob, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(path, []byte(hexutil.Encode(secret)), 0600); err != nil {
+			return nil, err
+		}
+		log.Info("Generated RPC authentication secret", "path", path)
+		blob = []byte(hexutil.Encode(secret))
+
+	case err != nil:
+		return nil, err
+	}
+	token := strings.TrimSpace(string(blob))
+	if c.AuthStaticToken {
+		if token == "" {
+			return nil, fmt.Errorf("empty RPC authentication token in %s", path)
+		}
+		return rpc.NewTokenAuth(token), nil
+	}
+	secret, err := hex.DecodeString(strings.TrimPrefix(token, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RPC authentication secret in %s: %v", path, err)
+	}
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("RPC authentication secret in %s too short: have %d bytes, want at least 32", path, len(secret))
+	}
+	return rpc.NewJWTAuth(secret), nil
+}
+
 // StaticNodes returns a list of node enode URLs configured as static nodes.
 func (c *Config) StaticNodes() []*enode.Node {
 	return c.parsePersistentNodes(&c.staticNodesWarning, c.ResolvePath(datadirStaticNodes))
@@ -160,3 +160,41 @@ func TestNodeKeyPersistency(t *testing.T) {
 		t.Fatalf("ephemeral node key persisted to disk")
 	}
 }
+
+// Tests that the RPC authentication secret is generated if missing, reused if
+// present, and rejected if malformed.
+func TestRPCAuthSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary data directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Authentication is disabled by default
+	if auth, err := (&Config{}).RPCAuthenticator(); auth != nil || err != nil {
+		t.Fatalf("authentication enabled without secret: %v, %v", auth, err)
+	}
+	// Missing secret files should be generated
+	path := filepath.Join(dir, "jwtsecret")
+	if _, err := (&Config{AuthSecretFile: path}).RPCAuthenticator(); err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("generated secret not persisted: %v", err)
+	}
+	if _, err := (&Config{AuthSecretFile: path}).RPCAuthenticator(); err != nil {
+		t.Fatalf("failed to load secret: %v", err)
+	}
+	if reloaded, _ := ioutil.ReadFile(path); !bytes.Equal(blob, reloaded) {
+		t.Fatalf("existing secret overwritten")
+	}
+	// Short or invalid secrets are only accepted as static tokens
+	ioutil.WriteFile(path, []byte("not-a-hex-secret\n"), 0600)
+	if _, err := (&Config{AuthSecretFile: path}).RPCAuthenticator(); err == nil {
+		t.Fatalf("invalid JWT secret accepted")
+	}
+	if _, err := (&Config{AuthSecretFile: path, AuthStaticToken: true}).RPCAuthenticator(); err != nil {
+		t.Fatalf("failed to load static token: %v", err)
+	}
+}
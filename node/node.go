@@ -20,9 +20,11 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 
@@ -52,8 +54,13 @@ type Node struct {
 	serviceFuncs []ServiceConstructor     // Service constructors (in dependency order)
 	services     map[reflect.Type]Service // Currently running services
 
-	rpcAPIs       []rpc.API   // List of APIs currently provided by the node
-	inprocHandler *rpc.Server // In-process RPC request handler to process the API requests
+	rpcAPIs       []rpc.API         // List of APIs currently provided by the node
+	rpcAuth       rpc.Authenticator // Authenticator guarding the HTTP and WS endpoints (nil = disabled)
+	rpcAccess     *rpc.AccessPolicy // Access policy restricting the IPC, HTTP and WS calls (nil = disabled)
+	rpcLimiter    *rpc.RateLimiter  // Request budgets shared by the IPC, HTTP and WS endpoints
+	rpcLog        *rpc.AccessLog    // Log recording the IPC, HTTP and WS calls (nil = disabled)
+	rpcLogFile    *os.File          // File the access log is written to (nil = none)
+	inprocHandler *rpc.Server       // In-process RPC request handler to process the API requests
 
 	ipcEndpoint string       // IPC endpoint to listen at (empty = IPC disabled)
 	ipcListener net.Listener // IPC RPC listener socket to serve API requests
@@ -68,6 +75,9 @@ type Node struct {
 	wsListener net.Listener // Websocket RPC listener socket to server API requests
 	wsHandler  *rpc.Server  // Websocket RPC request handler to process the API requests
 
+	multiplexed  bool                    // Whether websocket and custom handlers are served on the HTTP endpoint
+	httpHandlers map[string]http.Handler // Custom handlers to serve on the multiplexed HTTP endpoint
+
 	stop chan struct{} // Channel to wait for termination notifications
 	lock sync.RWMutex
 
@@ -284,6 +294,25 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 	for _, service := range services {
 		apis = append(apis, service.APIs()...)
 	}
+	// Load the credentials guarding the network facing endpoints
+	auth, err := n.config.RPCAuthenticator()
+	if err != nil {
+		return err
+	}
+	n.rpcAccess = nil
+	if n.config.RPCAccessPolicy != "" {
+		if n.rpcAccess, err = rpc.LoadAccessPolicy(n.config.RPCAccessPolicy); err != nil {
+			return err
+		}
+	}
+	if n.rpcLimiter, err = rpc.NewRateLimiter(n.config.RPCLimits); err != nil {
+		return err
+	}
+	// The concurrency limit is enforced per connection, which is meaningless if
+	// only HTTP is served, every HTTP request arriving on a connection of its own
+	if n.config.RPCLimits.ConnLimit > 0 && n.httpEndpoint != "" && n.ipcEndpoint == "" && n.wsEndpoint == "" {
+		return errors.New("RPC connection limit requires an IPC or WebSocket endpoint")
+	}
 	// Start the various API endpoints, terminating all in case of errors
 	if err := n.startInProc(apis); err != nil {
 		return err
@@ -292,12 +321,27 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 		n.stopInProc()
 		return err
 	}
-	if err := n.startHTTP(n.httpEndpoint, apis, n.config.HTTPModules, n.config.HTTPCors, n.config.HTTPVirtualHosts, n.config.HTTPTimeouts); err != nil {
-		n.stopIPC()
-		n.stopInProc()
-		return err
+	if n.config.HTTPMultiplex && n.httpEndpoint != "" {
+		if err := n.startMultiplex(n.httpEndpoint, apis, auth); err != nil {
+			n.stopIPC()
+			n.stopInProc()
+			return err
+		}
+	} else {
+		if err := n.startHTTP(n.httpEndpoint, apis, n.config.HTTPModules, n.config.HTTPCors, n.config.HTTPVirtualHosts, n.config.HTTPTimeouts, auth); err != nil {
+			n.stopIPC()
+			n.stopInProc()
+			return err
+		}
+		if err := n.startWS(n.wsEndpoint, apis, n.config.WSModules, n.config.WSOrigins, n.config.WSExposeAll, auth); err != nil {
+			n.stopHTTP()
+			n.stopIPC()
+			n.stopInProc()
+			return err
+		}
 	}
-	if err := n.startWS(n.wsEndpoint, apis, n.config.WSModules, n.config.WSOrigins, n.config.WSExposeAll); err != nil {
+	if err := n.startAccessLog(); err != nil {
+		n.stopWS()
 		n.stopHTTP()
 		n.stopIPC()
 		n.stopInProc()
@@ -305,9 +349,51 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 	}
 	// All API endpoints started successfully
 	n.rpcAPIs = apis
+	n.rpcAuth = auth
+	return nil
+}
+
+// setupHandler applies the request budgets and the access log to the handler of
+// a network facing endpoint.
+func (n *Node) setupHandler(handler *rpc.Server) {
+	handler.SetRateLimiter(n.rpcLimiter)
+	handler.SetAccessLog(n.rpcLog)
+}
+
+// startAccessLog opens the RPC access log if one is configured, or enables the
+// reporting of slow calls, and attaches it to the running endpoints.
+func (n *Node) startAccessLog() error {
+	if n.config.RPCAccessLog == "" && n.config.RPCSlowThreshold == 0 {
+		return nil
+	}
+	var handler log.Handler
+	if n.config.RPCAccessLog != "" {
+		file, err := os.OpenFile(n.config.RPCAccessLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		n.rpcLogFile = file
+		handler = log.StreamHandler(file, log.JSONFormat())
+	}
+	n.rpcLog = rpc.NewAccessLog(handler, n.config.RPCSlowThreshold, n.config.RPCAccessLogRedact)
+	for _, server := range []*rpc.Server{n.ipcHandler, n.httpHandler, n.wsHandler} {
+		if server != nil {
+			server.SetAccessLog(n.rpcLog)
+		}
+	}
+	n.log.Info("RPC access log enabled", "path", n.config.RPCAccessLog, "slow", n.config.RPCSlowThreshold)
 	return nil
 }
 
+// stopAccessLog closes the RPC access log, if one was opened.
+func (n *Node) stopAccessLog() {
+	if n.rpcLogFile != nil {
+		n.rpcLogFile.Close()
+		n.rpcLogFile = nil
+	}
+	n.rpcLog = nil
+}
+
 // startInProc initializes an in-process RPC endpoint.
 func (n *Node) startInProc(apis []rpc.API) error {
 	// Register all the APIs exposed by the services
@@ -335,10 +421,11 @@ func (n *Node) startIPC(apis []rpc.API) error {
 	if n.ipcEndpoint == "" {
 		return nil // IPC disabled.
 	}
-	listener, handler, err := rpc.StartIPCEndpoint(n.ipcEndpoint, apis)
+	listener, handler, err := rpc.StartIPCEndpoint(n.ipcEndpoint, apis, n.rpcAccess)
 	if err != nil {
 		return err
 	}
+	n.setupHandler(handler)
 	n.ipcListener = listener
 	n.ipcHandler = handler
 	n.log.Info("IPC endpoint opened", "url", n.ipcEndpoint)
@@ -360,16 +447,17 @@ func (n *Node) stopIPC() {
 }
 
 // startHTTP initializes and starts the HTTP RPC endpoint.
-func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors []string, vhosts []string, timeouts rpc.HTTPTimeouts) error {
+func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors []string, vhosts []string, timeouts rpc.HTTPTimeouts, auth rpc.Authenticator) error {
 	// Short circuit if the HTTP endpoint isn't being exposed
 	if endpoint == "" {
 		return nil
 	}
-	listener, handler, err := rpc.StartHTTPEndpoint(endpoint, apis, modules, cors, vhosts, timeouts)
+	listener, handler, err := rpc.StartHTTPEndpoint(endpoint, apis, modules, cors, vhosts, timeouts, auth, n.rpcAccess)
 	if err != nil {
 		return err
 	}
-	n.log.Info("HTTP endpoint opened", "url", fmt.Sprintf("http://%s", endpoint), "cors", strings.Join(cors, ","), "vhosts", strings.Join(vhosts, ","))
+	n.setupHandler(handler)
+	n.log.Info("HTTP endpoint opened", "url", fmt.Sprintf("http://%s", endpoint), "cors", strings.Join(cors, ","), "vhosts", strings.Join(vhosts, ","), "auth", auth != nil)
 	// All listeners booted successfully
 	n.httpEndpoint = endpoint
 	n.httpListener = listener
@@ -378,7 +466,49 @@ func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors
 	return nil
 }
 
-// stopHTTP terminates the HTTP RPC endpoint.
+// startMultiplex initializes and starts the HTTP RPC endpoint, serving the
+// websocket RPC endpoint and any registered custom handlers on the same port.
+func (n *Node) startMultiplex(endpoint string, apis []rpc.API, auth rpc.Authenticator) error {
+	config := &rpc.MultiplexConfig{
+		HTTPModules:      n.config.HTTPModules,
+		HTTPCors:         n.config.HTTPCors,
+		HTTPVirtualHosts: n.config.HTTPVirtualHosts,
+		HTTPTimeouts:     n.config.HTTPTimeouts,
+		WSEnabled:        n.config.WSHost != "",
+		WSModules:        n.config.WSModules,
+		WSOrigins:        n.config.WSOrigins,
+		WSExposeAll:      n.config.WSExposeAll,
+		Handlers:         n.httpHandlers,
+		Auth:             auth,
+		Policy:           n.rpcAccess,
+	}
+	listener, httpHandler, wsHandler, err := rpc.StartMultiplexEndpoint(endpoint, apis, config)
+	if err != nil {
+		return err
+	}
+	n.setupHandler(httpHandler)
+	if wsHandler != nil {
+		n.setupHandler(wsHandler)
+		wsHandler.SetWebsocketConfig(n.config.WSConfig)
+	}
+	paths := make([]string, 0, len(n.httpHandlers))
+	for path := range n.httpHandlers {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	n.log.Info("HTTP endpoint opened", "url", fmt.Sprintf("http://%s", endpoint), "cors", strings.Join(config.HTTPCors, ","), "vhosts", strings.Join(config.HTTPVirtualHosts, ","), "auth", auth != nil, "ws", wsHandler != nil, "paths", strings.Join(paths, ","))
+	// All listeners booted successfully
+	n.httpEndpoint = endpoint
+	n.httpListener = listener
+	n.httpHandler = httpHandler
+	n.wsHandler = wsHandler
+	n.multiplexed = true
+
+	return nil
+}
+
+// stopHTTP terminates the HTTP RPC endpoint, along with the websocket endpoint
+// if it's multiplexed onto the same port.
 func (n *Node) stopHTTP() {
 	if n.httpListener != nil {
 		n.httpListener.Close()
@@ -390,19 +520,39 @@ func (n *Node) stopHTTP() {
 		n.httpHandler.Stop()
 		n.httpHandler = nil
 	}
+	if n.multiplexed {
+		if n.wsHandler != nil {
+			n.wsHandler.Stop()
+			n.wsHandler = nil
+		}
+		n.multiplexed = false
+	}
+}
+
+// RegisterHTTPHandler registers a custom handler to be served under the given
+// path of the HTTP RPC endpoint, if the node is configured to multiplex its
+// endpoints onto a single port (see Config.HTTPMultiplex). Handlers must be
+// registered from the Start method of a service.
+func (n *Node) RegisterHTTPHandler(path string, handler http.Handler) {
+	if n.httpHandlers == nil {
+		n.httpHandlers = make(map[string]http.Handler)
+	}
+	n.httpHandlers[path] = handler
 }
 
 // startWS initializes and starts the websocket RPC endpoint.
-func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrigins []string, exposeAll bool) error {
+func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrigins []string, exposeAll bool, auth rpc.Authenticator) error {
 	// Short circuit if the WS endpoint isn't being exposed
 	if endpoint == "" {
 		return nil
 	}
-	listener, handler, err := rpc.StartWSEndpoint(endpoint, apis, modules, wsOrigins, exposeAll)
+	listener, handler, err := rpc.StartWSEndpoint(endpoint, apis, modules, wsOrigins, exposeAll, auth, n.rpcAccess)
 	if err != nil {
 		return err
 	}
-	n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws://%s", listener.Addr()))
+	n.setupHandler(handler)
+	handler.SetWebsocketConfig(n.config.WSConfig)
+	n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws://%s", listener.Addr()), "auth", auth != nil)
 	// All listeners booted successfully
 	n.wsEndpoint = endpoint
 	n.wsListener = listener
@@ -425,6 +575,26 @@ func (n *Node) stopWS() {
 	}
 }
 
+// reloadAccessPolicy reloads the RPC access policy from the configured file and
+// applies it to all running network facing endpoints.
+func (n *Node) reloadAccessPolicy() error {
+	if n.config.RPCAccessPolicy == "" {
+		return errors.New("no RPC access policy configured")
+	}
+	policy, err := rpc.LoadAccessPolicy(n.config.RPCAccessPolicy)
+	if err != nil {
+		return err
+	}
+	n.rpcAccess = policy
+	for _, handler := range []*rpc.Server{n.ipcHandler, n.httpHandler, n.wsHandler} {
+		if handler != nil {
+			handler.SetAccessPolicy(policy)
+		}
+	}
+	n.log.Info("Reloaded RPC access policy", "path", n.config.RPCAccessPolicy, "rules", len(policy.Rules))
+	return nil
+}
+
 // Stop terminates a running node along with all it's services. In the node was
 // not started, an error is returned.
 func (n *Node) Stop() error {
@@ -440,6 +610,7 @@ func (n *Node) Stop() error {
 	n.stopWS()
 	n.stopHTTP()
 	n.stopIPC()
+	n.stopAccessLog()
 	n.rpcAPIs = nil
 	failure := &StopError{
 		Services: make(map[reflect.Type]error),
@@ -595,6 +766,9 @@ func (n *Node) WSEndpoint() string {
 	if n.wsListener != nil {
 		return n.wsListener.Addr().String()
 	}
+	if n.multiplexed && n.wsHandler != nil && n.httpListener != nil {
+		return n.httpListener.Addr().String()
+	}
 	return n.wsEndpoint
 }
 
@@ -611,15 +785,16 @@ func (n *Node) OpenDatabase(name string, cache, handles int, namespace string) (
 	if n.config.DataDir == "" {
 		return rawdb.NewMemoryDatabase(), nil
 	}
-	return rawdb.NewLevelDBDatabase(n.config.ResolvePath(name), cache, handles, namespace)
+	return rawdb.NewDiskDatabase(n.config.DBEngine, n.config.ResolvePath(name), cache, handles, namespace)
 }
 
 // OpenDatabaseWithFreezer opens an existing database with the given name (or
 // creates one if no previous can be found) from within the node's data directory,
 // also attaching a chain freezer to it that moves ancient chain data from the
-// database to immutable append-only files. If the node is an ephemeral one, a
-// memory database is returned.
-func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer, namespace string) (ethdb.Database, error) {
+// database to immutable append-only files. If compress is set, all newly created
+// freezer tables are compressed. If the node is an ephemeral one, a memory
+// database is returned.
+func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer, namespace string, compress bool) (ethdb.Database, error) {
 	if n.config.DataDir == "" {
 		return rawdb.NewMemoryDatabase(), nil
 	}
@@ -631,7 +806,7 @@ func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer,
 	case !filepath.IsAbs(freezer):
 		freezer = n.config.ResolvePath(freezer)
 	}
-	return rawdb.NewLevelDBDatabaseWithFreezer(root, cache, handles, freezer, namespace)
+	return rawdb.NewDiskDatabaseWithFreezer(n.config.DBEngine, root, cache, handles, freezer, namespace, compress)
 }
 
 // ResolvePath returns the absolute path of a resource in the instance directory.
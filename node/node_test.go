@@ -19,6 +19,7 @@ package node
 import (
 	"errors"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"reflect"
 	"testing"
@@ -597,3 +598,83 @@ func TestAPIGather(t *testing.T) {
 		}
 	}
 }
+
+// Tests that a multiplexing node serves HTTP-RPC, WS-RPC and the handlers
+// registered by its services on a single port.
+func TestHTTPMultiplex(t *testing.T) {
+	config := testNodeConfig()
+	config.HTTPHost, config.WSHost = "127.0.0.1", "127.0.0.1"
+	config.HTTPModules, config.WSModules = []string{"web3"}, []string{"web3"}
+	config.WSOrigins = []string{"*"}
+	config.HTTPMultiplex = true
+
+	stack, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	constructor := func(*ServiceContext) (Service, error) {
+		service := new(InstrumentedService)
+		service.startHook = func(*p2p.Server) {
+			stack.RegisterHTTPHandler("/custom", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("custom"))
+			}))
+		}
+		return service, nil
+	}
+	if err := stack.Register(constructor); err != nil {
+		t.Fatalf("failed to register service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start protocol stack: %v", err)
+	}
+	defer stack.Stop()
+
+	if stack.HTTPEndpoint() != stack.WSEndpoint() {
+		t.Fatalf("endpoint mismatch: http %s, ws %s", stack.HTTPEndpoint(), stack.WSEndpoint())
+	}
+	for _, url := range []string{"http://" + stack.HTTPEndpoint(), "ws://" + stack.WSEndpoint()} {
+		client, err := rpc.Dial(url)
+		if err != nil {
+			t.Fatalf("failed to dial %s: %v", url, err)
+		}
+		var version string
+		if err := client.Call(&version, "web3_clientVersion"); err != nil {
+			t.Errorf("%s: call failed: %v", url, err)
+		}
+		client.Close()
+	}
+	resp, err := http.Get("http://" + stack.HTTPEndpoint() + "/custom")
+	if err != nil {
+		t.Fatalf("custom request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if body, _ := ioutil.ReadAll(resp.Body); string(body) != "custom" {
+		t.Fatalf("custom response mismatch: have %q, want %q", body, "custom")
+	}
+}
+
+// Tests that a connection limit is rejected if only HTTP is served, where every
+// request arrives on a connection of its own.
+func TestRPCConnLimitHTTPOnly(t *testing.T) {
+	config := testNodeConfig()
+	config.HTTPHost = "127.0.0.1"
+	config.RPCLimits.ConnLimit = 1
+
+	stack, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	if err := stack.Start(); err == nil {
+		stack.Stop()
+		t.Fatalf("HTTP only node started with a connection limit")
+	}
+	config.WSHost = "127.0.0.1"
+	if stack, err = New(config); err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start protocol stack with a websocket endpoint: %v", err)
+	}
+	stack.Stop()
+}
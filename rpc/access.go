@@ -0,0 +1,157 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Transports over which the RPC server may be reached, used to scope access
+// control rules.
+const (
+	TransportHTTP   = "http"
+	TransportWS     = "ws"
+	TransportIPC    = "ipc"
+	TransportInProc = "inproc"
+)
+
+// transportContextKey is the context key under which the transport of the
+// connection is stored.
+type transportContextKey struct{}
+
+// TransportFromContext retrieves the transport a request arrived through from
+// the context, if known.
+func TransportFromContext(ctx context.Context) (string, bool) {
+	transport, ok := ctx.Value(transportContextKey{}).(string)
+	return transport, ok
+}
+
+// withTransport returns a copy of the context tagged with the given transport.
+func withTransport(ctx context.Context, transport string) context.Context {
+	return context.WithValue(ctx, transportContextKey{}, transport)
+}
+
+// accessDeniedError is returned if the access policy of the server forbids the
+// caller from invoking a method.
+type accessDeniedError struct{ method string }
+
+func (e *accessDeniedError) ErrorCode() int { return -32004 }
+
+func (e *accessDeniedError) Error() string {
+	return fmt.Sprintf("access to method %s denied", e.method)
+}
+
+// AccessRule permits or forbids a set of methods for the callers it applies to.
+// Methods are matched by their full name (e.g. "debug_traceTransaction"), by
+// module wildcard (e.g. "debug_*") or by "*" matching everything.
+type AccessRule struct {
+	Transports []string `json:"transports,omitempty"` // Transports the rule applies to (empty = all)
+	Identities []string `json:"identities,omitempty"` // Authenticated callers the rule applies to (empty = all)
+	Allow      []string `json:"allow,omitempty"`      // Method patterns permitted by the rule
+	Deny       []string `json:"deny,omitempty"`       // Method patterns forbidden by the rule, taking precedence over Allow
+}
+
+// AccessPolicy is an ordered list of access rules. For every call, the rules
+// applicable to the caller are evaluated in order and the first one matching
+// the method decides. If no rule matches, the call is allowed unless DefaultDeny
+// is set.
+type AccessPolicy struct {
+	DefaultDeny bool         `json:"defaultDeny,omitempty"`
+	Rules       []AccessRule `json:"rules"`
+}
+
+// LoadAccessPolicy reads a JSON encoded access policy from a file.
+func LoadAccessPolicy(path string) (*AccessPolicy, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := new(AccessPolicy)
+	if err := json.Unmarshal(blob, policy); err != nil {
+		return nil, fmt.Errorf("invalid access policy %s: %v", path, err)
+	}
+	for i, rule := range policy.Rules {
+		for _, pattern := range append(append([]string{}, rule.Allow...), rule.Deny...) {
+			if pattern != "*" && !strings.Contains(pattern, serviceMethodSeparator) {
+				return nil, fmt.Errorf("invalid method pattern %q in access rule %d", pattern, i)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// Allowed checks whether a caller with the given identity, connected through
+// the given transport, may call a method. An empty identity or transport only
+// matches rules not restricted by them.
+func (p *AccessPolicy) Allowed(transport, identity, method string) bool {
+	for _, rule := range p.Rules {
+		if !matchScope(rule.Transports, transport) || !matchScope(rule.Identities, identity) {
+			continue
+		}
+		for _, pattern := range rule.Deny {
+			if matchMethod(pattern, method) {
+				return false
+			}
+		}
+		for _, pattern := range rule.Allow {
+			if matchMethod(pattern, method) {
+				return true
+			}
+		}
+	}
+	return !p.DefaultDeny
+}
+
+// authorize checks the call of a method against the policy, using the caller
+// information stored in the context.
+func (p *AccessPolicy) authorize(ctx context.Context, method string) error {
+	transport, _ := TransportFromContext(ctx)
+	identity, _ := IdentityFromContext(ctx)
+	if !p.Allowed(transport, identity, method) {
+		return &accessDeniedError{method}
+	}
+	return nil
+}
+
+// matchScope checks whether a value is contained in a rule scope, an empty scope
+// containing everything.
+func matchScope(scope []string, value string) bool {
+	if len(scope) == 0 {
+		return true
+	}
+	for _, item := range scope {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMethod checks whether a method name matches a pattern.
+func matchMethod(pattern, method string) bool {
+	if pattern == "*" || pattern == method {
+		return true
+	}
+	if strings.HasSuffix(pattern, serviceMethodSeparator+"*") {
+		return strings.HasPrefix(method, pattern[:len(pattern)-1])
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that access rules are evaluated in order, scoped by transport and
+// identity, with denials taking precedence within a rule.
+func TestAccessPolicyRules(t *testing.T) {
+	policy := &AccessPolicy{
+		DefaultDeny: true,
+		Rules: []AccessRule{
+			{Identities: []string{"analyst"}, Allow: []string{"debug_traceTransaction", "eth_*"}},
+			{Transports: []string{TransportIPC}, Allow: []string{"*"}},
+			{Deny: []string{"debug_setHead"}, Allow: []string{"debug_*", "eth_*"}},
+		},
+	}
+	tests := []struct {
+		transport, identity, method string
+		allowed                     bool
+	}{
+		{TransportHTTP, "analyst", "debug_traceTransaction", true},
+		{TransportHTTP, "analyst", "debug_setHead", false},
+		{TransportHTTP, "analyst", "debug_traceBlock", true},
+		{TransportHTTP, "", "eth_blockNumber", true},
+		{TransportWS, "", "debug_setHead", false},
+		{TransportIPC, "", "debug_setHead", true},
+		{TransportHTTP, "", "admin_addPeer", false},
+		{"", "", "admin_addPeer", false},
+	}
+	for i, tt := range tests {
+		if allowed := policy.Allowed(tt.transport, tt.identity, tt.method); allowed != tt.allowed {
+			t.Errorf("test %d: %s/%s/%s: allowance mismatch: have %v, want %v", i, tt.transport, tt.identity, tt.method, allowed, tt.allowed)
+		}
+	}
+}
+
+// Tests that access policies are loaded from disk and invalid patterns rejected.
+func TestAccessPolicyLoading(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "policy.json")
+	ioutil.WriteFile(path, []byte(`{"defaultDeny": true, "rules": [{"transports": ["http"], "allow": ["eth_*"]}]}`), 0600)
+	policy, err := LoadAccessPolicy(path)
+	if err != nil {
+		t.Fatalf("failed to load policy: %v", err)
+	}
+	if !policy.DefaultDeny || len(policy.Rules) != 1 || policy.Rules[0].Allow[0] != "eth_*" {
+		t.Fatalf("loaded policy mismatch: %+v", policy)
+	}
+	ioutil.WriteFile(path, []byte(`{"rules": [{"allow": ["eth"]}]}`), 0600)
+	if _, err := LoadAccessPolicy(path); err == nil {
+		t.Fatalf("invalid method pattern accepted")
+	}
+}
+
+// Tests that the server enforces its access policy on method calls, using the
+// transport and authenticated identity of the caller, and that the policy can
+// be replaced on the fly.
+func TestServerAccessPolicy(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	server.SetAccessPolicy(&AccessPolicy{Rules: []AccessRule{
+		{Identities: []string{"analyst"}, Allow: []string{"test_echo"}},
+		{Transports: []string{TransportHTTP}, Deny: []string{"test_*"}},
+	}})
+	httpsrv := httptest.NewServer(newAuthHandler(NewTokenAuth("analyst-token"), server))
+	defer httpsrv.Close()
+
+	var (
+		analyst, _ = DialHTTPWithAuth(httpsrv.URL, new(http.Client), BearerAuth("analyst-token"))
+		inproc     = DialInProc(server)
+		result     Result
+	)
+	defer analyst.Close()
+	defer inproc.Close()
+
+	// The token authenticator identifies everyone as "token", so the HTTP deny hits
+	if err := analyst.Call(&result, "test_echo", "hello", 10, &Args{"world"}); err == nil {
+		t.Fatalf("denied call succeeded over HTTP")
+	} else if err.(Error).ErrorCode() != -32004 {
+		t.Fatalf("denied call error code mismatch: have %d, want %d", err.(Error).ErrorCode(), -32004)
+	}
+	if err := inproc.Call(&result, "test_echo", "hello", 10, &Args{"world"}); err != nil {
+		t.Fatalf("allowed call failed in process: %v", err)
+	}
+	// Swap the policy and ensure existing connections are affected too
+	server.SetAccessPolicy(&AccessPolicy{Rules: []AccessRule{
+		{Identities: []string{"token"}, Allow: []string{"test_echo"}},
+		{Deny: []string{"*"}},
+	}})
+	if err := analyst.Call(&result, "test_echo", "hello", 10, &Args{"world"}); err != nil {
+		t.Fatalf("allowed call failed over HTTP: %v", err)
+	}
+	if err := inproc.Call(&result, "test_echo", "hello", 10, &Args{"world"}); err == nil {
+		t.Fatalf("denied call succeeded in process")
+	}
+	// Subscriptions are subject to the policy too
+	if _, err := inproc.Subscribe(context.Background(), "nftest", make(chan int), "someSubscription", 1, 1); err == nil {
+		t.Fatalf("denied subscription succeeded")
+	}
+}
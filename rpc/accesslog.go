@@ -0,0 +1,121 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// accessLogParamsLimit is the number of bytes of call parameters recorded in
+// the access log. Longer parameters are truncated and recorded with their hash.
+const accessLogParamsLimit = 256
+
+// accessLogRedacted are the methods whose parameters are never recorded, as they
+// carry account passphrases and private keys.
+var accessLogRedacted = []string{"personal_*"}
+
+// AccessLog records the calls served by the RPC server as structured log records
+// and reports calls exceeding a duration threshold.
+type AccessLog struct {
+	logger   log.Logger    // Logger writing the access records (nil = no access log)
+	slow     time.Duration // Duration above which calls are reported as slow (0 = disabled)
+	redacted []string      // Method names or module wildcards whose parameters are not recorded
+}
+
+// NewAccessLog creates an access log writing a record of every served call into
+// the given handler, if one is set. Calls taking longer than the slow threshold
+// are recorded with their full parameters and reported as a warning on the root
+// logger with only a hash of their parameters.
+//
+// The parameters of personal_* calls and of the additional redacted methods or
+// module wildcards (e.g. "eth_sendRawTransaction", "admin_*") are never recorded.
+func NewAccessLog(handler log.Handler, slow time.Duration, redacted []string) *AccessLog {
+	l := &AccessLog{
+		slow:     slow,
+		redacted: append(append([]string{}, accessLogRedacted...), redacted...),
+	}
+	if handler != nil {
+		l.logger = log.New()
+		l.logger.SetHandler(handler)
+	}
+	return l
+}
+
+// redact checks whether the parameters of a method must not be recorded.
+func (l *AccessLog) redact(method string) bool {
+	for _, pattern := range l.redacted {
+		if matchMethod(pattern, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// record logs a served call along with the answer sent for it, if any.
+func (l *AccessLog) record(ctx context.Context, remote string, msg, answer *jsonrpcMessage, elapsed time.Duration) {
+	var (
+		slow   = l.slow > 0 && elapsed >= l.slow
+		redact = l.redact(msg.Method)
+	)
+	if slow {
+		fields := []interface{}{"method", msg.Method, "reqid", idForLog{msg.ID}, "conn", remote, "t", elapsed}
+		if !redact {
+			hash := sha256.Sum256(msg.Params)
+			fields = append(fields, "paramsHash", hex.EncodeToString(hash[:]))
+		}
+		log.Warn("Slow RPC call", fields...)
+	}
+	if l.logger == nil {
+		return
+	}
+	var size, code int
+	if answer != nil {
+		size = len(answer.Result)
+		if answer.Error != nil {
+			code = answer.Error.Code
+		}
+	}
+	transport, _ := TransportFromContext(ctx)
+	identity, _ := IdentityFromContext(ctx)
+
+	fields := []interface{}{
+		"method", msg.Method,
+		"id", string(msg.ID),
+		"remote", remote,
+		"transport", transport,
+		"identity", identity,
+		"ms", float64(elapsed) / float64(time.Millisecond),
+		"size", size,
+		"code", code,
+		"slow", slow,
+	}
+	switch params := msg.Params; {
+	case redact:
+		fields = append(fields, "redacted", true)
+	case slow || len(params) <= accessLogParamsLimit:
+		fields = append(fields, "params", string(params))
+	default:
+		hash := sha256.Sum256(params)
+		fields = append(fields, "params", string(params[:accessLogParamsLimit]), "truncated", true, "paramsHash", hex.EncodeToString(hash[:]))
+	}
+	l.logger.Info("RPC call", fields...)
+}
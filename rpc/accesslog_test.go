@@ -0,0 +1,95 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Tests that served calls are recorded in the access log as JSON lines, with
+// long parameters truncated unless the call was slow and sensitive parameters
+// never recorded.
+func TestAccessLog(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	if err := server.RegisterName("personal", new(testService)); err != nil {
+		t.Fatal(err)
+	}
+	buffer := new(bytes.Buffer)
+	server.SetAccessLog(NewAccessLog(log.StreamHandler(buffer, log.JSONFormat()), 100*time.Millisecond, []string{"test_echoWithCtx"}))
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	var result Result
+	if err := client.Call(&result, "test_echo", "hello", 10, &Args{"world"}); err != nil {
+		t.Fatalf("short call failed: %v", err)
+	}
+	if err := client.Call(&result, "test_echo", strings.Repeat("x", 2*accessLogParamsLimit), 10, &Args{"world"}); err != nil {
+		t.Fatalf("long call failed: %v", err)
+	}
+	if err := client.Call(nil, "test_sleep", 200*time.Millisecond); err != nil {
+		t.Fatalf("slow call failed: %v", err)
+	}
+	client.Call(nil, "test_returnError")
+
+	if err := client.Call(&result, "personal_echo", "passphrase", 10, &Args{"world"}); err != nil {
+		t.Fatalf("personal call failed: %v", err)
+	}
+	if err := client.Call(&result, "test_echoWithCtx", "secret", 10, &Args{"world"}); err != nil {
+		t.Fatalf("redacted call failed: %v", err)
+	}
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		record := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid access log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 6 {
+		t.Fatalf("record count mismatch: have %d, want %d", len(records), 6)
+	}
+	if records[0]["method"] != "test_echo" || records[0]["params"] != `["hello",10,{"S":"world"}]` || records[0]["transport"] != TransportInProc {
+		t.Errorf("short call record mismatch: %v", records[0])
+	}
+	if params := records[1]["params"].(string); len(params) != accessLogParamsLimit || records[1]["truncated"] != "true" || records[1]["paramsHash"] == nil {
+		t.Errorf("long call record not truncated: %v", records[1])
+	}
+	if records[2]["slow"] != "true" || records[2]["params"] != "[200000000]" || records[2]["ms"].(float64) < 200 {
+		t.Errorf("slow call record mismatch: %v", records[2])
+	}
+	if records[3]["code"] != float64(444) || records[3]["slow"] != "false" {
+		t.Errorf("failed call record mismatch: %v", records[3])
+	}
+	for _, record := range records[4:] {
+		if _, ok := record["params"]; ok || record["redacted"] != "true" {
+			t.Errorf("sensitive call record not redacted: %v", record)
+		}
+	}
+	if strings.Contains(buffer.String(), "passphrase") || strings.Contains(buffer.String(), "secret") {
+		t.Errorf("sensitive parameters leaked into the access log")
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// jwtClockSkew is the maximum allowed difference between the issuance time of a
+// JWT token and the local clock. Clients are expected to mint a fresh token for
+// every request (or connection), so this also bounds the replay window.
+const jwtClockSkew = 60 * time.Second
+
+var (
+	errMissingAuth  = errors.New("missing bearer token")
+	errInvalidToken = errors.New("invalid bearer token")
+	errJWTFormat    = errors.New("malformed JWT token")
+	errJWTAlgorithm = errors.New("unsupported JWT signing algorithm")
+	errJWTSignature = errors.New("invalid JWT signature")
+	errJWTIssuedAt  = errors.New("JWT issuance time out of range")
+	errJWTExpired   = errors.New("JWT token expired")
+)
+
+// jwtHeader is the only JOSE header accepted and produced by the JWT helpers.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// jwtClaims are the registered JWT claims interpreted by the server.
+type jwtClaims struct {
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+}
+
+// Authenticator validates the credentials of an incoming HTTP or WebSocket
+// request before it's handed to the RPC server.
+type Authenticator interface {
+	// Authenticate checks the credentials of the request, returning the identity
+	// of the caller if they are valid.
+	Authenticate(r *http.Request) (string, error)
+}
+
+// identityContextKey is the context key under which the authenticated identity
+// of the caller is stored.
+type identityContextKey struct{}
+
+// IdentityFromContext retrieves the identity of the authenticated caller from
+// the context, if any.
+func IdentityFromContext(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(identityContextKey{}).(string)
+	return identity, ok
+}
+
+// bearerToken extracts the bearer token from the Authorization header.
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return "", errMissingAuth
+	}
+	return strings.TrimSpace(header[7:]), nil
+}
+
+// tokenAuth is an authenticator accepting a single static bearer token.
+type tokenAuth struct {
+	token []byte
+}
+
+// NewTokenAuth creates an authenticator which accepts requests carrying the
+// given static bearer token.
+func NewTokenAuth(token string) Authenticator {
+	return &tokenAuth{token: []byte(token)}
+}
+
+// Authenticate implements Authenticator, comparing the bearer token of the request
+// against the configured one in constant time.
+func (a *tokenAuth) Authenticate(r *http.Request) (string, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(token), a.token) != 1 {
+		return "", errInvalidToken
+	}
+	return "token", nil
+}
+
+// jwtAuth is an authenticator accepting HS256 signed JWT bearer tokens.
+type jwtAuth struct {
+	secret []byte
+}
+
+// NewJWTAuth creates an authenticator which accepts requests carrying a JWT token
+// signed with the given secret using HS256. Tokens must have an issuance time
+// within a minute of the local clock, and are rejected after their expiry time
+// if one is set. The subject claim, if present, is used as the caller identity.
+func NewJWTAuth(secret []byte) Authenticator {
+	return &jwtAuth{secret: secret}
+}
+
+// Authenticate implements Authenticator, validating the JWT bearer token of the
+// request.
+func (a *jwtAuth) Authenticate(r *http.Request) (string, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return "", err
+	}
+	claims, err := verifyJWT(a.secret, token, time.Now())
+	if err != nil {
+		return "", err
+	}
+	if claims.Subject != "" {
+		return claims.Subject, nil
+	}
+	return "jwt", nil
+}
+
+// verifyJWT checks the signature and the time based claims of a JWT token.
+func verifyJWT(secret []byte, token string, now time.Time) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errJWTFormat
+	}
+	// Ensure the token was signed with the only supported algorithm
+	blob, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errJWTFormat
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(blob, &header); err != nil {
+		return nil, errJWTFormat
+	}
+	if header.Alg != "HS256" {
+		return nil, errJWTAlgorithm
+	}
+	// Verify the signature before looking at any claims
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errJWTFormat
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errJWTSignature
+	}
+	// Signature valid, check the time claims
+	if blob, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, errJWTFormat
+	}
+	claims := new(jwtClaims)
+	if err := json.Unmarshal(blob, claims); err != nil {
+		return nil, errJWTFormat
+	}
+	issued := time.Unix(claims.IssuedAt, 0)
+	if issued.Before(now.Add(-jwtClockSkew)) || issued.After(now.Add(jwtClockSkew)) {
+		return nil, errJWTIssuedAt
+	}
+	if claims.ExpiresAt != 0 && !now.Before(time.Unix(claims.ExpiresAt, 0)) {
+		return nil, errJWTExpired
+	}
+	return claims, nil
+}
+
+// newJWTToken creates a HS256 signed JWT token issued at the given time.
+func newJWTToken(secret []byte, subject string, now time.Time) (string, error) {
+	blob, err := json.Marshal(&jwtClaims{IssuedAt: now.Unix(), Subject: subject})
+	if err != nil {
+		return "", err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(blob)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// authHandler is a handler which rejects any request not passing authentication,
+// and injects the identity of the caller into the request context otherwise.
+type authHandler struct {
+	auth Authenticator
+	next http.Handler
+}
+
+// newAuthHandler wraps a handler with authentication. If no authenticator is
+// given, the original handler is returned.
+func newAuthHandler(auth Authenticator, next http.Handler) http.Handler {
+	if auth == nil {
+		return next
+	}
+	return &authHandler{auth: auth, next: next}
+}
+
+// ServeHTTP implements http.Handler, authenticating the request before passing
+// it to the wrapped handler.
+func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	identity, err := h.auth.Authenticate(r)
+	if err != nil {
+		log.Debug("Rejected unauthenticated RPC request", "remote", r.RemoteAddr, "err", err)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	ctx := context.WithValue(r.Context(), identityContextKey{}, identity)
+	h.next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// HTTPAuth is a client side credential provider, setting the authentication
+// headers on outgoing HTTP requests and WebSocket handshakes.
+type HTTPAuth func(header http.Header) error
+
+// BearerAuth creates a credential provider attaching a static bearer token.
+func BearerAuth(token string) HTTPAuth {
+	return func(header http.Header) error {
+		header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+}
+
+// JWTAuth creates a credential provider attaching a freshly minted HS256 JWT
+// token, signed with the given secret, to every request.
+func JWTAuth(secret []byte) HTTPAuth {
+	return func(header http.Header) error {
+		token, err := newJWTToken(secret, "", time.Now())
+		if err != nil {
+			return err
+		}
+		header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAuthSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// Tests that JWT tokens are validated against the signature and time claims.
+func TestJWTVerification(t *testing.T) {
+	now := time.Now()
+
+	valid, _ := newJWTToken(testAuthSecret, "analyst", now)
+	if claims, err := verifyJWT(testAuthSecret, valid, now); err != nil || claims.Subject != "analyst" {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	stale, _ := newJWTToken(testAuthSecret, "", now.Add(-2*jwtClockSkew))
+	future, _ := newJWTToken(testAuthSecret, "", now.Add(2*jwtClockSkew))
+	forged, _ := newJWTToken([]byte("another secret"), "", now)
+	spliced := stale[:strings.LastIndex(stale, ".")] + valid[strings.LastIndex(valid, "."):]
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + valid[strings.Index(valid, "."):]
+
+	tests := []struct {
+		token string
+		err   error
+	}{
+		{"", errJWTFormat},
+		{"a.b", errJWTFormat},
+		{stale, errJWTIssuedAt},
+		{future, errJWTIssuedAt},
+		{forged, errJWTSignature},
+		{none, errJWTAlgorithm},
+		{spliced, errJWTSignature},
+	}
+	for i, tt := range tests {
+		if _, err := verifyJWT(testAuthSecret, tt.token, now); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that the HTTP endpoint rejects unauthenticated requests and serves ones
+// with valid credentials, both static and JWT.
+func TestHTTPAuthentication(t *testing.T) {
+	tests := []struct {
+		auth   Authenticator
+		client HTTPAuth
+		ok     bool
+	}{
+		{NewJWTAuth(testAuthSecret), nil, false},
+		{NewJWTAuth(testAuthSecret), JWTAuth(testAuthSecret), true},
+		{NewJWTAuth(testAuthSecret), JWTAuth([]byte("another secret")), false},
+		{NewJWTAuth(testAuthSecret), BearerAuth("token"), false},
+		{NewTokenAuth("token"), BearerAuth("token"), true},
+		{NewTokenAuth("token"), BearerAuth("other"), false},
+	}
+	for i, tt := range tests {
+		server := newTestServer()
+		httpsrv := httptest.NewServer(newAuthHandler(tt.auth, server))
+
+		client, err := DialHTTPWithAuth(httpsrv.URL, new(http.Client), tt.client)
+		if err != nil {
+			t.Fatalf("test %d: failed to dial: %v", i, err)
+		}
+		var result Result
+		err = client.Call(&result, "test_echo", "hello", 10, &Args{"world"})
+		if tt.ok && err != nil {
+			t.Errorf("test %d: authenticated call failed: %v", i, err)
+		}
+		if !tt.ok && (err == nil || !strings.Contains(err.Error(), "401")) {
+			t.Errorf("test %d: unauthenticated call error mismatch: have %v, want 401", i, err)
+		}
+		client.Close()
+		httpsrv.Close()
+		server.Stop()
+	}
+}
+
+// Tests that the WebSocket endpoint rejects unauthenticated handshakes and
+// accepts ones with valid credentials.
+func TestWebsocketAuthentication(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	httpsrv := httptest.NewServer(newAuthHandler(NewJWTAuth(testAuthSecret), server.WebsocketHandler([]string{"*"})))
+	defer httpsrv.Close()
+
+	endpoint := "ws:" + strings.TrimPrefix(httpsrv.URL, "http:")
+	if client, err := DialWebsocket(context.Background(), endpoint, ""); err == nil {
+		client.Close()
+		t.Fatalf("unauthenticated handshake accepted")
+	}
+	client, err := DialWebsocketWithAuth(context.Background(), endpoint, "", JWTAuth(testAuthSecret))
+	if err != nil {
+		t.Fatalf("authenticated handshake rejected: %v", err)
+	}
+	defer client.Close()
+
+	var result Result
+	if err := client.Call(&result, "test_echo", "hello", 10, &Args{"world"}); err != nil {
+		t.Fatalf("authenticated call failed: %v", err)
+	}
+}
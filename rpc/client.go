@@ -25,6 +25,7 @@ import (
 	"net/url"
 	"reflect"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -35,6 +36,7 @@ var (
 	ErrClientQuit                = errors.New("client is closed")
 	ErrNoResult                  = errors.New("no result in JSON-RPC response")
 	ErrSubscriptionQueueOverflow = errors.New("subscription queue overflow")
+	ErrReconnectUnsupported      = errors.New("reconnecting not supported by the transport")
 	errClientReconnected         = errors.New("client reconnected")
 	errDead                      = errors.New("connection lost")
 )
@@ -44,6 +46,10 @@ const (
 	tcpKeepAliveInterval = 30 * time.Second
 	defaultDialTimeout   = 10 * time.Second // used if context has no deadline
 	subscribeTimeout     = 5 * time.Second  // overall timeout eth_subscribe, rpc_modules calls
+
+	// Backoff between redial attempts of reconnecting clients
+	defaultReconnectMinBackoff = 500 * time.Millisecond
+	defaultReconnectMaxBackoff = 30 * time.Second
 )
 
 const (
@@ -73,17 +79,30 @@ type BatchElem struct {
 	Error error
 }
 
+// ReconnectConfig configures the automatic reconnection of a client whose
+// connection was lost.
+type ReconnectConfig struct {
+	MinBackoff time.Duration // Delay before the first redial attempt (0 = default)
+	MaxBackoff time.Duration // Maximum delay between redial attempts (0 = default)
+}
+
 // Client represents a connection to an RPC server.
 type Client struct {
 	idgen    func() ID // for subscriptions
 	isHTTP   bool
 	services *serviceRegistry
+	connCtx  context.Context // base context of requests served on the connection
 
 	idCounter uint32
 
 	// This function, if non-nil, is called when the connection is lost.
 	reconnectFunc reconnectFunc
 
+	// reconnectConf, if non-nil, enables redialing lost connections in the background
+	// and resuming the active subscriptions on the new connection.
+	reconnectConf *ReconnectConfig
+	reconnectLock sync.Mutex
+
 	// writeConn is used for writing to the connection on the caller's goroutine. It should
 	// only be accessed outside of dispatch, with the write lock held. The write lock is
 	// taken by sending on requestOp and released by sending on sendDone.
@@ -111,7 +130,7 @@ type clientConn struct {
 }
 
 func (c *Client) newClientConn(conn ServerCodec) *clientConn {
-	ctx := context.WithValue(context.Background(), clientContextKey{}, c)
+	ctx := context.WithValue(c.connCtx, clientContextKey{}, c)
 	handler := newHandler(ctx, conn, c.idgen, c.services)
 	return &clientConn{conn, handler}
 }
@@ -127,10 +146,11 @@ type readOp struct {
 }
 
 type requestOp struct {
-	ids  []json.RawMessage
-	err  error
-	resp chan *jsonrpcMessage // receives up to len(ids) responses
-	sub  *ClientSubscription  // only set for EthSubscribe requests
+	ids    []json.RawMessage
+	err    error
+	resp   chan *jsonrpcMessage // receives up to len(ids) responses
+	sub    *ClientSubscription  // only set for EthSubscribe requests
+	resume bool                 // whether sub is resumed after a reconnect
 }
 
 func (op *requestOp) wait(ctx context.Context, c *Client) (*jsonrpcMessage, error) {
@@ -196,14 +216,15 @@ func newClient(initctx context.Context, connect reconnectFunc) (*Client, error)
 	if err != nil {
 		return nil, err
 	}
-	c := initClient(conn, randomIDGenerator(), new(serviceRegistry))
+	c := initClient(context.Background(), conn, randomIDGenerator(), new(serviceRegistry))
 	c.reconnectFunc = connect
 	return c, nil
 }
 
-func initClient(conn ServerCodec, idgen func() ID, services *serviceRegistry) *Client {
+func initClient(connCtx context.Context, conn ServerCodec, idgen func() ID, services *serviceRegistry) *Client {
 	_, isHTTP := conn.(*httpConn)
 	c := &Client{
+		connCtx:     connCtx,
 		idgen:       idgen,
 		isHTTP:      isHTTP,
 		services:    services,
@@ -247,6 +268,42 @@ func (c *Client) SupportedModules() (map[string]string, error) {
 	return result, err
 }
 
+// SetReconnect enables the reconnecting mode of the client. In this mode, a lost
+// connection is redialed in the background with exponential backoff, and active
+// subscriptions are re-established on the new connection instead of failing.
+// Resumed subscriptions are signaled on their Resumed channel, so callers can
+// back-fill any data missed while the connection was down. Calls issued while the
+// connection is down still fail.
+//
+// Reconnecting is only supported for clients with a persistent connection which
+// can be redialed, i.e. websocket, IPC and stdio clients.
+func (c *Client) SetReconnect(config ReconnectConfig) error {
+	if c.isHTTP || c.reconnectFunc == nil {
+		return ErrReconnectUnsupported
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = defaultReconnectMinBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaultReconnectMaxBackoff
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = config.MinBackoff
+	}
+	c.reconnectLock.Lock()
+	defer c.reconnectLock.Unlock()
+	c.reconnectConf = &config
+	return nil
+}
+
+// reconnectConfig returns the reconnection settings of the client, or nil if the
+// reconnecting mode is disabled.
+func (c *Client) reconnectConfig() *ReconnectConfig {
+	c.reconnectLock.Lock()
+	defer c.reconnectLock.Unlock()
+	return c.reconnectConf
+}
+
 // Close closes the client, aborting any in-flight requests.
 func (c *Client) Close() {
 	if c.isHTTP {
@@ -436,6 +493,7 @@ func (c *Client) Subscribe(ctx context.Context, namespace string, channel interf
 		resp: make(chan *jsonrpcMessage),
 		sub:  newClientSubscription(c, namespace, chanVal),
 	}
+	op.sub.params = msg.Params
 
 	// Send the subscription request.
 	// The arrival and validity of the response is signaled on sub.quit.
@@ -524,6 +582,7 @@ func (c *Client) dispatch(codec ServerCodec) {
 		reqInitLock = c.reqInit // nil while the send lock is held
 		conn        = c.newClientConn(codec)
 		reading     = true
+		resume      []*ClientSubscription // subscriptions to resume after reconnecting
 	)
 	defer func() {
 		close(c.closing)
@@ -531,6 +590,9 @@ func (c *Client) dispatch(codec ServerCodec) {
 			conn.close(ErrClientQuit, nil)
 			c.drainRead()
 		}
+		for _, sub := range resume {
+			sub.quitWithError(ErrClientQuit, false)
+		}
 		close(c.didClose)
 	}()
 
@@ -552,8 +614,15 @@ func (c *Client) dispatch(codec ServerCodec) {
 
 		case err := <-c.readErr:
 			conn.handler.log.Debug("RPC connection read error", "err", err)
+			config := c.reconnectConfig()
+			if config != nil {
+				resume = append(resume, conn.handler.takeClientSubscriptions()...)
+			}
 			conn.close(err, lastOp)
 			reading = false
+			if config != nil {
+				go c.redial(conn.codec, *config)
+			}
 
 		// Reconnect:
 		case newcodec := <-c.reconnected:
@@ -564,6 +633,9 @@ func (c *Client) dispatch(codec ServerCodec) {
 				// In those cases the caller will notice first and reconnect. Closing the
 				// handler terminates all waiting requests (closing op.resp) except for
 				// lastOp, which will be transferred to the new handler.
+				if c.reconnectConfig() != nil {
+					resume = append(resume, conn.handler.takeClientSubscriptions()...)
+				}
 				conn.close(errClientReconnected, lastOp)
 				c.drainRead()
 			}
@@ -573,6 +645,10 @@ func (c *Client) dispatch(codec ServerCodec) {
 			// Re-register the in-flight request on the new handler
 			// because that's where it will be sent.
 			conn.handler.addRequestOp(lastOp)
+			if len(resume) > 0 {
+				go c.resubscribe(resume)
+				resume = nil
+			}
 
 		// Send path:
 		case op := <-reqInitLock:
@@ -597,6 +673,104 @@ func (c *Client) dispatch(codec ServerCodec) {
 	}
 }
 
+// redial re-establishes a lost connection in the background, retrying with
+// exponential backoff until it succeeds, the connection is re-established by
+// a caller or the client is closed.
+func (c *Client) redial(failed ServerCodec, config ReconnectConfig) {
+	backoff := config.MinBackoff
+	for {
+		select {
+		case <-time.After(backoff):
+		case <-c.closing:
+			return
+		}
+		// Take the write lock, so the connection isn't replaced concurrently.
+		select {
+		case c.reqInit <- new(requestOp):
+		case <-c.closing:
+			return
+		}
+		if c.writeConn != nil && c.writeConn != failed {
+			c.reqSent <- nil
+			return
+		}
+		c.writeConn = nil
+		err := c.reconnect(context.Background())
+		c.reqSent <- err
+		if err == nil || err == ErrClientQuit {
+			return
+		}
+		log.Debug("RPC client redial failed", "err", err, "backoff", backoff)
+		if backoff *= 2; backoff > config.MaxBackoff {
+			backoff = config.MaxBackoff
+		}
+	}
+}
+
+// resubscribe re-establishes subscriptions after the connection was replaced. If
+// a subscription request fails because the connection is lost again, it is
+// retried until the client is closed. Subscriptions rejected by the server end
+// with the error returned by it.
+func (c *Client) resubscribe(subs []*ClientSubscription) {
+	backoff := defaultReconnectMinBackoff
+	for len(subs) > 0 {
+		var failed []*ClientSubscription
+		for _, sub := range subs {
+			if sub.closed() {
+				continue // Unsubscribed while the connection was down
+			}
+			err := c.resubscribeOne(sub)
+			switch err.(type) {
+			case nil:
+				sub.resumed()
+			case Error:
+				sub.quitWithError(err, false)
+			default:
+				if err == ErrClientQuit {
+					sub.quitWithError(err, false)
+					continue
+				}
+				log.Debug("RPC client resubscribe failed", "err", err)
+				failed = append(failed, sub)
+			}
+		}
+		if subs = failed; len(subs) == 0 {
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-c.closing:
+			for _, sub := range subs {
+				sub.quitWithError(ErrClientQuit, false)
+			}
+			return
+		}
+		if backoff *= 2; backoff > defaultReconnectMaxBackoff {
+			backoff = defaultReconnectMaxBackoff
+		}
+	}
+}
+
+// resubscribeOne re-issues the subscribe request of a single subscription. The
+// subscription keeps delivering to its channel, only its ID changes.
+func (c *Client) resubscribeOne(sub *ClientSubscription) error {
+	msg := &jsonrpcMessage{Version: vsn, ID: c.nextID(), Method: sub.namespace + subscribeMethodSuffix, Params: sub.params}
+	op := &requestOp{
+		ids:    []json.RawMessage{msg.ID},
+		resp:   make(chan *jsonrpcMessage),
+		sub:    sub,
+		resume: true,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+	defer cancel()
+
+	if err := c.send(ctx, op, msg); err != nil {
+		return err
+	}
+	_, err := op.wait(ctx, c)
+	return err
+}
+
 // drainRead drops read messages until an error occurs.
 func (c *Client) drainRead() {
 	for {
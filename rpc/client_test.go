@@ -49,6 +49,31 @@ func TestClientRequest(t *testing.T) {
 	}
 }
 
+func TestClientErrorData(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var resp interface{}
+	err := client.Call(&resp, "test_returnError")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	// Check code.
+	if e, ok := err.(Error); !ok {
+		t.Fatalf("client did not return rpc.Error, got %#v", e)
+	} else if e.ErrorCode() != (testError{}.ErrorCode()) {
+		t.Fatalf("wrong error code %d, want %d", e.ErrorCode(), testError{}.ErrorCode())
+	}
+	// Check data.
+	if e, ok := err.(DataError); !ok {
+		t.Fatalf("client did not return rpc.DataError, got %#v", e)
+	} else if e.ErrorData() != (testError{}.ErrorData()) {
+		t.Fatalf("wrong error data %#v, want %#v", e.ErrorData(), testError{}.ErrorData())
+	}
+}
+
 func TestClientBatchRequest(t *testing.T) {
 	server := newTestServer()
 	defer server.Stop()
@@ -492,6 +517,80 @@ func TestClientReconnect(t *testing.T) {
 	}
 }
 
+// Tests that clients in reconnecting mode redial lost connections in the background
+// and resume their subscriptions on the new connection.
+func TestClientReconnectSubscription(t *testing.T) {
+	startServer := func(addr string) (*Server, net.Listener) {
+		srv := newTestServer()
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Fatal("can't listen:", err)
+		}
+		go http.Serve(l, srv.WebsocketHandler([]string{"*"}))
+		return srv, l
+	}
+	s1, l1 := startServer("127.0.0.1:0")
+	client, err := Dial("ws://" + l1.Addr().String())
+	if err != nil {
+		t.Fatal("can't dial", err)
+	}
+	defer client.Close()
+	if err := client.SetReconnect(ReconnectConfig{MinBackoff: 50 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}); err != nil {
+		t.Fatal("can't enable reconnecting:", err)
+	}
+	nc := make(chan int)
+	sub, err := client.Subscribe(context.Background(), "nftest", nc, "someSubscription", 2, 0)
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	receive := func() {
+		for i := 0; i < 2; i++ {
+			select {
+			case val := <-nc:
+				if val != i {
+					t.Fatalf("value mismatch: got %d, want %d", val, i)
+				}
+			case err := <-sub.Err():
+				t.Fatalf("subscription failed: %v", err)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("notification %d not received", i)
+			}
+		}
+	}
+	receive()
+
+	// Restart the server, the subscription should be resumed on the new one
+	l1.Close()
+	s1.Stop()
+	time.Sleep(200 * time.Millisecond)
+
+	s2, l2 := startServer(l1.Addr().String())
+	defer l2.Close()
+	defer s2.Stop()
+
+	select {
+	case <-sub.Resumed():
+	case err := <-sub.Err():
+		t.Fatalf("subscription failed: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not resumed")
+	}
+	receive()
+
+	sub.Unsubscribe()
+	if err := <-sub.Err(); err != nil {
+		t.Fatalf("Err returned a non-nil error after explicit unsubscribe: %q", err)
+	}
+	// Reconnecting isn't supported over HTTP
+	httpclient, err := DialHTTP("http://" + l2.Addr().String())
+	if err != nil {
+		t.Fatal("can't dial", err)
+	}
+	if err := httpclient.SetReconnect(ReconnectConfig{}); err != ErrReconnectUnsupported {
+		t.Fatalf("HTTP reconnect error mismatch: have %v, want %v", err, ErrReconnectUnsupported)
+	}
+}
+
 func httpTestClient(srv *Server, transport string, fl *flakeyListener) (*Client, *httptest.Server) {
 	// Create the HTTP server.
 	var hs *httptest.Server
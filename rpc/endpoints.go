@@ -22,8 +22,45 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 )
 
-// StartHTTPEndpoint starts the HTTP RPC endpoint, configured with cors/vhosts/modules
-func StartHTTPEndpoint(endpoint string, apis []API, modules []string, cors []string, vhosts []string, timeouts HTTPTimeouts) (net.Listener, *Server, error) {
+// StartHTTPEndpoint starts the HTTP RPC endpoint, configured with cors/vhosts/modules.
+// If an authenticator is given, requests failing authentication are rejected. If
+// an access policy is given, calls are restricted by it.
+func StartHTTPEndpoint(endpoint string, apis []API, modules []string, cors []string, vhosts []string, timeouts HTTPTimeouts, auth Authenticator, policy *AccessPolicy) (net.Listener, *Server, error) {
+	// Register all the APIs exposed by the services
+	handler, err := newHTTPEndpointServer(apis, modules, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	// All APIs registered, start the HTTP listener
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	go NewHTTPServer(cors, vhosts, timeouts, newAuthHandler(auth, handler)).Serve(listener)
+	return listener, handler, err
+}
+
+// StartWSEndpoint starts a websocket endpoint. If an authenticator is given,
+// connections failing authentication are rejected before the upgrade. If an
+// access policy is given, calls are restricted by it.
+func StartWSEndpoint(endpoint string, apis []API, modules []string, wsOrigins []string, exposeAll bool, auth Authenticator, policy *AccessPolicy) (net.Listener, *Server, error) {
+	// Register all the APIs exposed by the services
+	handler, err := newWSEndpointServer(apis, modules, exposeAll, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	// All APIs registered, start the HTTP listener
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	go newAuthWSServer(wsOrigins, auth, handler).Serve(listener)
+	return listener, handler, err
+}
+
+// newHTTPEndpointServer creates an RPC server with the APIs to be exposed over
+// HTTP registered.
+func newHTTPEndpointServer(apis []API, modules []string, policy *AccessPolicy) (*Server, error) {
 	// Generate the whitelist based on the allowed modules
 	whitelist := make(map[string]bool)
 	for _, module := range modules {
@@ -31,29 +68,21 @@ func StartHTTPEndpoint(endpoint string, apis []API, modules []string, cors []str
 	}
 	// Register all the APIs exposed by the services
 	handler := NewServer()
+	handler.SetAccessPolicy(policy)
 	for _, api := range apis {
 		if whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
 			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
-				return nil, nil, err
+				return nil, err
 			}
 			log.Debug("HTTP registered", "namespace", api.Namespace)
 		}
 	}
-	// All APIs registered, start the HTTP listener
-	var (
-		listener net.Listener
-		err      error
-	)
-	if listener, err = net.Listen("tcp", endpoint); err != nil {
-		return nil, nil, err
-	}
-	go NewHTTPServer(cors, vhosts, timeouts, handler).Serve(listener)
-	return listener, handler, err
+	return handler, nil
 }
 
-// StartWSEndpoint starts a websocket endpoint
-func StartWSEndpoint(endpoint string, apis []API, modules []string, wsOrigins []string, exposeAll bool) (net.Listener, *Server, error) {
-
+// newWSEndpointServer creates an RPC server with the APIs to be exposed over
+// websocket registered.
+func newWSEndpointServer(apis []API, modules []string, exposeAll bool, policy *AccessPolicy) (*Server, error) {
 	// Generate the whitelist based on the allowed modules
 	whitelist := make(map[string]bool)
 	for _, module := range modules {
@@ -61,31 +90,24 @@ func StartWSEndpoint(endpoint string, apis []API, modules []string, wsOrigins []
 	}
 	// Register all the APIs exposed by the services
 	handler := NewServer()
+	handler.SetAccessPolicy(policy)
 	for _, api := range apis {
 		if exposeAll || whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
 			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
-				return nil, nil, err
+				return nil, err
 			}
 			log.Debug("WebSocket registered", "service", api.Service, "namespace", api.Namespace)
 		}
 	}
-	// All APIs registered, start the HTTP listener
-	var (
-		listener net.Listener
-		err      error
-	)
-	if listener, err = net.Listen("tcp", endpoint); err != nil {
-		return nil, nil, err
-	}
-	go NewWSServer(wsOrigins, handler).Serve(listener)
-	return listener, handler, err
-
+	return handler, nil
 }
 
-// StartIPCEndpoint starts an IPC endpoint.
-func StartIPCEndpoint(ipcEndpoint string, apis []API) (net.Listener, *Server, error) {
+// StartIPCEndpoint starts an IPC endpoint. If an access policy is given, calls
+// are restricted by it.
+func StartIPCEndpoint(ipcEndpoint string, apis []API, policy *AccessPolicy) (net.Listener, *Server, error) {
 	// Register all the APIs exposed by the services.
 	handler := NewServer()
+	handler.SetAccessPolicy(policy)
 	for _, api := range apis {
 		if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
 			return nil, nil, err
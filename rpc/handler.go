@@ -23,6 +23,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/log"
@@ -61,6 +62,8 @@ type handler struct {
 	conn           jsonWriter                     // where responses will be sent
 	log            log.Logger
 	allowSubscribe bool
+	remoteHost     string // host of the remote end, used for rate limiting
+	inflight       int32  // number of executing requests, accessed atomically
 
 	subLock    sync.Mutex
 	serverSubs map[ID]*Subscription
@@ -84,6 +87,7 @@ func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *
 		allowSubscribe: true,
 		serverSubs:     make(map[ID]*Subscription),
 		log:            log.Root(),
+		remoteHost:     remoteHost(conn.RemoteAddr()),
 	}
 	if conn.RemoteAddr() != "" {
 		h.log = h.log.New("conn", conn.RemoteAddr())
@@ -112,6 +116,14 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 	if len(calls) == 0 {
 		return
 	}
+	// Reject the batch if it's too large or too many requests are executing:
+	if err := h.admit(len(msgs)); err != nil {
+		h.log.Debug("Rejected RPC batch", "len", len(msgs), "err", err)
+		h.startCallProc(func(cp *callProc) {
+			h.conn.Write(cp.ctx, errorMessage(err))
+		})
+		return
+	}
 	// Process calls on a goroutine because they may block indefinitely:
 	h.startCallProc(func(cp *callProc) {
 		answers := make([]*jsonrpcMessage, 0, len(msgs))
@@ -120,6 +132,7 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 				answers = append(answers, answer)
 			}
 		}
+		atomic.AddInt32(&h.inflight, -1)
 		h.addSubscriptions(cp.notifiers)
 		if len(answers) > 0 {
 			h.conn.Write(cp.ctx, answers)
@@ -135,8 +148,18 @@ func (h *handler) handleMsg(msg *jsonrpcMessage) {
 	if ok := h.handleImmediate(msg); ok {
 		return
 	}
+	if err := h.admit(1); err != nil {
+		h.log.Debug("Rejected RPC request", "reqid", idForLog{msg.ID}, "method", msg.Method, "err", err)
+		if !msg.isNotification() {
+			h.startCallProc(func(cp *callProc) {
+				h.conn.Write(cp.ctx, msg.errorResponse(err))
+			})
+		}
+		return
+	}
 	h.startCallProc(func(cp *callProc) {
 		answer := h.handleCallMsg(cp, msg)
+		atomic.AddInt32(&h.inflight, -1)
 		h.addSubscriptions(cp.notifiers)
 		if answer != nil {
 			h.conn.Write(cp.ctx, answer)
@@ -147,6 +170,26 @@ func (h *handler) handleMsg(msg *jsonrpcMessage) {
 	})
 }
 
+// admit checks a request (or batch of requests) against the batch size and the
+// concurrency limits. If it's admitted, the request is counted as executing on
+// this connection and the caller must decrement the counter once done. HTTP
+// serves every request on a new connection, so it's never over the limit.
+func (h *handler) admit(size int) error {
+	limiter := h.reg.rateLimiter()
+	if limiter == nil {
+		atomic.AddInt32(&h.inflight, 1)
+		return nil
+	}
+	if err := limiter.checkBatch(size); err != nil {
+		return err
+	}
+	if err := limiter.checkConcurrency(int(atomic.AddInt32(&h.inflight, 1))); err != nil {
+		atomic.AddInt32(&h.inflight, -1)
+		return err
+	}
+	return nil
+}
+
 // close cancels all requests except for inflightReq and waits for
 // call goroutines to shut down.
 func (h *handler) close(err error, inflightReq *requestOp) {
@@ -193,6 +236,17 @@ func (h *handler) cancelAllRequests(err error, inflightReq *requestOp) {
 	}
 }
 
+// takeClientSubscriptions removes all active client subscriptions from the handler,
+// so they aren't ended when the handler is closed.
+func (h *handler) takeClientSubscriptions() []*ClientSubscription {
+	subs := make([]*ClientSubscription, 0, len(h.clientSubs))
+	for id, sub := range h.clientSubs {
+		delete(h.clientSubs, id)
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
 func (h *handler) addSubscriptions(nn []*Notifier) {
 	h.subLock.Lock()
 	defer h.subLock.Unlock()
@@ -280,9 +334,18 @@ func (h *handler) handleResponse(msg *jsonrpcMessage) {
 		op.err = msg.Error
 		return
 	}
-	if op.err = json.Unmarshal(msg.Result, &op.sub.subid); op.err == nil {
+	var subid string
+	if op.err = json.Unmarshal(msg.Result, &subid); op.err != nil {
+		return
+	}
+	op.sub.setID(subid)
+	h.clientSubs[subid] = op.sub
+	if !op.resume {
 		go op.sub.start()
-		h.clientSubs[op.sub.subid] = op.sub
+	} else if op.sub.closed() {
+		// Unsubscribed while the subscription was being resumed
+		delete(h.clientSubs, subid)
+		go op.sub.requestUnsubscribe()
 	}
 }
 
@@ -293,6 +356,7 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMess
 	case msg.isNotification():
 		h.handleCall(ctx, msg)
 		h.log.Debug("Served "+msg.Method, "t", time.Since(start))
+		h.recordCall(ctx, msg, nil, time.Since(start))
 		return nil
 	case msg.isCall():
 		resp := h.handleCall(ctx, msg)
@@ -301,6 +365,7 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMess
 		} else {
 			h.log.Debug("Served "+msg.Method, "reqid", idForLog{msg.ID}, "t", time.Since(start))
 		}
+		h.recordCall(ctx, msg, resp, time.Since(start))
 		return resp
 	case msg.hasValidID():
 		return msg.errorResponse(&invalidRequestError{"invalid request"})
@@ -309,6 +374,13 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMess
 	}
 }
 
+// recordCall writes a served call into the access log of the server, if any.
+func (h *handler) recordCall(cp *callProc, msg, resp *jsonrpcMessage, elapsed time.Duration) {
+	if logger := h.reg.accessLog(); logger != nil {
+		logger.record(cp.ctx, h.conn.RemoteAddr(), msg, resp, elapsed)
+	}
+}
+
 // handleCall processes method calls.
 func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
 	if msg.isSubscribe() {
@@ -323,6 +395,14 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage
 	if callb == nil {
 		return msg.errorResponse(&methodNotFoundError{method: msg.Method})
 	}
+	if !msg.isUnsubscribe() {
+		if err := h.reg.authorize(cp.ctx, msg.Method); err != nil {
+			return msg.errorResponse(err)
+		}
+		if err := h.charge(msg.Method); err != nil {
+			return msg.errorResponse(err)
+		}
+	}
 	args, err := parsePositionalArguments(msg.Params, callb.argTypes)
 	if err != nil {
 		return msg.errorResponse(&invalidParamsError{err.Error()})
@@ -347,6 +427,12 @@ func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage) *jsonrpcMes
 	if callb == nil {
 		return msg.errorResponse(&subscriptionNotFoundError{namespace, name})
 	}
+	if err := h.reg.authorize(cp.ctx, msg.Method); err != nil {
+		return msg.errorResponse(err)
+	}
+	if err := h.charge(msg.Method); err != nil {
+		return msg.errorResponse(err)
+	}
 
 	// Parse subscription name arg too, but remove it before calling the callback.
 	argTypes := append([]reflect.Type{stringType}, callb.argTypes...)
@@ -364,6 +450,15 @@ func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage) *jsonrpcMes
 	return h.runMethod(ctx, msg, callb, args)
 }
 
+// charge deducts the cost of a method call from the rate limiting budget of the
+// remote host.
+func (h *handler) charge(method string) error {
+	if limiter := h.reg.rateLimiter(); limiter != nil {
+		return limiter.take(h.remoteHost, method)
+	}
+	return nil
+}
+
 // runMethod runs the Go callback for an RPC method.
 func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value) *jsonrpcMessage {
 	result, err := callb.call(ctx, msg.Method, args)
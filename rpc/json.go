@@ -115,6 +115,10 @@ func errorMessage(err error) *jsonrpcMessage {
 	if ok {
 		msg.Error.Code = ec.ErrorCode()
 	}
+	de, ok := err.(DataError)
+	if ok {
+		msg.Error.Data = de.ErrorData()
+	}
 	return msg
 }
 
@@ -135,12 +139,23 @@ func (err *jsonError) ErrorCode() int {
 	return err.Code
 }
 
+func (err *jsonError) ErrorData() interface{} {
+	return err.Data
+}
+
 // Conn is a subset of the methods of net.Conn which are sufficient for ServerCodec.
 type Conn interface {
 	io.ReadWriteCloser
 	SetWriteDeadline(time.Time) error
 }
 
+// deadlineCloser can be closed and has a write deadline, the minimum required of
+// the connections underlying a codec.
+type deadlineCloser interface {
+	io.Closer
+	SetWriteDeadline(time.Time) error
+}
+
 // ConnRemoteAddr wraps the RemoteAddr operation, which returns a description
 // of the peer address of a connection. If a Conn also implements ConnRemoteAddr, this
 // description is used in log messages.
@@ -165,22 +180,28 @@ type jsonCodec struct {
 	decode     func(v interface{}) error // decoder to allow multiple transports
 	encMu      sync.Mutex                // guards the encoder
 	encode     func(v interface{}) error // encoder to allow multiple transports
-	conn       Conn
+	conn       deadlineCloser
 }
 
 // NewCodec creates a new RPC server codec with support for JSON-RPC 2.0 based
 // on explicitly given encoding and decoding methods.
 func NewCodec(conn Conn, encode, decode func(v interface{}) error) ServerCodec {
-	codec := &jsonCodec{
+	codec := newFuncCodec(conn, encode, decode)
+	if ra, ok := conn.(ConnRemoteAddr); ok {
+		codec.remoteAddr = ra.RemoteAddr()
+	}
+	return codec
+}
+
+// newFuncCodec creates a JSON-RPC codec on top of a connection which isn't a byte
+// stream, using the given methods to encode and decode messages.
+func newFuncCodec(conn deadlineCloser, encode, decode func(v interface{}) error) *jsonCodec {
+	return &jsonCodec{
 		closed: make(chan interface{}),
 		encode: encode,
 		decode: decode,
 		conn:   conn,
 	}
-	if ra, ok := conn.(ConnRemoteAddr); ok {
-		codec.remoteAddr = ra.RemoteAddr()
-	}
-	return codec
 }
 
 // NewJSONCodec creates a new RPC server codec with support for JSON-RPC 2.0.
@@ -0,0 +1,202 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// bucketSweepInterval is the interval after which idle, fully refilled rate
+// limiting buckets are dropped.
+const bucketSweepInterval = time.Minute
+
+var (
+	batchLimitedCounter = metrics.NewRegisteredCounter("rpc/limited/batch", nil)
+	connLimitedCounter  = metrics.NewRegisteredCounter("rpc/limited/concurrency", nil)
+	rateLimitedCounter  = metrics.NewRegisteredCounter("rpc/limited/rate", nil)
+	rateAdmittedCounter = metrics.NewRegisteredCounter("rpc/limited/admitted", nil)
+)
+
+// limitExceededError is returned if a request is rejected because the caller
+// exceeded one of the request budgets of the server.
+type limitExceededError struct{ message string }
+
+func (e *limitExceededError) ErrorCode() int { return -32005 }
+
+func (e *limitExceededError) Error() string { return e.message }
+
+// RateLimitConfig is the set of request budgets enforced by a rate limiter.
+type RateLimitConfig struct {
+	BatchLimit int     `toml:",omitempty"` // Maximum number of requests in a batch (0 = unlimited)
+	ConnLimit  int     `toml:",omitempty"` // Maximum number of concurrently executing requests per connection, each HTTP request being one (0 = unlimited)
+	Rate       float64 `toml:",omitempty"` // Request cost refilled per second for every remote address (0 = unlimited)
+	Burst      float64 `toml:",omitempty"` // Maximum request cost a remote address may accumulate (0 = same as Rate)
+
+	// MethodCosts is the cost of calling individual methods, keyed by full method
+	// name (e.g. "eth_getLogs") or module wildcard (e.g. "debug_*"). Methods not
+	// listed cost 1.
+	MethodCosts map[string]float64 `toml:",omitempty"`
+}
+
+// RateLimiter enforces request budgets on the connections of one or more servers.
+// Token buckets are tracked per remote host, so a limiter shared by multiple
+// servers applies a common budget across all of them. Connections without a
+// remote address (IPC, in-process) are not subject to the rate limit. Executing
+// requests are counted per connection, so the concurrency limit does not restrict
+// HTTP callers, which get a new connection for every request.
+type RateLimiter struct {
+	config RateLimitConfig
+
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	lock      sync.Mutex
+}
+
+// NewRateLimiter creates a rate limiter enforcing the given budgets.
+func NewRateLimiter(config RateLimitConfig) (*RateLimiter, error) {
+	if config.BatchLimit < 0 || config.ConnLimit < 0 || config.Rate < 0 || config.Burst < 0 {
+		return nil, fmt.Errorf("negative RPC limits: %+v", config)
+	}
+	for pattern, cost := range config.MethodCosts {
+		if pattern != "*" && !strings.Contains(pattern, serviceMethodSeparator) {
+			return nil, fmt.Errorf("invalid method pattern %q in RPC method costs", pattern)
+		}
+		if cost < 0 || math.IsNaN(cost) || math.IsInf(cost, 0) {
+			return nil, fmt.Errorf("invalid cost %v for RPC method %s", cost, pattern)
+		}
+	}
+	if config.Burst == 0 {
+		config.Burst = config.Rate
+	}
+	return &RateLimiter{
+		config:    config,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}, nil
+}
+
+// checkBatch checks whether a batch of the given size may be served.
+func (l *RateLimiter) checkBatch(size int) error {
+	if l.config.BatchLimit > 0 && size > l.config.BatchLimit {
+		batchLimitedCounter.Inc(1)
+		return &limitExceededError{fmt.Sprintf("batch too large (%d > %d)", size, l.config.BatchLimit)}
+	}
+	return nil
+}
+
+// checkConcurrency checks whether a connection with the given number of executing
+// requests (including the new one) may start serving a new request.
+func (l *RateLimiter) checkConcurrency(inflight int) error {
+	if l.config.ConnLimit > 0 && inflight > l.config.ConnLimit {
+		connLimitedCounter.Inc(1)
+		return &limitExceededError{fmt.Sprintf("too many concurrent requests (limit %d)", l.config.ConnLimit)}
+	}
+	return nil
+}
+
+// take charges the cost of a method call to the budget of a remote host.
+func (l *RateLimiter) take(host, method string) error {
+	if l.config.Rate == 0 || host == "" {
+		return nil
+	}
+	cost := l.cost(method)
+	if cost == 0 {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > bucketSweepInterval {
+		for key, bucket := range l.buckets {
+			if bucket.refill(now, l.config.Rate, l.config.Burst) >= l.config.Burst {
+				delete(l.buckets, key)
+			}
+		}
+		l.lastSweep = now
+	}
+	bucket := l.buckets[host]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: l.config.Burst, updated: now}
+		l.buckets[host] = bucket
+	}
+	if !bucket.take(now, cost, l.config.Rate, l.config.Burst) {
+		rateLimitedCounter.Inc(1)
+		return &limitExceededError{fmt.Sprintf("rate limit exceeded for %s", method)}
+	}
+	rateAdmittedCounter.Inc(1)
+	return nil
+}
+
+// cost returns the cost of calling a method, looking it up by full name, module
+// wildcard and global wildcard, in that order.
+func (l *RateLimiter) cost(method string) float64 {
+	if cost, ok := l.config.MethodCosts[method]; ok {
+		return cost
+	}
+	if idx := strings.Index(method, serviceMethodSeparator); idx >= 0 {
+		if cost, ok := l.config.MethodCosts[method[:idx+1]+"*"]; ok {
+			return cost
+		}
+	}
+	if cost, ok := l.config.MethodCosts["*"]; ok {
+		return cost
+	}
+	return 1
+}
+
+// tokenBucket is the request budget of a single remote host.
+type tokenBucket struct {
+	tokens  float64   // Available budget, negative if in debt after an expensive call
+	updated time.Time // Time of the last refill
+}
+
+// refill credits the budget accumulated since the last update, capped at burst.
+func (b *tokenBucket) refill(now time.Time, rate, burst float64) float64 {
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+	return b.tokens
+}
+
+// take tries to charge the cost of a call to the bucket. Calls costing more than
+// the burst are admitted with a full bucket, leaving the bucket in debt.
+func (b *tokenBucket) take(now time.Time, cost, rate, burst float64) bool {
+	if b.refill(now, rate, burst) < math.Min(cost, burst) {
+		return false
+	}
+	b.tokens -= cost
+	return true
+}
+
+// remoteHost extracts the host from the remote address of a connection, which
+// may contain a port and a websocket origin suffix.
+func remoteHost(addr string) string {
+	if idx := strings.Index(addr, "("); idx >= 0 {
+		addr = addr[:idx]
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that the rate limiter charges method costs against per host budgets.
+func TestRateLimiterBudgets(t *testing.T) {
+	limiter, err := NewRateLimiter(RateLimitConfig{
+		Rate:        0.001,
+		Burst:       3,
+		MethodCosts: map[string]float64{"debug_*": 2, "debug_traceBlock": 10, "admin_peers": 0},
+	})
+	if err != nil {
+		t.Fatalf("failed to create limiter: %v", err)
+	}
+	tests := []struct {
+		host, method string
+		ok           bool
+	}{
+		{"1.1.1.1", "eth_call", true},
+		{"1.1.1.1", "debug_setHead", true},
+		{"1.1.1.1", "eth_call", false},
+		{"1.1.1.1", "admin_peers", true},
+		{"2.2.2.2", "debug_traceBlock", true}, // more expensive than the burst, admitted with full budget
+		{"2.2.2.2", "admin_peers", true},
+		{"2.2.2.2", "eth_call", false},
+		{"", "debug_traceBlock", true},
+		{"", "debug_traceBlock", true},
+	}
+	for i, tt := range tests {
+		if err := limiter.take(tt.host, tt.method); (err == nil) != tt.ok {
+			t.Errorf("test %d: %s/%s: admission mismatch: have %v, want %v", i, tt.host, tt.method, err, tt.ok)
+		}
+	}
+	if _, err := NewRateLimiter(RateLimitConfig{MethodCosts: map[string]float64{"debug": 1}}); err == nil {
+		t.Errorf("invalid method pattern accepted")
+	}
+	if _, err := NewRateLimiter(RateLimitConfig{MethodCosts: map[string]float64{"debug_*": -1}}); err == nil {
+		t.Errorf("negative method cost accepted")
+	}
+}
+
+// Tests that remote hosts are extracted from the various connection addresses.
+func TestRemoteHost(t *testing.T) {
+	tests := map[string]string{
+		"":                                "",
+		"127.0.0.1:8545":                  "127.0.0.1",
+		"[::1]:8545":                      "::1",
+		"10.0.0.1:1234(http://localhost)": "10.0.0.1",
+		"@":                               "@",
+	}
+	for addr, want := range tests {
+		if have := remoteHost(addr); have != want {
+			t.Errorf("%q: host mismatch: have %q, want %q", addr, have, want)
+		}
+	}
+}
+
+// Tests that oversized batches are rejected as a whole.
+func TestServerBatchLimit(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	limiter, _ := NewRateLimiter(RateLimitConfig{BatchLimit: 2})
+	server.SetRateLimiter(limiter)
+
+	httpsrv := httptest.NewServer(server)
+	defer httpsrv.Close()
+
+	post := func(body string) string {
+		resp, err := http.Post(httpsrv.URL, contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		blob, _ := ioutil.ReadAll(resp.Body)
+		return string(blob)
+	}
+	call := `{"jsonrpc":"2.0","id":1,"method":"rpc_modules"}`
+	if resp := post("[" + call + "," + call + "]"); strings.Contains(resp, "error") {
+		t.Errorf("batch within limit rejected: %s", resp)
+	}
+	if resp := post("[" + call + "," + call + "," + call + "]"); !strings.Contains(resp, "-32005") {
+		t.Errorf("oversized batch not rejected: %s", resp)
+	}
+}
+
+// Tests that requests exceeding the concurrency limit of a connection are
+// rejected while others are executing.
+func TestServerConcurrencyLimit(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	limiter, _ := NewRateLimiter(RateLimitConfig{ConnLimit: 1})
+	server.SetRateLimiter(limiter)
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- client.Call(nil, "test_sleep", time.Second) }()
+	time.Sleep(100 * time.Millisecond)
+
+	var result Result
+	err := client.Call(&result, "test_echo", "hello", 10, &Args{"world"})
+	if err == nil {
+		t.Fatalf("concurrent request admitted")
+	}
+	if code := err.(Error).ErrorCode(); code != -32005 {
+		t.Fatalf("error code mismatch: have %d, want %d", code, -32005)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("sleeping request failed: %v", err)
+	}
+	if err := client.Call(&result, "test_echo", "hello", 10, &Args{"world"}); err != nil {
+		t.Fatalf("request after completion rejected: %v", err)
+	}
+}
+
+// Tests that remote callers are rate limited across connections.
+func TestServerRateLimit(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	limiter, _ := NewRateLimiter(RateLimitConfig{Rate: 0.001, Burst: 2})
+	server.SetRateLimiter(limiter)
+
+	httpsrv := httptest.NewServer(server)
+	defer httpsrv.Close()
+
+	var result Result
+	for i := 0; i < 3; i++ {
+		client, err := DialHTTP(httpsrv.URL)
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		err = client.Call(&result, "test_echo", "hello", 10, &Args{"world"})
+		client.Close()
+
+		switch {
+		case i < 2 && err != nil:
+			t.Fatalf("call %d: request within budget rejected: %v", i, err)
+		case i == 2 && err == nil:
+			t.Fatalf("call %d: request over budget admitted", i)
+		case i == 2 && err.(Error).ErrorCode() != -32005:
+			t.Fatalf("call %d: error code mismatch: have %d, want %d", i, err.(Error).ErrorCode(), -32005)
+		}
+	}
+}
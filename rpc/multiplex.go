@@ -0,0 +1,110 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// MultiplexConfig is the configuration of an endpoint serving HTTP and WebSocket
+// JSON-RPC, along with arbitrary other HTTP handlers, on a single listener.
+type MultiplexConfig struct {
+	HTTPModules      []string     // API modules exposed over plain HTTP
+	HTTPCors         []string     // Allowed CORS domains for all non-websocket requests
+	HTTPVirtualHosts []string     // Allowed virtual hosts for all requests
+	HTTPTimeouts     HTTPTimeouts // Timeouts of the shared HTTP server
+
+	WSEnabled   bool     // Whether websocket upgrade requests are served
+	WSModules   []string // API modules exposed over websocket
+	WSOrigins   []string // Allowed websocket origins
+	WSExposeAll bool     // Whether to expose all API modules over websocket
+
+	Handlers map[string]http.Handler // Additional handlers keyed by path (e.g. "/graphql")
+
+	Auth   Authenticator // Optional authenticator guarding every request
+	Policy *AccessPolicy // Optional access policy restricting RPC calls
+}
+
+// StartMultiplexEndpoint starts a single HTTP listener serving the HTTP and the
+// WebSocket RPC endpoints at the same time. Websocket upgrade requests are served
+// as WS-RPC, requests for any of the extra handler paths are routed to them and
+// everything else is served as HTTP-RPC. The websocket RPC server is nil if
+// websockets were not enabled.
+func StartMultiplexEndpoint(endpoint string, apis []API, config *MultiplexConfig) (net.Listener, *Server, *Server, error) {
+	// Create the RPC servers and the request router in front of them
+	httpHandler, err := newHTTPEndpointServer(apis, config.HTTPModules, config.Policy)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	router := &multiplexHandler{rpc: httpHandler}
+
+	var wsHandler *Server
+	if config.WSEnabled {
+		if wsHandler, err = newWSEndpointServer(apis, config.WSModules, config.WSExposeAll, config.Policy); err != nil {
+			return nil, nil, nil, err
+		}
+		router.ws = wsHandler.WebsocketHandler(config.WSOrigins)
+	}
+	if len(config.Handlers) > 0 {
+		router.mux = http.NewServeMux()
+		for path, handler := range config.Handlers {
+			router.mux.Handle(path, handler)
+			log.Debug("HTTP handler registered", "path", path)
+		}
+	}
+	// All handlers assembled, start the HTTP listener
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	go NewHTTPServer(config.HTTPCors, config.HTTPVirtualHosts, config.HTTPTimeouts, newAuthHandler(config.Auth, router)).Serve(listener)
+	return listener, httpHandler, wsHandler, nil
+}
+
+// multiplexHandler routes requests arriving on a shared listener between the
+// HTTP-RPC, WS-RPC and any custom handlers.
+type multiplexHandler struct {
+	rpc http.Handler   // HTTP-RPC handler serving everything not claimed by others
+	ws  http.Handler   // WS-RPC handler serving websocket upgrades (nil = disabled)
+	mux *http.ServeMux // Custom handlers keyed by path (nil = none)
+}
+
+// ServeHTTP implements http.Handler, routing the request to the handler it is
+// destined to.
+func (h *multiplexHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.ws != nil && isWebsocket(r) {
+		h.ws.ServeHTTP(w, r)
+		return
+	}
+	if h.mux != nil {
+		if handler, pattern := h.mux.Handler(r); pattern != "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	h.rpc.ServeHTTP(w, r)
+}
+
+// isWebsocket checks whether the request is a websocket upgrade request.
+func isWebsocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+// Tests that HTTP-RPC, WS-RPC and custom handlers are all served on a single
+// multiplexed listener.
+func TestMultiplexEndpoint(t *testing.T) {
+	apis := []API{{Namespace: "test", Version: "1.0", Service: new(testService), Public: true}}
+	config := &MultiplexConfig{
+		HTTPModules:      []string{"test"},
+		HTTPVirtualHosts: []string{"*"},
+		HTTPTimeouts:     DefaultHTTPTimeouts,
+		WSEnabled:        true,
+		WSModules:        []string{"test"},
+		WSOrigins:        []string{"*"},
+		Handlers: map[string]http.Handler{
+			"/custom": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("custom"))
+			}),
+		},
+	}
+	listener, httpHandler, wsHandler, err := StartMultiplexEndpoint("127.0.0.1:0", apis, config)
+	if err != nil {
+		t.Fatalf("failed to start endpoint: %v", err)
+	}
+	defer listener.Close()
+	defer httpHandler.Stop()
+	defer wsHandler.Stop()
+
+	addr := listener.Addr().String()
+
+	// Plain HTTP requests should be served as JSON-RPC
+	client, err := DialHTTP("http://" + addr)
+	if err != nil {
+		t.Fatalf("failed to dial HTTP: %v", err)
+	}
+	defer client.Close()
+
+	var result Result
+	if err := client.Call(&result, "test_echo", "hello", 10, &Args{"world"}); err != nil {
+		t.Fatalf("HTTP call failed: %v", err)
+	}
+	// Websocket upgrades should be handed to the websocket server
+	wsclient, err := DialWebsocket(context.Background(), "ws://"+addr, "")
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	defer wsclient.Close()
+
+	if err := wsclient.Call(&result, "test_echo", "hello", 10, &Args{"world"}); err != nil {
+		t.Fatalf("websocket call failed: %v", err)
+	}
+	// Registered paths should be routed to their own handlers
+	resp, err := http.Get("http://" + addr + "/custom")
+	if err != nil {
+		t.Fatalf("custom request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if body, _ := ioutil.ReadAll(resp.Body); string(body) != "custom" {
+		t.Fatalf("custom response mismatch: have %q, want %q", body, "custom")
+	}
+}
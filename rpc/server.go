@@ -66,12 +66,46 @@ func (s *Server) RegisterName(name string, receiver interface{}) error {
 	return s.services.registerName(name, receiver)
 }
 
+// SetAccessPolicy sets the policy restricting which callers may invoke which
+// methods. The policy may be replaced at any time and applies to all calls made
+// afterwards, including ones on already established connections. A nil policy
+// allows all calls.
+func (s *Server) SetAccessPolicy(policy *AccessPolicy) {
+	s.services.setAccessPolicy(policy)
+}
+
+// SetRateLimiter sets the limiter enforcing request budgets on the clients of
+// the server. The limiter may be replaced at any time and may be shared between
+// multiple servers. A nil limiter disables all limits.
+func (s *Server) SetRateLimiter(limiter *RateLimiter) {
+	s.services.setRateLimiter(limiter)
+}
+
+// SetAccessLog sets the log recording the calls served by the server. The log
+// may be replaced at any time and may be shared between multiple servers. A nil
+// log disables call recording.
+func (s *Server) SetAccessLog(logger *AccessLog) {
+	s.services.setAccessLog(logger)
+}
+
+// SetWebsocketConfig sets the transport settings of the websocket connections
+// accepted by the server. Connections established earlier keep their settings.
+func (s *Server) SetWebsocketConfig(config WebsocketConfig) {
+	s.services.setWebsocketConfig(config)
+}
+
 // ServeCodec reads incoming requests from codec, calls the appropriate callback and writes
 // the response back using the given codec. It will block until the codec is closed or the
 // server is stopped. In either case the codec is closed.
 //
 // Note that codec options are no longer supported.
 func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
+	s.serveCodec(context.Background(), codec)
+}
+
+// serveCodec serves a codec like ServeCodec, using the given context as the base
+// for all requests arriving through it.
+func (s *Server) serveCodec(ctx context.Context, codec ServerCodec) {
 	defer codec.Close()
 
 	// Don't serve if server is stopped.
@@ -83,7 +117,7 @@ func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
 	s.codecs.Add(codec)
 	defer s.codecs.Remove(codec)
 
-	c := initClient(codec, s.idgen, &s.services)
+	c := initClient(ctx, codec, s.idgen, &s.services)
 	<-codec.Closed()
 	c.Close()
 }
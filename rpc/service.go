@@ -40,6 +40,10 @@ var (
 type serviceRegistry struct {
 	mu       sync.Mutex
 	services map[string]service
+	access   *AccessPolicy   // Optional policy restricting the callable methods
+	limiter  *RateLimiter    // Optional limiter enforcing request budgets
+	logger   *AccessLog      // Optional log recording served calls
+	wsConfig WebsocketConfig // Settings of newly accepted websocket connections
 }
 
 // service represents a registered object.
@@ -104,6 +108,68 @@ func (r *serviceRegistry) callback(method string) *callback {
 	return r.services[elem[0]].callbacks[elem[1]]
 }
 
+// setAccessPolicy replaces the access policy restricting the callable methods.
+func (r *serviceRegistry) setAccessPolicy(policy *AccessPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.access = policy
+}
+
+// authorize checks whether the caller described by the context may call the
+// given method according to the access policy.
+func (r *serviceRegistry) authorize(ctx context.Context, method string) error {
+	r.mu.Lock()
+	policy := r.access
+	r.mu.Unlock()
+
+	if policy == nil {
+		return nil
+	}
+	return policy.authorize(ctx, method)
+}
+
+// setRateLimiter replaces the limiter enforcing the request budgets.
+func (r *serviceRegistry) setRateLimiter(limiter *RateLimiter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limiter = limiter
+}
+
+// rateLimiter returns the limiter enforcing the request budgets, if any.
+func (r *serviceRegistry) rateLimiter() *RateLimiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.limiter
+}
+
+// setAccessLog replaces the log recording served calls.
+func (r *serviceRegistry) setAccessLog(logger *AccessLog) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logger = logger
+}
+
+// accessLog returns the log recording served calls, if any.
+func (r *serviceRegistry) accessLog() *AccessLog {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.logger
+}
+
+// setWebsocketConfig replaces the settings of newly accepted websocket connections.
+func (r *serviceRegistry) setWebsocketConfig(config WebsocketConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.wsConfig = config
+}
+
+// websocketConfig returns the settings of newly accepted websocket connections.
+func (r *serviceRegistry) websocketConfig() WebsocketConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.wsConfig
+}
+
 // subscription returns a subscription callback in the given service.
 func (r *serviceRegistry) subscription(service, name string) *callback {
 	r.mu.Lock()
@@ -204,8 +204,12 @@ type ClientSubscription struct {
 	etype     reflect.Type
 	channel   reflect.Value
 	namespace string
-	subid     string
+	params    json.RawMessage // subscription arguments, for resubscribing
 	in        chan json.RawMessage
+	resume    chan struct{}
+
+	subidLock sync.Mutex // guards subid, which changes on resubscription
+	subid     string
 
 	quitOnce sync.Once     // ensures quit is closed once
 	quit     chan struct{} // quit is closed when the subscription exits
@@ -222,6 +226,7 @@ func newClientSubscription(c *Client, namespace string, channel reflect.Value) *
 		quit:      make(chan struct{}),
 		err:       make(chan error, 1),
 		in:        make(chan json.RawMessage),
+		resume:    make(chan struct{}, 1),
 	}
 	return sub
 }
@@ -238,6 +243,15 @@ func (sub *ClientSubscription) Err() <-chan error {
 	return sub.err
 }
 
+// Resumed returns a channel which receives a value whenever the subscription was
+// re-established after the client reconnected. Notifications sent by the server
+// while the connection was down are lost, so the intended use of Resumed is to
+// schedule back-filling the missed data. Values are only sent in the reconnecting
+// mode of the client, see Client.SetReconnect.
+func (sub *ClientSubscription) Resumed() <-chan struct{} {
+	return sub.resume
+}
+
 // Unsubscribe unsubscribes the notification and closes the error channel.
 // It can safely be called more than once.
 func (sub *ClientSubscription) Unsubscribe() {
@@ -263,6 +277,32 @@ func (sub *ClientSubscription) quitWithError(err error, unsubscribeServer bool)
 	})
 }
 
+// setID updates the server-side ID of the subscription.
+func (sub *ClientSubscription) setID(subid string) {
+	sub.subidLock.Lock()
+	defer sub.subidLock.Unlock()
+	sub.subid = subid
+}
+
+// closed reports whether the subscription has ended.
+func (sub *ClientSubscription) closed() bool {
+	select {
+	case <-sub.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// resumed signals the subscriber that the subscription was re-established. The
+// signal is dropped if a previous one is still pending.
+func (sub *ClientSubscription) resumed() {
+	select {
+	case sub.resume <- struct{}{}:
+	default:
+	}
+}
+
 func (sub *ClientSubscription) deliver(result json.RawMessage) (ok bool) {
 	select {
 	case sub.in <- result:
@@ -322,6 +362,10 @@ func (sub *ClientSubscription) unmarshal(result json.RawMessage) (interface{}, e
 }
 
 func (sub *ClientSubscription) requestUnsubscribe() error {
+	sub.subidLock.Lock()
+	subid := sub.subid
+	sub.subidLock.Unlock()
+
 	var result interface{}
-	return sub.client.Call(&result, sub.namespace+unsubscribeMethodSuffix, sub.subid)
+	return sub.client.Call(&result, sub.namespace+unsubscribeMethodSuffix, subid)
 }
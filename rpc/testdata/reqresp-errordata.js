@@ -0,0 +1,5 @@
+// This test checks that the code and data of errors returned by API methods are
+// included in the response.
+
+--> {"jsonrpc": "2.0", "id": 2, "method": "test_returnError"}
+<-- {"jsonrpc":"2.0","id":2,"error":{"code":444,"message":"testError","data":"testError data"}}
@@ -53,6 +53,12 @@ func sequentialIDGenerator() func() ID {
 
 type testService struct{}
 
+type testError struct{}
+
+func (testError) Error() string          { return "testError" }
+func (testError) ErrorCode() int         { return 444 }
+func (testError) ErrorData() interface{} { return "testError data" }
+
 type Args struct {
 	S string
 }
@@ -73,6 +79,10 @@ func (s *testService) EchoWithCtx(ctx context.Context, str string, i int, args *
 	return Result{str, i, args}
 }
 
+func (s *testService) ReturnError() error {
+	return testError{}
+}
+
 func (s *testService) Sleep(ctx context.Context, duration time.Duration) {
 	time.Sleep(duration)
 }
@@ -17,40 +17,43 @@
 package rpc
 
 import (
-	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	mapset "github.com/deckarep/golang-set"
 	"github.com/ethereum/go-ethereum/log"
-	"golang.org/x/net/websocket"
+	"github.com/gorilla/websocket"
 )
 
-// websocketJSONCodec is a custom JSON codec with payload size enforcement and
-// special number parsing.
-var websocketJSONCodec = websocket.Codec{
-	// Marshal is the stock JSON marshaller used by the websocket library too.
-	Marshal: func(v interface{}) ([]byte, byte, error) {
-		msg, err := json.Marshal(v)
-		return msg, websocket.TextFrame, err
-	},
-	// Unmarshal is a specialized unmarshaller to properly convert numbers.
-	Unmarshal: func(msg []byte, payloadType byte, v interface{}) error {
-		dec := json.NewDecoder(bytes.NewReader(msg))
-		dec.UseNumber()
+const (
+	wsReadBuffer       = 1024
+	wsWriteBuffer      = 1024
+	wsPingInterval     = 30 * time.Second        // Default interval of keepalive pings on idle connections
+	wsPingWriteTimeout = 5 * time.Second         // Time allowed to send a ping
+	wsPongTimeout      = 30 * time.Second        // Time allowed for the remote end to answer a ping
+	wsCloseTimeout     = time.Second             // Time allowed to send a close frame
+	wsClientReadLimit  = 15 * 1024 * 1024        // Maximum size of messages received by clients
+	wsServerReadLimit  = maxRequestContentLength // Default maximum size of messages received by servers
+)
+
+var wsBufferPool = new(sync.Pool)
 
-		return dec.Decode(v)
-	},
+// WebsocketConfig contains the transport settings of the websocket connections
+// accepted by a server.
+type WebsocketConfig struct {
+	MessageLimit int64         `toml:",omitempty"` // Maximum size of a received message in bytes (0 = default)
+	Compression  bool          `toml:",omitempty"` // Whether to negotiate permessage-deflate compression
+	PingInterval time.Duration `toml:",omitempty"` // Interval of keepalive pings on idle connections (0 = default)
 }
 
 // WebsocketHandler returns a handler that serves JSON-RPC to WebSocket connections.
@@ -58,36 +61,42 @@ var websocketJSONCodec = websocket.Codec{
 // allowedOrigins should be a comma-separated list of allowed origin URLs.
 // To allow connections with any origin, pass "*".
 func (s *Server) WebsocketHandler(allowedOrigins []string) http.Handler {
-	return websocket.Server{
-		Handshake: wsHandshakeValidator(allowedOrigins),
-		Handler: func(conn *websocket.Conn) {
-			codec := newWebsocketCodec(conn)
-			s.ServeCodec(codec, OptionMethodInvocation|OptionSubscriptions)
-		},
-	}
-}
+	checkOrigin := wsHandshakeValidator(allowedOrigins)
 
-func newWebsocketCodec(conn *websocket.Conn) ServerCodec {
-	// Create a custom encode/decode pair to enforce payload size and number encoding
-	conn.MaxPayloadBytes = maxRequestContentLength
-	encoder := func(v interface{}) error {
-		return websocketJSONCodec.Send(conn, v)
-	}
-	decoder := func(v interface{}) error {
-		return websocketJSONCodec.Receive(conn, v)
-	}
-	rpcconn := Conn(conn)
-	if conn.IsServerConn() {
-		// Override remote address with the actual socket address because
-		// package websocket crashes if there is no request origin.
-		addr := conn.Request().RemoteAddr
-		if wsaddr := conn.RemoteAddr().(*websocket.Addr); wsaddr.URL != nil {
-			// Add origin if present.
-			addr += "(" + wsaddr.URL.String() + ")"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config := s.services.websocketConfig()
+		upgrader := websocket.Upgrader{
+			ReadBufferSize:    wsReadBuffer,
+			WriteBufferSize:   wsWriteBuffer,
+			WriteBufferPool:   wsBufferPool,
+			CheckOrigin:       checkOrigin,
+			EnableCompression: config.Compression,
 		}
-		rpcconn = connWithRemoteAddr{conn, addr}
-	}
-	return NewCodec(rpcconn, encoder, decoder)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Debug("WebSocket upgrade failed", "err", err)
+			return
+		}
+		// Drop any deadlines inherited from the HTTP server the connection was
+		// hijacked from, websocket connections are long lived.
+		conn.UnderlyingConn().SetDeadline(time.Time{})
+
+		// Carry over the caller identity, but not the lifecycle of the upgrade request
+		ctx := withTransport(context.Background(), TransportWS)
+		if identity, ok := IdentityFromContext(r.Context()); ok {
+			ctx = context.WithValue(ctx, identityContextKey{}, identity)
+		}
+		limit := config.MessageLimit
+		if limit == 0 {
+			limit = wsServerReadLimit
+		}
+		codec := newWebsocketCodec(conn, limit, config.PingInterval, websocket.CloseGoingAway)
+		codec.remoteAddr = r.RemoteAddr
+		if origin := r.Header.Get("Origin"); origin != "" {
+			codec.remoteAddr += "(" + origin + ")"
+		}
+		s.serveCodec(ctx, codec)
+	})
 }
 
 // NewWSServer creates a new websocket RPC server around an API provider.
@@ -97,10 +106,16 @@ func NewWSServer(allowedOrigins []string, srv *Server) *http.Server {
 	return &http.Server{Handler: srv.WebsocketHandler(allowedOrigins)}
 }
 
+// newAuthWSServer creates a new websocket RPC server around an API provider,
+// authenticating the handshake requests before upgrading the connections.
+func newAuthWSServer(allowedOrigins []string, auth Authenticator, srv *Server) *http.Server {
+	return &http.Server{Handler: newAuthHandler(auth, srv.WebsocketHandler(allowedOrigins))}
+}
+
 // wsHandshakeValidator returns a handler that verifies the origin during the
 // websocket upgrade process. When a '*' is specified as an allowed origins all
 // connections are accepted.
-func wsHandshakeValidator(allowedOrigins []string) func(*websocket.Config, *http.Request) error {
+func wsHandshakeValidator(allowedOrigins []string) func(*http.Request) bool {
 	origins := mapset.NewSet()
 	allowAllOrigins := false
 
@@ -123,49 +138,58 @@ func wsHandshakeValidator(allowedOrigins []string) func(*websocket.Config, *http
 
 	log.Debug(fmt.Sprintf("Allowed origin(s) for WS RPC interface %v", origins.ToSlice()))
 
-	f := func(cfg *websocket.Config, req *http.Request) error {
+	f := func(req *http.Request) bool {
 		// Skip origin verification if no Origin header is present. The origin check
 		// is supposed to protect against browser based attacks. Browsers always set
 		// Origin. Non-browser software can put anything in origin and checking it doesn't
 		// provide additional security.
 		if _, ok := req.Header["Origin"]; !ok {
-			return nil
+			return true
 		}
 		// Verify origin against whitelist.
 		origin := strings.ToLower(req.Header.Get("Origin"))
 		if allowAllOrigins || origins.Contains(origin) {
-			return nil
+			return true
 		}
 		log.Warn("Rejected WebSocket connection", "origin", origin)
-		return errors.New("origin not allowed")
+		return false
 	}
 
 	return f
 }
 
-func wsGetConfig(endpoint, origin string) (*websocket.Config, error) {
-	if origin == "" {
-		var err error
-		if origin, err = os.Hostname(); err != nil {
-			return nil, err
-		}
-		if strings.HasPrefix(endpoint, "wss") {
-			origin = "https://" + strings.ToLower(origin)
-		} else {
-			origin = "http://" + strings.ToLower(origin)
-		}
+// wsHandshakeError is returned if the websocket handshake with a server fails,
+// carrying the HTTP status of the rejection if there was one.
+type wsHandshakeError struct {
+	err    error
+	status string
+}
+
+func (e wsHandshakeError) Error() string {
+	s := e.err.Error()
+	if e.status != "" {
+		s += " (HTTP status " + e.status + ")"
 	}
-	config, err := websocket.NewConfig(endpoint, origin)
+	return s
+}
+
+// wsClientHeaders splits the credentials off the given endpoint, returning the
+// endpoint to dial and the headers to send along with the handshake.
+func wsClientHeaders(endpoint, origin string) (string, http.Header, error) {
+	endpointURL, err := url.Parse(endpoint)
 	if err != nil {
-		return nil, err
+		return endpoint, nil, err
 	}
-
-	if config.Location.User != nil {
-		b64auth := base64.StdEncoding.EncodeToString([]byte(config.Location.User.String()))
-		config.Header.Add("Authorization", "Basic "+b64auth)
-		config.Location.User = nil
+	header := make(http.Header)
+	if origin != "" {
+		header.Add("Origin", origin)
 	}
-	return config, nil
+	if endpointURL.User != nil {
+		b64auth := base64.StdEncoding.EncodeToString([]byte(endpointURL.User.String()))
+		header.Add("Authorization", "Basic "+b64auth)
+		endpointURL.User = nil
+	}
+	return endpointURL.String(), header, nil
 }
 
 // DialWebsocket creates a new RPC client that communicates with a JSON-RPC server
@@ -174,65 +198,152 @@ func wsGetConfig(endpoint, origin string) (*websocket.Config, error) {
 // The context is used for the initial connection establishment. It does not
 // affect subsequent interactions with the client.
 func DialWebsocket(ctx context.Context, endpoint, origin string) (*Client, error) {
-	config, err := wsGetConfig(endpoint, origin)
+	return DialWebsocketWithAuth(ctx, endpoint, origin, nil)
+}
+
+// DialWebsocketWithAuth creates a new RPC client that communicates with a JSON-RPC
+// server that is listening on the given endpoint, attaching the credentials of
+// the given provider to every connection handshake.
+func DialWebsocketWithAuth(ctx context.Context, endpoint, origin string, auth HTTPAuth) (*Client, error) {
+	endpoint, header, err := wsClientHeaders(endpoint, origin)
 	if err != nil {
 		return nil, err
 	}
-
+	dialer := websocket.Dialer{
+		NetDialContext:    dialContext,
+		ReadBufferSize:    wsReadBuffer,
+		WriteBufferSize:   wsWriteBuffer,
+		WriteBufferPool:   wsBufferPool,
+		EnableCompression: true,
+	}
 	return newClient(ctx, func(ctx context.Context) (ServerCodec, error) {
-		conn, err := wsDialContext(ctx, config)
+		dialHeader := header
+		if auth != nil {
+			// Mint fresh credentials for every (re)connection
+			dialHeader = make(http.Header, len(header)+1)
+			for key, values := range header {
+				dialHeader[key] = values
+			}
+			if err := auth(dialHeader); err != nil {
+				return nil, err
+			}
+		}
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, defaultDialTimeout)
+			defer cancel()
+		}
+		conn, resp, err := dialer.DialContext(ctx, endpoint, dialHeader)
 		if err != nil {
-			return nil, err
+			hErr := wsHandshakeError{err: err}
+			if resp != nil {
+				hErr.status = resp.Status
+			}
+			return nil, hErr
 		}
-		return newWebsocketCodec(conn), nil
+		return newWebsocketCodec(conn, wsClientReadLimit, 0, websocket.CloseNormalClosure), nil
 	})
 }
 
-func wsDialContext(ctx context.Context, config *websocket.Config) (*websocket.Conn, error) {
-	var conn net.Conn
-	var err error
-	switch config.Location.Scheme {
-	case "ws":
-		conn, err = dialContext(ctx, "tcp", wsDialAddress(config.Location))
-	case "wss":
-		dialer := contextDialer(ctx)
-		conn, err = tls.DialWithDialer(dialer, "tcp", wsDialAddress(config.Location), config.TlsConfig)
-	default:
-		err = websocket.ErrBadScheme
+// websocketCodec is a JSON-RPC codec on top of a websocket connection, keeping
+// the connection alive with pings while it is idle.
+type websocketCodec struct {
+	*jsonCodec
+	conn *websocket.Conn
+
+	closeCode int32         // Close code sent to the remote end on close (atomic)
+	closing   sync.Once     // Ensures the close frame is only sent once
+	pingReset chan struct{} // Notifies the ping loop of written messages
+	wg        sync.WaitGroup
+}
+
+// newWebsocketCodec wraps a websocket connection into a codec, limiting the size
+// of received messages and sending keepalive pings at the given interval. The
+// close code is sent to the remote end when the codec is closed.
+func newWebsocketCodec(conn *websocket.Conn, limit int64, ping time.Duration, closeCode int) *websocketCodec {
+	if ping == 0 {
+		ping = wsPingInterval
 	}
-	if err != nil {
-		return nil, err
+	conn.SetReadLimit(limit)
+	conn.SetPongHandler(func(appData string) error {
+		conn.SetReadDeadline(time.Time{})
+		return nil
+	})
+	wc := &websocketCodec{
+		jsonCodec: newFuncCodec(conn, conn.WriteJSON, conn.ReadJSON),
+		conn:      conn,
+		closeCode: int32(closeCode),
+		pingReset: make(chan struct{}, 1),
 	}
-	ws, err := websocket.NewClient(config, conn)
-	if err != nil {
-		conn.Close()
-		return nil, err
+	wc.wg.Add(1)
+	go wc.pingLoop(ping)
+	return wc
+}
+
+// Read reads the next message from the connection. Messages which are not valid
+// JSON are reported to the remote end with the close code of the connection.
+func (wc *websocketCodec) Read() ([]*jsonrpcMessage, bool, error) {
+	msgs, batch, err := wc.jsonCodec.Read()
+	if _, ok := err.(*json.SyntaxError); ok {
+		atomic.StoreInt32(&wc.closeCode, websocket.CloseInvalidFramePayloadData)
 	}
-	return ws, err
+	return msgs, batch, err
 }
 
-var wsPortMap = map[string]string{"ws": "80", "wss": "443"}
+// Write sends a message to the remote end, postponing the next keepalive ping.
+func (wc *websocketCodec) Write(ctx context.Context, v interface{}) error {
+	err := wc.jsonCodec.Write(ctx, v)
+	if err == nil {
+		select {
+		case wc.pingReset <- struct{}{}:
+		default:
+		}
+	}
+	return err
+}
+
+// Close sends a close frame to the remote end and closes the connection.
+func (wc *websocketCodec) Close() {
+	wc.closing.Do(func() {
+		code := int(atomic.LoadInt32(&wc.closeCode))
+		wc.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(wsCloseTimeout))
+	})
+	wc.jsonCodec.Close()
+	wc.wg.Wait()
+}
+
+// pingLoop sends a ping to the remote end whenever nothing was sent over the
+// connection for the given interval. If the ping isn't answered in time, the
+// pending read fails and the connection is torn down.
+func (wc *websocketCodec) pingLoop(interval time.Duration) {
+	defer wc.wg.Done()
 
-func wsDialAddress(location *url.URL) string {
-	if _, ok := wsPortMap[location.Scheme]; ok {
-		if _, _, err := net.SplitHostPort(location.Host); err != nil {
-			return net.JoinHostPort(location.Host, wsPortMap[location.Scheme])
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-wc.closed:
+			return
+
+		case <-wc.pingReset:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(interval)
+
+		case <-timer.C:
+			// Arm the pong timeout before pinging, so a quick answer can't be lost
+			wc.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+			if err := wc.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsPingWriteTimeout)); err != nil {
+				log.Trace("Failed to send websocket ping", "err", err)
+			}
+			timer.Reset(interval)
 		}
 	}
-	return location.Host
 }
 
 func dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
 	d := &net.Dialer{KeepAlive: tcpKeepAliveInterval}
 	return d.DialContext(ctx, network, addr)
 }
-
-func contextDialer(ctx context.Context) *net.Dialer {
-	dialer := &net.Dialer{Cancel: ctx.Done(), KeepAlive: tcpKeepAliveInterval}
-	if deadline, ok := ctx.Deadline(); ok {
-		dialer.Deadline = deadline
-	} else {
-		dialer.Deadline = time.Now().Add(defaultDialTimeout)
-	}
-	return dialer
-}
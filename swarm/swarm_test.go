@@ -53,7 +53,7 @@ func TestNewSwarm(t *testing.T) {
 		ipcEndpoint = `\\.\pipe\TestSwarm-` + hex.EncodeToString(b)
 	}
 
-	_, server, err := rpc.StartIPCEndpoint(ipcEndpoint, nil)
+	_, server, err := rpc.StartIPCEndpoint(ipcEndpoint, nil, nil)
 	if err != nil {
 		t.Error(err)
 	}